@@ -1,26 +1,58 @@
 package main
 
 import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+
+	"golang.org/x/term"
 
 	"valette.software/internal/authentication"
 	"valette.software/internal/blog"
+	"valette.software/internal/comment"
 	"valette.software/internal/config"
+	"valette.software/internal/database"
 	"valette.software/internal/i18n"
+	"valette.software/internal/markdownfile"
+	"valette.software/internal/media"
+	"valette.software/internal/newsletter"
 	"valette.software/internal/page"
 	"valette.software/internal/router"
+	"valette.software/internal/sitemap"
+	"valette.software/internal/static"
+	"valette.software/internal/staticsite"
+	"valette.software/internal/user"
+	"valette.software/internal/webmention"
 )
 
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "--") {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	config.Init()
 	page.Init()
+	database.Init()
 	blog.Init()
+	media.Init()
+	comment.Init()
+	renderStalePosts()
+	sitemap.Init()
+	webmention.Init(config.GetConfig().GetBaseUrl(), webmention.NewClient())
+	webmention.Start()
+	newsletter.Init(config.GetConfig().GetBaseUrl())
+	newsletter.Start()
 	i18n.Init()
 	authentication.Init(config.GetConfig())
 
-	root := router.Build()
+	root := router.Build(config.GetConfig())
 
 	http.Handle("/", root)
 
@@ -36,6 +68,185 @@ func main() {
 	println("server closed")
 }
 
+// runCommand runs the maintenance command instead of the server.
+func runCommand(command string, args []string) {
+	// the hash is written in the configuration, before the database exists
+	if command == "hash-password" {
+		hashPassword()
+		return
+	}
+
+	database.Init()
+	media.Init()
+	blog.Init()
+
+	switch command {
+	case "regenerate-media":
+		err := media.RegenerateVariants()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// the posts show the variants in their srcset
+		renderPosts()
+	case "render-posts":
+		renderPosts()
+	case "import-markdown":
+		if len(args) != 1 {
+			log.Fatal("usage: import-markdown <directory or zip file>")
+		}
+
+		importPosts(args[0])
+	case "export-markdown":
+		if len(args) != 1 {
+			log.Fatal("usage: export-markdown <directory>")
+		}
+
+		count, err := markdownfile.ExportDir(args[0])
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("%d post(s) exported", count)
+	case "export":
+		if len(args) != 2 || args[0] != "--out" {
+			log.Fatal("usage: export --out <directory>")
+		}
+
+		exportSite(args[1])
+	case "disable-2fa":
+		if len(args) != 1 {
+			log.Fatal("usage: disable-2fa <username>")
+		}
+
+		config.Init()
+		user.Init(config.GetConfig().GetAdminPassword())
+
+		// for the users who lost both their phone and their recovery codes
+		if err := user.DisableTotpByUsername(args[0]); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("second factor of %s disabled", args[0])
+	default:
+		log.Fatal("unknown command ", command, ", the commands are regenerate-media, render-posts, import-markdown, export-markdown, export, hash-password and disable-2fa")
+	}
+}
+
+// exportSite writes the public pages in out, so that the site can be served
+// as static files.
+func exportSite(out string) {
+	config.Init()
+	comment.Init()
+	webmention.Init(config.GetConfig().GetBaseUrl(), webmention.NewClient())
+	page.Init()
+	sitemap.Init()
+	i18n.Init()
+	authentication.Init(config.GetConfig())
+
+	root := router.Build(config.GetConfig())
+	count, err := staticsite.Export(root, static.Files(), out, config.GetConfig().GetBaseUrl())
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("%d page(s) exported in %s", count, out)
+}
+
+// hashPassword prints the hash of the password typed, or read from the
+// standard input, to write as admin_password in the configuration.
+func hashPassword() {
+	var password []byte
+	var err error
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, "password: ")
+		password, err = term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+	} else {
+		var line string
+		line, err = bufio.NewReader(os.Stdin).ReadString('\n')
+
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+
+		password = []byte(strings.TrimRight(line, "\r\n"))
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(password) == 0 {
+		log.Fatal("the password must not be empty")
+	}
+
+	hash, err := user.HashPassword(string(password))
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(hash)
+}
+
+func importPosts(source string) {
+	var report markdownfile.Report
+	var err error
+
+	if strings.HasSuffix(strings.ToLower(source), ".zip") {
+		archive, openErr := zip.OpenReader(source)
+
+		if openErr != nil {
+			log.Fatal(openErr)
+		}
+
+		defer archive.Close()
+
+		report, err = markdownfile.Import(archive, "import")
+	} else {
+		report, err = markdownfile.Import(os.DirFS(source), "import")
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, conflict := range report.Conflicts {
+		log.Printf("%s: %s", conflict.File, conflict.Reason)
+	}
+
+	log.Printf("%d post(s) imported, %d file(s) skipped", len(report.Imported), len(report.Conflicts))
+}
+
+func renderPosts() {
+	count, err := blog.RenderPosts(false)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("%d post(s) rendered", count)
+}
+
+// renderStalePosts renders the posts saved before the last change of the
+// renderer, rather than rendering them on every request.
+func renderStalePosts() {
+	count, err := blog.RenderPosts(true)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if count > 0 {
+		log.Printf("%d post(s) rendered with the new renderer", count)
+	}
+}
+
 func buildListenUrl() string {
 	port := "80"
 
@@ -1,38 +1,266 @@
 package authentication
 
 import (
-	"crypto/rand"
 	"errors"
+	"log"
+	"time"
 
 	"valette.software/internal/config"
+	"valette.software/internal/database"
+	"valette.software/internal/user"
+	"valette.software/internal/webauthn"
 )
 
-var sessions map[string]struct{}
-var password string
+// IdleTimeout ends the sessions without request for that long.
+const IdleTimeout = 24 * time.Hour
 
-var ErrWrongPassword = errors.New("wrong password")
+// AbsoluteTimeout ends the sessions that long after the login, however used.
+const AbsoluteTimeout = 30 * 24 * time.Hour
 
+// PendingTimeout is the time given to type the second factor after the
+// password.
+const PendingTimeout = 5 * time.Minute
+
+// maxAttempts is the number of wrong second factors ending the pending
+// session, the password must be typed again.
+const maxAttempts = 5
+
+// touchInterval is the time between the records of the requests of a
+// session, the database isn't written on every request.
+const touchInterval = time.Minute
+
+var store Store
+
+// now and the functions reading the users are replaced in the tests.
+var now = time.Now
+var findUser = user.Get
+var checkCredentials = user.Authenticate
+var needsSecondFactor = user.HasTotp
+var checkSecondFactor = user.CheckSecondFactor
+var checkPasskey = user.AuthenticatePasskey
+
+// Init opens the sessions kept in the database. The password of the
+// configuration file is the one of the first owner, created when the site
+// has no account yet.
 func Init(config config.Configurator) {
-	sessions = make(map[string]struct{})
-	password = config.GetAdminPassword()
+	user.Init(config.GetAdminPassword())
+	store = NewSqliteStore(database.Get())
+}
+
+func expired(session Session, at time.Time) bool {
+	if session.Pending {
+		return at.Sub(time.Unix(session.CreatedAt, 0)) > PendingTimeout
+	}
+
+	return at.Sub(time.Unix(session.LastSeenAt, 0)) > IdleTimeout || at.Sub(time.Unix(session.CreatedAt, 0)) > AbsoluteTimeout
+}
+
+// CheckSession returns the session of the token and its user. The account
+// is read again on every request, a deleted user or a changed role applies
+// at once.
+func CheckSession(token string) (Session, user.User, bool) {
+	if token == "" {
+		return Session{}, user.User{}, false
+	}
+
+	session, err := store.Find(token)
+
+	if err != nil {
+		if !errors.Is(err, ErrSessionNotFound) {
+			log.Print(err)
+		}
+
+		return Session{}, user.User{}, false
+	}
+
+	at := now()
+
+	if session.Pending {
+		return Session{}, user.User{}, false
+	}
+
+	if expired(session, at) {
+		store.Delete(session.SessionId)
+		return Session{}, user.User{}, false
+	}
+
+	loggedIn, err := findUser(session.UserId)
+
+	if err != nil {
+		return Session{}, user.User{}, false
+	}
+
+	if at.Sub(time.Unix(session.LastSeenAt, 0)) >= touchInterval {
+		session.LastSeenAt = at.Unix()
+
+		if err := store.Touch(session.SessionId, session.LastSeenAt); err != nil {
+			log.Print(err)
+		}
+	}
+
+	return session, loggedIn, true
+}
+
+// Authenticate opens a session for the user whose credentials are given,
+// from the browser described by userAgent at ip, and returns its token. The
+// session is pending when the user has a second factor, VerifySecondFactor
+// opens it.
+func Authenticate(username string, password string, userAgent string, ip string) (string, bool, error) {
+	loggedIn, err := checkCredentials(username, password)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	pending, err := needsSecondFactor(loggedIn.UserId)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	token, err := openSession(loggedIn.UserId, pending, userAgent, ip)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	return token, pending, nil
+}
+
+// AuthenticatePasskey opens a session for the user whose passkey signed the
+// challenge of the login, and returns its token. The passkey stands for the
+// second factor as well.
+func AuthenticatePasskey(rp webauthn.RelyingParty, response webauthn.AssertionResponse, userAgent string, ip string) (string, error) {
+	loggedIn, err := checkPasskey(rp, response)
+
+	if err != nil {
+		return "", err
+	}
+
+	return openSession(loggedIn.UserId, false, userAgent, ip)
 }
 
-func CheckSession(sessionId string) bool {
-	_, ok := sessions[sessionId]
+func openSession(userId int64, pending bool, userAgent string, ip string) (string, error) {
+	at := now()
+
+	// the expired sessions are dropped from time to time, on logins
+	err := store.DeleteExpired(at.Add(-IdleTimeout).Unix(), at.Add(-AbsoluteTimeout).Unix())
+
+	if err != nil {
+		log.Print(err)
+	}
 
-	return ok
+	token, _, err := store.Create(Session{
+		UserId:     userId,
+		CreatedAt:  at.Unix(),
+		LastSeenAt: at.Unix(),
+		UserAgent:  userAgent,
+		Ip:         ip,
+		Pending:    pending,
+	})
+
+	if err != nil {
+		log.Print(err)
+		return "", err
+	}
+
+	return token, nil
 }
 
-func Authenticate(pwd string) (string, error) {
-	if pwd == password {
-		sessionId := rand.Text()
-		sessions[sessionId] = struct{}{}
-		return sessionId, nil
+// VerifySecondFactor opens the pending session of the token if the code is
+// the second factor of its user, and returns the new token of the session.
+func VerifySecondFactor(token string, code string) (string, error) {
+	session, err := store.Find(token)
+
+	if err != nil {
+		return "", err
 	}
 
-	return "", ErrWrongPassword
+	if !session.Pending || expired(session, now()) {
+		store.Delete(session.SessionId)
+		return "", ErrSessionNotFound
+	}
+
+	err = checkSecondFactor(session.UserId, code)
+
+	if errors.Is(err, user.ErrInvalidCode) {
+		failures, countErr := store.CountFailure(session.SessionId)
+
+		if countErr == nil && failures >= maxAttempts {
+			store.Delete(session.SessionId)
+			return "", ErrSessionNotFound
+		}
+
+		return "", err
+	} else if err != nil {
+		return "", err
+	}
+
+	// the session starts now, its idle time counts from the second factor
+	if err := store.Touch(session.SessionId, now().Unix()); err != nil {
+		log.Print(err)
+	}
+
+	return store.Promote(session.SessionId)
 }
 
-func Logout() {
-	sessions = make(map[string]struct{})
+// Logout ends the session of the token, the other sessions of the user stay.
+func Logout(token string) error {
+	session, err := store.Find(token)
+
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = store.Delete(session.SessionId)
+
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// ListSessions returns the sessions still open that viewer may see: every
+// session for the owners, their own ones for the others.
+func ListSessions(viewer user.User) ([]Session, error) {
+	sessions, err := store.List()
+
+	if err != nil {
+		return nil, err
+	}
+
+	at := now()
+	visible := make([]Session, 0, len(sessions))
+
+	for _, session := range sessions {
+		if session.Pending || expired(session, at) {
+			continue
+		}
+
+		if viewer.HasRole(user.RoleOwner) || session.UserId == viewer.UserId {
+			visible = append(visible, session)
+		}
+	}
+
+	return visible, nil
+}
+
+// Revoke ends a session listed to viewer by ListSessions.
+func Revoke(viewer user.User, sessionId int64) error {
+	sessions, err := ListSessions(viewer)
+
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.SessionId == sessionId {
+			return store.Delete(sessionId)
+		}
+	}
+
+	return ErrSessionNotFound
 }
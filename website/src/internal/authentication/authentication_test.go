@@ -0,0 +1,342 @@
+package authentication
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"valette.software/internal/database/databasetest"
+	"valette.software/internal/user"
+	"valette.software/internal/webauthn"
+)
+
+// testUsers are the accounts of the tests, their password is "password".
+// The editor has a second factor, "123456" or the recovery code "recovery".
+var testUsers = map[int64]user.User{
+	1: {UserId: 1, Username: "owner", Role: user.RoleOwner},
+	2: {UserId: 2, Username: "writer", Role: user.RoleContributor},
+	3: {UserId: 3, Username: "editor", Role: user.RoleEditor},
+}
+
+// openTestStore points the package to a freshly migrated database holding
+// the test users, and returns the clock of the package, set at will.
+func openTestStore(t *testing.T) *time.Time {
+	conn := databasetest.Open(t)
+
+	for _, account := range testUsers {
+		_, err := conn.Exec(
+			"INSERT INTO user (user_id, username, display_name, password_hash, role, created_at) VALUES (?, ?, ?, '', ?, 0)",
+			account.UserId, account.Username, account.Username, account.Role,
+		)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store = NewSqliteStore(conn)
+	now = func() time.Time { return clock }
+
+	findUser = func(id int64) (user.User, error) {
+		if account, ok := testUsers[id]; ok {
+			return account, nil
+		}
+
+		return user.User{}, user.ErrNotFound
+	}
+
+	checkCredentials = func(username string, password string) (user.User, error) {
+		for _, account := range testUsers {
+			if account.Username == username && password == "password" {
+				return account, nil
+			}
+		}
+
+		return user.User{}, user.ErrWrongCredentials
+	}
+
+	needsSecondFactor = func(id int64) (bool, error) {
+		return id == 3, nil
+	}
+
+	recoveryUsed := false
+
+	checkSecondFactor = func(id int64, code string) error {
+		switch {
+		case id == 3 && code == "123456":
+			return nil
+		case id == 3 && code == "recovery" && !recoveryUsed:
+			recoveryUsed = true
+			return nil
+		default:
+			return user.ErrInvalidCode
+		}
+	}
+
+	return &clock
+}
+
+func login(t *testing.T, username string) string {
+	token, pending, err := Authenticate(username, "password", "Mozilla/5.0 (X11; Linux x86_64; rv:140.0) Gecko/20100101 Firefox/140.0", "192.0.2.1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pending != (username == "editor") {
+		t.Fatalf("expected the session of %s to be pending: %v, got %v", username, username == "editor", pending)
+	}
+
+	return token
+}
+
+func TestSessionExpiry(t *testing.T) {
+	clock := openTestStore(t)
+
+	if _, _, err := Authenticate("owner", "wrong", "", ""); !errors.Is(err, user.ErrWrongCredentials) {
+		t.Errorf("expected a wrong password to open no session, got %v", err)
+	}
+
+	token := login(t, "owner")
+
+	type data struct {
+		elapsed time.Duration
+		valid   bool
+	}
+
+	// every step is measured from the previous one
+	testData := []data{
+		{0, true},
+		{IdleTimeout - time.Minute, true},
+		{IdleTimeout - time.Minute, true},
+		{IdleTimeout + time.Minute, false},
+	}
+
+	for _, test := range testData {
+		*clock = clock.Add(test.elapsed)
+		_, loggedIn, valid := CheckSession(token)
+
+		if valid != test.valid || (valid && loggedIn.Username != "owner") {
+			t.Errorf("expected %v after %v, got %v for %+v", test.valid, test.elapsed, valid, loggedIn)
+		}
+	}
+
+	token = login(t, "owner")
+
+	for elapsed := IdleTimeout / 2; elapsed <= AbsoluteTimeout; elapsed += IdleTimeout / 2 {
+		*clock = clock.Add(IdleTimeout / 2)
+
+		if _, _, valid := CheckSession(token); !valid {
+			t.Fatalf("expected the session used every %v to last %v, ended after %v", IdleTimeout/2, AbsoluteTimeout, elapsed)
+		}
+	}
+
+	*clock = clock.Add(IdleTimeout / 2)
+
+	if _, _, valid := CheckSession(token); valid {
+		t.Errorf("expected the session to end after %v however used", AbsoluteTimeout)
+	}
+
+	if _, _, valid := CheckSession("unknown"); valid {
+		t.Errorf("expected an unknown token to be refused")
+	}
+}
+
+func TestLogoutAndRevoke(t *testing.T) {
+	openTestStore(t)
+
+	first := login(t, "owner")
+	second := login(t, "owner")
+	writer := login(t, "writer")
+
+	if err := Logout(first); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, valid := CheckSession(first); valid {
+		t.Errorf("expected the session logged out to end")
+	}
+
+	if _, _, valid := CheckSession(second); !valid {
+		t.Errorf("expected the other session of the user to stay")
+	}
+
+	sessions, err := ListSessions(testUsers[2])
+
+	if err != nil || len(sessions) != 1 || sessions[0].Username != "writer" || sessions[0].Device() != "Firefox on Linux" || sessions[0].Ip != "192.0.2.1" {
+		t.Fatalf("expected the contributor to see their session only, got %+v, error: %v", sessions, err)
+	}
+
+	ownerSession, _, _ := CheckSession(second)
+
+	if err := Revoke(testUsers[2], ownerSession.SessionId); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected a contributor to not end the sessions of the others, got %v", err)
+	}
+
+	sessions, _ = ListSessions(testUsers[1])
+
+	if len(sessions) != 2 {
+		t.Fatalf("expected the owner to see every session, got %+v", sessions)
+	}
+
+	writerSession, _, _ := CheckSession(writer)
+
+	if err := Revoke(testUsers[1], writerSession.SessionId); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, valid := CheckSession(writer); valid {
+		t.Errorf("expected the revoked session to end")
+	}
+}
+
+func TestConcurrentSessions(t *testing.T) {
+	openTestStore(t)
+
+	token := login(t, "owner")
+	var wait sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wait.Add(2)
+
+		go func() {
+			defer wait.Done()
+
+			if _, _, valid := CheckSession(token); !valid {
+				t.Errorf("expected the session to be valid during the logins")
+			}
+		}()
+
+		go func() {
+			defer wait.Done()
+
+			if _, _, err := Authenticate("writer", "password", "", ""); err != nil {
+				t.Errorf("expected the logins to succeed during the requests, got %v", err)
+			}
+		}()
+	}
+
+	wait.Wait()
+}
+
+func TestSecondFactor(t *testing.T) {
+	clock := openTestStore(t)
+
+	pending := login(t, "editor")
+
+	if _, _, valid := CheckSession(pending); valid {
+		t.Errorf("expected the session to wait for the second factor")
+	}
+
+	if sessions, _ := ListSessions(testUsers[1]); len(sessions) != 0 {
+		t.Errorf("expected the pending sessions to be hidden, got %+v", sessions)
+	}
+
+	if _, err := VerifySecondFactor(pending, "000000"); !errors.Is(err, user.ErrInvalidCode) {
+		t.Errorf("expected a wrong code to be refused, got %v", err)
+	}
+
+	token, err := VerifySecondFactor(pending, "123456")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, loggedIn, valid := CheckSession(token); !valid || loggedIn.Username != "editor" {
+		t.Errorf("expected the second factor to open the session, got %v for %+v", valid, loggedIn)
+	}
+
+	if _, _, valid := CheckSession(pending); valid {
+		t.Errorf("expected the token known before the second factor to open nothing")
+	}
+
+	if _, err := VerifySecondFactor(token, "123456"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected an open session to not be verified again, got %v", err)
+	}
+
+	if _, _, valid := CheckSession(token); valid {
+		t.Errorf("expected the session verified again to be ended")
+	}
+
+	pending = login(t, "editor")
+
+	for attempt := 1; attempt < maxAttempts; attempt++ {
+		if _, err := VerifySecondFactor(pending, "000000"); !errors.Is(err, user.ErrInvalidCode) {
+			t.Fatalf("expected the attempt %d to be refused, got %v", attempt, err)
+		}
+	}
+
+	if _, err := VerifySecondFactor(pending, "000000"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected the session to end after %d wrong codes, got %v", maxAttempts, err)
+	}
+
+	if _, err := VerifySecondFactor(pending, "123456"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected the password to be typed again, got %v", err)
+	}
+
+	pending = login(t, "editor")
+	*clock = clock.Add(PendingTimeout + time.Second)
+
+	if _, err := VerifySecondFactor(pending, "123456"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected the pending session to end after %v, got %v", PendingTimeout, err)
+	}
+
+	pending = login(t, "editor")
+
+	if _, err := VerifySecondFactor(pending, "recovery"); err != nil {
+		t.Errorf("expected a recovery code to open the session, got %v", err)
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	openTestStore(t)
+
+	// the passkey of the editor, who has a second factor as well
+	checkPasskey = func(rp webauthn.RelyingParty, response webauthn.AssertionResponse) (user.User, error) {
+		if response.Id == "editor-passkey" {
+			return testUsers[3], nil
+		}
+
+		return user.User{}, user.ErrPasskeyNotFound
+	}
+
+	response := webauthn.AssertionResponse{Id: "editor-passkey"}
+	token, err := AuthenticatePasskey(webauthn.RelyingParty{}, response, "", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, loggedIn, valid := CheckSession(token); !valid || loggedIn.Username != "editor" {
+		t.Errorf("expected the passkey to open the session without second factor, got %v for %+v", valid, loggedIn)
+	}
+
+	response.Id = "unknown"
+
+	if _, err := AuthenticatePasskey(webauthn.RelyingParty{}, response, "", ""); !errors.Is(err, user.ErrPasskeyNotFound) {
+		t.Errorf("expected an unknown passkey to open no session, got %v", err)
+	}
+}
+
+func TestDevice(t *testing.T) {
+	type data struct {
+		userAgent string
+		device    string
+	}
+
+	testData := []data{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36 Edg/140.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 18_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"Mozilla/5.0 (Linux; Android 15) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"curl/8.5.0", "curl"},
+		{"", "unknown device"},
+	}
+
+	for _, test := range testData {
+		if device := (Session{UserAgent: test.userAgent}).Device(); device != test.device {
+			t.Errorf("expected %q for %q, got %q", test.device, test.userAgent, device)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package authentication
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a login to the admin area, from a browser.
+type Session struct {
+	SessionId  int64
+	UserId     int64
+	Username   string
+	CreatedAt  int64
+	LastSeenAt int64
+	UserAgent  string
+	Ip         string
+	// Pending sessions wait for the second factor, they open nothing.
+	Pending        bool
+	FailedAttempts int
+}
+
+// Store keeps the sessions, it is used from every request at once.
+type Store interface {
+	// Create saves the session and returns the token of its cookie.
+	Create(session Session) (string, Session, error)
+	// Find returns the session of the token, or ErrSessionNotFound.
+	Find(token string) (Session, error)
+	// Touch records a request of the session at time.
+	Touch(sessionId int64, at int64) error
+	// Promote opens the pending session once the second factor is checked,
+	// it returns the new token of its cookie.
+	Promote(sessionId int64) (string, error)
+	// CountFailure records a wrong second factor and returns the count.
+	CountFailure(sessionId int64) (int, error)
+	// Delete ends the session, ErrSessionNotFound tells it had already ended.
+	Delete(sessionId int64) error
+	// DeleteExpired ends the sessions idle since idleBefore, and the ones
+	// created before createdBefore.
+	DeleteExpired(idleBefore int64, createdBefore int64) error
+	// List returns the sessions, the last seen first.
+	List() ([]Session, error)
+}
+
+// LastSeenHuman is the time of the last request of the session.
+func (session Session) LastSeenHuman() string {
+	return time.Unix(session.LastSeenAt, 0).UTC().Format("2006-01-02 15:04")
+}
+
+// Device sums up the user agent of the session as a browser and a system.
+func (session Session) Device() string {
+	agent := session.UserAgent
+	browser := ""
+	system := ""
+
+	for _, known := range [][2]string{{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"}} {
+		if strings.Contains(agent, known[0]) {
+			browser = known[1]
+			break
+		}
+	}
+
+	for _, known := range [][2]string{{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"}, {"Windows", "Windows"}, {"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"}} {
+		if strings.Contains(agent, known[0]) {
+			system = known[1]
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "" || system != "":
+		return browser + system
+	case agent != "":
+		return agent
+	default:
+		return "unknown device"
+	}
+}
+
+// sqliteStore keeps the sessions in the database, only the hashes of their
+// tokens are saved.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// NewSqliteStore returns the store of the sessions kept in the database.
+func NewSqliteStore(conn *sql.DB) Store {
+	return sqliteStore{db: conn}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (store sqliteStore) Create(session Session) (string, Session, error) {
+	token := rand.Text()
+
+	err := store.db.QueryRow(
+		"INSERT INTO session (token_hash, user_id, created_at, last_seen_at, user_agent, ip, pending) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING session_id",
+		hashToken(token), session.UserId, session.CreatedAt, session.LastSeenAt, session.UserAgent, session.Ip, session.Pending,
+	).Scan(&session.SessionId)
+
+	if err != nil {
+		return "", Session{}, err
+	}
+
+	return token, session, nil
+}
+
+const sessionColumns = "session.session_id, session.user_id, user.username, session.created_at, session.last_seen_at, session.user_agent, session.ip, session.pending, session.failed_attempts"
+
+func scanSession(row interface{ Scan(...any) error }) (Session, error) {
+	session := Session{}
+
+	err := row.Scan(&session.SessionId, &session.UserId, &session.Username, &session.CreatedAt, &session.LastSeenAt, &session.UserAgent, &session.Ip, &session.Pending, &session.FailedAttempts)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
+	}
+
+	return session, err
+}
+
+func (store sqliteStore) Find(token string) (Session, error) {
+	return scanSession(store.db.QueryRow(
+		"SELECT "+sessionColumns+" FROM session JOIN user ON user.user_id = session.user_id WHERE session.token_hash = ?",
+		hashToken(token),
+	))
+}
+
+func (store sqliteStore) Touch(sessionId int64, at int64) error {
+	_, err := store.db.Exec("UPDATE session SET last_seen_at = ? WHERE session_id = ?", at, sessionId)
+
+	return err
+}
+
+// Promote changes the token as well, the one known before the second factor
+// opens nothing.
+func (store sqliteStore) Promote(sessionId int64) (string, error) {
+	token := rand.Text()
+
+	result, err := store.db.Exec("UPDATE session SET token_hash = ?, pending = 0 WHERE session_id = ? AND pending = 1", hashToken(token), sessionId)
+
+	if err != nil {
+		return "", err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return "", ErrSessionNotFound
+	}
+
+	return token, nil
+}
+
+func (store sqliteStore) CountFailure(sessionId int64) (int, error) {
+	var count int
+
+	err := store.db.QueryRow("UPDATE session SET failed_attempts = failed_attempts + 1 WHERE session_id = ? RETURNING failed_attempts", sessionId).Scan(&count)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrSessionNotFound
+	}
+
+	return count, err
+}
+
+func (store sqliteStore) Delete(sessionId int64) error {
+	result, err := store.db.Exec("DELETE FROM session WHERE session_id = ?", sessionId)
+
+	if err != nil {
+		return err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (store sqliteStore) DeleteExpired(idleBefore int64, createdBefore int64) error {
+	_, err := store.db.Exec("DELETE FROM session WHERE last_seen_at < ? OR created_at < ?", idleBefore, createdBefore)
+
+	return err
+}
+
+func (store sqliteStore) List() ([]Session, error) {
+	rows, err := store.db.Query("SELECT " + sessionColumns + " FROM session JOIN user ON user.user_id = session.user_id ORDER BY session.last_seen_at DESC, session.session_id DESC")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sessions []Session
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
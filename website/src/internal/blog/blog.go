@@ -4,19 +4,15 @@ import (
 	"errors"
 	"log"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"database/sql"
 
-	_ "modernc.org/sqlite"
-
-	"github.com/gomarkdown/markdown/html"
-	"github.com/gomarkdown/markdown/parser"
+	"valette.software/internal/database"
 )
 
-var htmlRenderer *html.Renderer
-var mdExtensions parser.Extensions
 var db *sql.DB
 var timezoneCet *time.Location
 var monthsFr = []string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"}
@@ -25,15 +21,7 @@ var monthsEn = []string{"January", "February", "March", "April", "May", "June",
 func Init() {
 	var err error
 
-	db, err = sql.Open("sqlite", "/var/lib/valettesoftware/blog.db")
-
-	if err != nil {
-		log.Fatal("couldn't open the blog's database:", err)
-	}
-
-	mdExtensions = parser.CommonExtensions
-
-	htmlRenderer = html.NewRenderer(html.RendererOptions{})
+	db = database.Get()
 
 	timezoneCet, err = time.LoadLocation("Europe/Zurich")
 
@@ -42,16 +30,44 @@ func Init() {
 	}
 }
 
-func AddPost(newPost NewPost) (RenderedPost, error) {
-	slug := makeSlug(newPost.Title)
+// AddPost stores a new post and its first revision, editor is the name of
+// the person saving it.
+func AddPost(newPost NewPost, editor string) (RenderedPost, error) {
+	slug := postSlug(newPost.Slug, newPost.Title)
 
 	if newPost.Timestamp == 0 {
 		newPost.Timestamp = time.Now().Unix()
 	}
 
-	result, err := db.Exec(
-		"INSERT INTO post(title, language, author, timestamp, slug, summary, content) VALUES(?, ?, ?, ?, ?, ?, ?)",
-		newPost.Title, newPost.Language, newPost.Author, newPost.Timestamp, slug, newPost.Summary, newPost.Content,
+	status, publishAt, err := normalizeStatus(newPost.Status, newPost.PublishAt)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	newPost.Status = status
+	newPost.PublishAt = publishAt
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	defer tx.Rollback()
+
+	err = claimSlug(tx, 0, newPost.Language, slug)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	renderedPost := newPost.ToRenderedPost(0, slug)
+
+	result, err := tx.Exec(
+		"INSERT INTO post(title, language, author, timestamp, slug, summary, content, status, publish_at, html, toc, word_count, html_version, user_id, skip_html) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?)",
+		newPost.Title, newPost.Language, newPost.Author, newPost.Timestamp, slug, newPost.Summary, newPost.Content, newPost.Status, newPost.PublishAt,
+		string(renderedPost.Html), renderedPost.tocJson(), renderedPost.WordCount, rendererVersion, newPost.UserId, newPost.SkipHtml,
 	)
 
 	if err != nil {
@@ -64,44 +80,276 @@ func AddPost(newPost NewPost) (RenderedPost, error) {
 		return RenderedPost{}, err
 	}
 
-	renderedPost := newPost.ToRenderedPost(newId, slug)
+	renderedPost.ArticleId = newId
+
+	renderedPost.Tags, err = setPostTags(tx, newId, newPost.Language, newPost.Tags)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	_, err = setPostSeries(tx, newId, newPost.Language, newPost.Series)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	err = setTranslation(tx, newId, newPost.Language, newPost.Translations)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	err = saveRevision(tx, renderedPost.Post, editor)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	notifyChange(newId)
+
+	renderedPost.Series, err = GetPostSeries(newId, true)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	renderedPost.Translations, err = ListTranslations(newId, true)
 
-	return renderedPost, nil
+	return renderedPost, err
 }
 
-func UpdatePost(post RenderedPost) (RenderedPost, error) {
-	_, err := db.Exec(
-		"UPDATE post SET title = ?, language = ?, author = ?, timestamp = ?, slug = ?, summary = ?, content = ? WHERE post_id = ?",
-		post.Title, post.Language, post.Author, post.Timestamp, post.Slug, post.Summary, post.Content, post.ArticleId,
+// UpdatePost overwrites the post and records the new state as a revision,
+// editor is the name of the person saving it.
+func UpdatePost(post RenderedPost, editor string) (RenderedPost, error) {
+	status, publishAt, err := normalizeStatus(post.Status, post.PublishAt)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	post.Status = status
+	post.PublishAt = publishAt
+
+	post.Slug = postSlug(post.Slug, post.Title)
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	defer tx.Rollback()
+
+	err = moveSlug(tx, post.ArticleId, post.Language, post.Slug)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	// the HTML stays skipped once the post was created by a contributor,
+	// whoever saves it
+	err = tx.QueryRow("SELECT skip_html FROM post WHERE post_id = ?", post.ArticleId).Scan(&post.SkipHtml)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return RenderedPost{}, ErrNotFound
+	} else if err != nil {
+		return RenderedPost{}, err
+	}
+
+	post.CalculateHtmlContent()
+
+	result, err := tx.Exec(
+		"UPDATE post SET title = ?, language = ?, author = ?, timestamp = ?, slug = ?, summary = ?, content = ?, status = ?, publish_at = ?, html = ?, toc = ?, word_count = ?, html_version = ? WHERE post_id = ?",
+		post.Title, post.Language, post.Author, post.Timestamp, post.Slug, post.Summary, post.Content, post.Status, post.PublishAt,
+		string(post.Html), post.tocJson(), post.WordCount, rendererVersion, post.ArticleId,
 	)
 
 	if err != nil {
 		return RenderedPost{}, err
 	}
 
+	if updated, err := result.RowsAffected(); err != nil {
+		return RenderedPost{}, err
+	} else if updated == 0 {
+		return RenderedPost{}, ErrNotFound
+	}
+
+	post.Tags, err = setPostTags(tx, post.ArticleId, post.Language, post.Tags)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	_, err = setPostSeries(tx, post.ArticleId, post.Language, post.Series)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	err = setTranslation(tx, post.ArticleId, post.Language, post.Translations)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	err = saveRevision(tx, post.Post, editor)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	notifyChange(post.ArticleId)
+
+	post.Series, err = GetPostSeries(post.ArticleId, true)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	post.Translations, err = ListTranslations(post.ArticleId, true)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
 	post.CalculateDates()
-	post.CalculateHtmlContent()
 
 	return post, nil
 }
 
-func ListPosts(lang string) ([]RenderedPost, error) {
+// PublishPost makes the post visible now, unless it was already published
+// in the past, in which case its original publication time is kept.
+func PublishPost(id int64) (RenderedPost, error) {
+	now := time.Now().Unix()
+
+	_, err := db.Exec(
+		"UPDATE post SET status = ?, publish_at = CASE WHEN publish_at = 0 OR publish_at > ? THEN ? ELSE publish_at END WHERE post_id = ?",
+		StatusPublished, now, now, id,
+	)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	notifyChange(id)
+
+	return GetPostById(id)
+}
+
+// UnpublishPost turns the post back into a draft.
+func UnpublishPost(id int64) (RenderedPost, error) {
+	_, err := db.Exec("UPDATE post SET status = ? WHERE post_id = ?", StatusDraft, id)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	notifyChange(id)
+
+	return GetPostById(id)
+}
+
+// ListPosts returns the summaries of the posts written in lang, or in any
+// language if lang is empty. Unless withHidden is set, only the posts visible
+// to the public at the time of the call are listed.
+func ListPosts(lang string, withHidden bool) ([]RenderedPost, error) {
+	return listPosts(postFilter{language: lang, withHidden: withHidden})
+}
+
+// ListLatestPosts returns the limit most recent posts of lang visible to
+// the public, with their content rendered, for the feeds.
+func ListLatestPosts(lang string, limit int) ([]RenderedPost, error) {
+	return listPosts(postFilter{language: lang, withContent: true, limit: limit})
+}
+
+// ListAllPosts returns every post with its content, hidden or not, for the
+// exports.
+func ListAllPosts() ([]RenderedPost, error) {
+	return listPosts(postFilter{withHidden: true, withContent: true})
+}
+
+// ListPublicPosts returns the summaries of the posts of lang visible to the
+// public, with their visible translations, for the sitemap.
+func ListPublicPosts(lang string) ([]RenderedPost, error) {
+	return listPosts(postFilter{language: lang, withTranslations: true})
+}
+
+// postFilter restricts the posts returned by listPosts, its zero value
+// matches the visible posts of every language.
+type postFilter struct {
+	language         string
+	tagId            int64
+	seriesId         int64
+	withHidden       bool
+	withContent      bool
+	withTranslations bool
+	limit            int
+}
+
+func listPosts(filter postFilter) ([]RenderedPost, error) {
 	currentPost := RenderedPost{}
 	allPosts := []RenderedPost{}
-	var err error
-	var results *sql.Rows
 
-	if lang != "" {
-		results, err = db.Query("SELECT post_id, title, author, language, timestamp, summary, slug FROM post WHERE language = ? ORDER BY timestamp DESC", lang)
+	query := "SELECT post_id, title, author, language, timestamp, summary, slug, status, publish_at, CASE WHEN ? THEN content ELSE '' END, CASE WHEN ? THEN html ELSE '' END, toc, word_count, html_version, COALESCE(user_id, 0), skip_html, " + lastModifiedColumn + " FROM post WHERE 1 = 1"
+	args := []any{filter.withContent, filter.withContent}
+
+	if filter.language != "" {
+		query += " AND language = ?"
+		args = append(args, filter.language)
+	}
+
+	if filter.tagId != 0 {
+		query += " AND post_id IN (SELECT post_id FROM post_tag WHERE tag_id = ?)"
+		args = append(args, filter.tagId)
+	}
+
+	if filter.seriesId != 0 {
+		query += " AND post_id IN (SELECT post_id FROM post_series WHERE series_id = ?)"
+		args = append(args, filter.seriesId)
+	}
+
+	if !filter.withHidden {
+		query += " AND " + visibleCondition
+		args = append(args, time.Now().Unix())
+	}
+
+	if filter.seriesId != 0 {
+		// the parts are read in order, the first one first
+		query += " ORDER BY (SELECT position FROM post_series WHERE post_series.post_id = post.post_id), timestamp"
 	} else {
-		results, err = db.Query("SELECT post_id, title, author, language, timestamp, summary, slug FROM post ORDER BY timestamp DESC")
+		query += " ORDER BY timestamp DESC"
+	}
+
+	if filter.limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.limit)
 	}
 
+	results, err := db.Query(query, args...)
+
 	if err != nil {
 		return []RenderedPost{}, err
 	}
 
+	defer results.Close()
+
 	for results.Next() {
+		var html, toc string
+		var htmlVersion int
+
 		err := results.Scan(
 			&currentPost.ArticleId,
 			&currentPost.Title,
@@ -110,6 +358,16 @@ func ListPosts(lang string) ([]RenderedPost, error) {
 			&currentPost.Timestamp,
 			&currentPost.Summary,
 			&currentPost.Slug,
+			&currentPost.Status,
+			&currentPost.PublishAt,
+			&currentPost.Content,
+			&html,
+			&toc,
+			&currentPost.WordCount,
+			&htmlVersion,
+			&currentPost.UserId,
+			&currentPost.SkipHtml,
+			&currentPost.LastModified,
 		)
 
 		if err != nil {
@@ -118,18 +376,62 @@ func ListPosts(lang string) ([]RenderedPost, error) {
 
 		currentPost.CalculateDates()
 
+		if filter.withContent {
+			currentPost.useStoredHtml(html, toc, htmlVersion)
+		}
+
 		allPosts = append(allPosts, currentPost)
 	}
 
+	if err := results.Err(); err != nil {
+		return []RenderedPost{}, err
+	}
+
+	err = loadTags(allPosts)
+
+	if err != nil {
+		return []RenderedPost{}, err
+	}
+
+	err = loadSeries(allPosts)
+
+	if err != nil {
+		return []RenderedPost{}, err
+	}
+
+	if filter.withTranslations {
+		for i := range allPosts {
+			allPosts[i].Translations, err = ListTranslations(allPosts[i].ArticleId, filter.withHidden)
+
+			if err != nil {
+				return []RenderedPost{}, err
+			}
+		}
+	}
+
 	return allPosts, nil
 }
 
-func GetPostBySlug(slug string) (RenderedPost, error) {
+// GetPostBySlug finds a post by its slug, preferably written in lang, then
+// in any language. Unless withHidden is set, posts that aren't visible to the
+// public yet are reported as not found.
+func GetPostBySlug(lang string, slug string, withHidden bool) (RenderedPost, error) {
 	post := RenderedPost{}
 
-	result := db.QueryRow("SELECT title, author, timestamp, summary, content FROM post WHERE slug = ?", slug)
+	query := "SELECT post_id, language, title, author, timestamp, summary, content, status, publish_at, html, toc, word_count, html_version, COALESCE(user_id, 0), skip_html FROM post WHERE slug = ?"
+	args := []any{slug}
+
+	if !withHidden {
+		query += " AND " + visibleCondition
+		args = append(args, time.Now().Unix())
+	}
+
+	result := db.QueryRow(query+" ORDER BY language = ? DESC LIMIT 1", append(args, lang)...)
 
-	err := result.Scan(&post.Title, &post.Author, &post.Timestamp, &post.Summary, &post.Content)
+	var html, toc string
+	var htmlVersion int
+
+	err := result.Scan(&post.ArticleId, &post.Language, &post.Title, &post.Author, &post.Timestamp, &post.Summary, &post.Content, &post.Status, &post.PublishAt, &html, &toc, &post.WordCount, &htmlVersion, &post.UserId, &post.SkipHtml)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return RenderedPost{}, ErrNotFound
@@ -138,8 +440,28 @@ func GetPostBySlug(slug string) (RenderedPost, error) {
 		return RenderedPost{}, err
 	}
 
+	post.Slug = slug
+
+	post.Tags, err = ListPostTags(post.ArticleId, post.Language)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	post.Series, err = GetPostSeries(post.ArticleId, withHidden)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	post.Translations, err = ListTranslations(post.ArticleId, withHidden)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
 	post.CalculateDates()
-	post.CalculateHtmlContent()
+	post.useStoredHtml(html, toc, htmlVersion)
 
 	return post, err
 }
@@ -147,9 +469,12 @@ func GetPostBySlug(slug string) (RenderedPost, error) {
 func GetPostById(id int64) (RenderedPost, error) {
 	post := RenderedPost{}
 
-	result := db.QueryRow("SELECT post_id, language, slug, title, author, timestamp, summary, content FROM post WHERE post_id = ?", id)
+	result := db.QueryRow("SELECT post_id, language, slug, title, author, timestamp, summary, content, status, publish_at, html, toc, word_count, html_version, COALESCE(user_id, 0), skip_html FROM post WHERE post_id = ?", id)
+
+	var html, toc string
+	var htmlVersion int
 
-	err := result.Scan(&post.ArticleId, &post.Language, &post.Slug, &post.Title, &post.Author, &post.Timestamp, &post.Summary, &post.Content)
+	err := result.Scan(&post.ArticleId, &post.Language, &post.Slug, &post.Title, &post.Author, &post.Timestamp, &post.Summary, &post.Content, &post.Status, &post.PublishAt, &html, &toc, &post.WordCount, &htmlVersion, &post.UserId, &post.SkipHtml)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return RenderedPost{}, ErrNotFound
@@ -158,16 +483,106 @@ func GetPostById(id int64) (RenderedPost, error) {
 		return RenderedPost{}, err
 	}
 
+	post.Tags, err = ListPostTags(post.ArticleId, post.Language)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	post.Series, err = GetPostSeries(post.ArticleId, true)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	post.Translations, err = ListTranslations(post.ArticleId, true)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
 	post.CalculateDates()
-	post.CalculateHtmlContent()
+	post.useStoredHtml(html, toc, htmlVersion)
 
 	return post, err
 }
 
+// RenderPosts renders the content of the posts again, after the
+// configuration of the renderer or the images of the media library changed.
+// If onlyStale is set, only the posts rendered by an older version of the
+// renderer are. It returns the number of posts rendered.
+func RenderPosts(onlyStale bool) (int, error) {
+	query := "SELECT post_id, content, skip_html FROM post"
+
+	if onlyStale {
+		query += " WHERE html_version != " + strconv.Itoa(rendererVersion)
+	}
+
+	results, err := db.Query(query)
+
+	if err != nil {
+		return 0, err
+	}
+
+	posts := []RenderedPost{}
+
+	for results.Next() {
+		post := RenderedPost{}
+
+		if err := results.Scan(&post.ArticleId, &post.Content, &post.SkipHtml); err != nil {
+			results.Close()
+			return 0, err
+		}
+
+		posts = append(posts, post)
+	}
+
+	results.Close()
+
+	if err := results.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, post := range posts {
+		post.CalculateHtmlContent()
+
+		_, err := db.Exec(
+			"UPDATE post SET html = ?, toc = ?, word_count = ?, html_version = ? WHERE post_id = ?",
+			string(post.Html), post.tocJson(), post.WordCount, rendererVersion, post.ArticleId,
+		)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(posts), nil
+}
+
 func DeletePostById(id int64) error {
 	_, err := db.Exec("DELETE FROM post WHERE post_id = ?", id)
 
-	return err
+	if err == nil {
+		err = removeEmptySeries(db)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	notifyChange(id)
+
+	return nil
+}
+
+// postSlug is the slug typed by the author made safe for the URLs and the
+// exported file names, or the one of the title when none is typed.
+func postSlug(typed string, title string) string {
+	if slug := makeSlug(typed); slug != "" {
+		return slug
+	}
+
+	return makeSlug(title)
 }
 
 func makeSlug(text string) string {
@@ -183,3 +598,28 @@ func makeSlug(text string) string {
 
 	return slug
 }
+
+func normalizeStatus(status string, publishAt int64) (string, int64, error) {
+	switch status {
+	case "":
+		return StatusDraft, publishAt, nil
+	case StatusPublished:
+		if publishAt == 0 {
+			publishAt = time.Now().Unix()
+		}
+
+		return status, publishAt, nil
+	case StatusScheduled:
+		// a post scheduled without date, or in the past, would be published
+		// at once
+		if publishAt <= time.Now().Unix() {
+			return "", 0, ErrScheduleInPast
+		}
+
+		return status, publishAt, nil
+	case StatusDraft, StatusArchived:
+		return status, publishAt, nil
+	}
+
+	return "", 0, ErrInvalidStatus
+}
@@ -1,6 +1,19 @@
 package blog
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"valette.software/internal/database/databasetest"
+)
+
+// openTestDatabase points the package to a freshly migrated database.
+func openTestDatabase(t *testing.T) {
+	conn := databasetest.Open(t)
+
+	Init()
+	db = conn
+}
 
 func TestMakeSlug(t *testing.T) {
 	type data struct {
@@ -26,3 +39,174 @@ func TestMakeSlug(t *testing.T) {
 		}
 	}
 }
+
+func TestPostSlug(t *testing.T) {
+	type data struct {
+		typed string
+		slug  string
+	}
+
+	testData := []data{
+		{"", "the-title"},
+		{"my-post", "my-post"},
+		{"My Post", "my-post"},
+		{"../../etc/x", "00etc0x"},
+		{"a/b", "a0b"},
+		{"?!", "the-title"},
+	}
+
+	for _, test := range testData {
+		if slug := postSlug(test.typed, "The title"); slug != test.slug {
+			t.Errorf("expected \"%s\" to become \"%s\", got \"%s\"", test.typed, test.slug, slug)
+		}
+	}
+}
+
+func TestNormalizeStatus(t *testing.T) {
+	type data struct {
+		status    string
+		publishAt int64
+		expected  string
+		err       error
+	}
+
+	testData := []data{
+		{"", 0, StatusDraft, nil},
+		{StatusDraft, 0, StatusDraft, nil},
+		{StatusScheduled, 1 << 40, StatusScheduled, nil},
+		{StatusScheduled, 0, "", ErrScheduleInPast},
+		{StatusScheduled, 10, "", ErrScheduleInPast},
+		{StatusArchived, 10, StatusArchived, nil},
+	}
+
+	for _, test := range testData {
+		status, publishAt, err := normalizeStatus(test.status, test.publishAt)
+
+		if test.err != nil {
+			if err != test.err {
+				t.Errorf("expected \"%s\" at %d to fail with %s, got %s", test.status, test.publishAt, test.err, err)
+			}
+
+			continue
+		}
+
+		if status != test.expected || publishAt != test.publishAt || err != nil {
+			t.Errorf("expected \"%s\" to become \"%s\" at %d, got \"%s\" at %d, error: %s", test.status, test.expected, test.publishAt, status, publishAt, err)
+		}
+	}
+
+	_, publishAt, _ := normalizeStatus(StatusPublished, 0)
+
+	if publishAt == 0 {
+		t.Error("expected a published post without publication time to be published now")
+	}
+
+	_, _, err := normalizeStatus("online", 0)
+
+	if err != ErrInvalidStatus {
+		t.Errorf("expected ErrInvalidStatus, got %s", err)
+	}
+}
+
+func TestCurrentStatus(t *testing.T) {
+	type data struct {
+		post     Post
+		visible  bool
+		expected string
+	}
+
+	testData := []data{
+		{Post{Status: StatusDraft}, false, StatusDraft},
+		{Post{Status: StatusPublished, PublishAt: 10}, true, StatusPublished},
+		{Post{Status: StatusScheduled, PublishAt: 10}, true, StatusPublished},
+		{Post{Status: StatusScheduled, PublishAt: 1 << 40}, false, StatusScheduled},
+		{Post{Status: StatusArchived, PublishAt: 10}, false, StatusArchived},
+	}
+
+	for _, test := range testData {
+		if test.post.IsVisible() != test.visible || test.post.CurrentStatus() != test.expected {
+			t.Errorf("expected %+v to be visible: %t with status \"%s\", got %t and \"%s\"", test.post, test.visible, test.expected, test.post.IsVisible(), test.post.CurrentStatus())
+		}
+	}
+}
+
+func TestStoredHtml(t *testing.T) {
+	openTestDatabase(t)
+
+	post, err := AddPost(NewPost{Title: "Bonjour", Language: "fr", Content: "**gras**"}, "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stored HTML is served as is
+	_, err = db.Exec("UPDATE post SET html = '<p>stored</p>' WHERE post_id = ?", post.ArticleId)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found, _ := GetPostById(post.ArticleId); found.Html != "<p>stored</p>" {
+		t.Errorf("expected the stored HTML, got %s", found.Html)
+	}
+
+	// the HTML of an older renderer is rendered again
+	_, err = db.Exec("UPDATE post SET html_version = 0 WHERE post_id = ?", post.ArticleId)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found, _ := GetPostById(post.ArticleId); found.Html != "<p><strong>gras</strong></p>\n" {
+		t.Errorf("expected the content to be rendered again, got %s", found.Html)
+	}
+
+	if count, err := RenderPosts(false); count != 1 || err != nil {
+		t.Errorf("expected one post to be rendered, got %d (%v)", count, err)
+	}
+
+	var html string
+	var version int
+
+	err = db.QueryRow("SELECT html, html_version FROM post WHERE post_id = ?", post.ArticleId).Scan(&html, &version)
+
+	if err != nil || html != "<p><strong>gras</strong></p>\n" || version != rendererVersion {
+		t.Errorf("expected the rendered HTML to be stored, got %s version %d (%v)", html, version, err)
+	}
+}
+
+func TestSkippedHtml(t *testing.T) {
+	openTestDatabase(t)
+
+	content := "<script>alert(1)</script>\n\nTexte"
+	post, err := AddPost(NewPost{Title: "Piège", Language: "fr", Content: content, SkipHtml: true}, "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(post.Html), "<script>") {
+		t.Errorf("expected the HTML of the post to be skipped, got %s", post.Html)
+	}
+
+	// whoever saves it, and however it is rendered again
+	post.SkipHtml = false
+
+	if _, err := UpdatePost(post, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RenderPosts(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if found, _ := GetPostById(post.ArticleId); !found.SkipHtml || strings.Contains(string(found.Html), "<script>") {
+		t.Errorf("expected the HTML of the post to stay skipped, got %s", found.Html)
+	}
+
+	trusted, err := AddPost(NewPost{Title: "Confiance", Language: "fr", Content: content}, "test")
+
+	if err != nil || !strings.Contains(string(trusted.Html), "<script>") {
+		t.Errorf("expected the HTML of the other posts to be kept, got %s (%v)", trusted.Html, err)
+	}
+}
@@ -0,0 +1,43 @@
+package blog
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+var changeListeners []func(postId int64)
+var changeMutex sync.Mutex
+
+// OnChange registers listener to be called with the ID of the post every time
+// a post is created, modified, published, unpublished or deleted.
+func OnChange(listener func(postId int64)) {
+	changeMutex.Lock()
+	defer changeMutex.Unlock()
+
+	changeListeners = append(changeListeners, listener)
+}
+
+func notifyChange(postId int64) {
+	changeMutex.Lock()
+	listeners := changeListeners
+	changeMutex.Unlock()
+
+	for _, listener := range listeners {
+		listener(postId)
+	}
+}
+
+// NextPublication returns the unix time at which the next scheduled post
+// becomes visible, or 0 if no post is waiting for its publication. Nothing
+// is notified when that time comes, the caches must expire by themselves.
+func NextPublication() (int64, error) {
+	var next sql.NullInt64
+
+	err := db.QueryRow(
+		"SELECT MIN(publish_at) FROM post WHERE status IN ('published', 'scheduled') AND publish_at > ?",
+		time.Now().Unix(),
+	).Scan(&next)
+
+	return next.Int64, err
+}
@@ -0,0 +1,71 @@
+package blog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChangeNotification(t *testing.T) {
+	openTestDatabase(t)
+
+	changes := []int64{}
+	OnChange(func(postId int64) { changes = append(changes, postId) })
+
+	post, err := AddPost(NewPost{Title: "Bonjour", Language: "fr", Status: StatusPublished}, "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := UnpublishPost(post.ArticleId); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeletePostById(post.ArticleId); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 3 || changes[0] != post.ArticleId || changes[2] != post.ArticleId {
+		t.Errorf("expected 3 notifications of the post %d, got %v", post.ArticleId, changes)
+	}
+}
+
+func TestNextPublication(t *testing.T) {
+	openTestDatabase(t)
+
+	next, err := NextPublication()
+
+	if err != nil || next != 0 {
+		t.Errorf("expected no publication to wait for, got %d (%v)", next, err)
+	}
+
+	later := time.Now().Add(time.Hour).Unix()
+
+	_, err = AddPost(NewPost{Title: "Plus tard", Language: "fr", Status: StatusScheduled, PublishAt: later}, "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = AddPost(NewPost{Title: "Maintenant", Language: "fr", Status: StatusPublished}, "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err = NextPublication()
+
+	if err != nil || next != later {
+		t.Errorf("expected the scheduled post at %d, got %d (%v)", later, next, err)
+	}
+
+	posts, err := ListPublicPosts("fr")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posts) != 1 || posts[0].Title != "Maintenant" || posts[0].LastModified == 0 {
+		t.Errorf("expected only the published post with its modification time, got %+v", posts)
+	}
+}
@@ -0,0 +1,127 @@
+package blog
+
+import "strings"
+
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// maxDiffCells bounds the LCS table of the changed lines, 16 MB of int32.
+// Beyond it the lines before are all deleted and the lines after inserted.
+const maxDiffCells = 4 << 20
+
+type DiffLine struct {
+	Kind string
+	Text string
+}
+
+// DiffLines computes the line diff turning before into after, based on the
+// longest common subsequence of their lines.
+func DiffLines(before string, after string) []DiffLine {
+	a := splitLines(before)
+	b := splitLines(after)
+
+	// the common head and tail don't need to go through the LCS table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	diff := make([]DiffLine, 0, len(a)+len(b))
+
+	for _, line := range a[:prefix] {
+		diff = append(diff, DiffLine{Kind: DiffEqual, Text: line})
+	}
+
+	diff = append(diff, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, DiffLine{Kind: DiffEqual, Text: line})
+	}
+
+	return diff
+}
+
+func diffMiddle(a []string, b []string) []DiffLine {
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		return replaceLines(a, b)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := []DiffLine{}
+	i, j := 0, 0
+
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{Kind: DiffEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Kind: DiffDelete, Text: a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Kind: DiffInsert, Text: b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{Kind: DiffDelete, Text: a[i]})
+	}
+
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{Kind: DiffInsert, Text: b[j]})
+	}
+
+	return diff
+}
+
+// replaceLines is the diff deleting every line of a and inserting every line
+// of b, for the changes too large to be compared line by line.
+func replaceLines(a []string, b []string) []DiffLine {
+	diff := make([]DiffLine, 0, len(a)+len(b))
+
+	for _, line := range a {
+		diff = append(diff, DiffLine{Kind: DiffDelete, Text: line})
+	}
+
+	for _, line := range b {
+		diff = append(diff, DiffLine{Kind: DiffInsert, Text: line})
+	}
+
+	return diff
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
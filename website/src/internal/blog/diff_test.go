@@ -0,0 +1,71 @@
+package blog
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func formatDiff(diff []DiffLine) string {
+	marks := map[string]string{DiffEqual: " ", DiffInsert: "+", DiffDelete: "-"}
+	lines := []string{}
+
+	for _, line := range diff {
+		lines = append(lines, marks[line.Kind]+line.Text)
+	}
+
+	return strings.Join(lines, "|")
+}
+
+func TestDiffLines(t *testing.T) {
+	type data struct {
+		before string
+		after  string
+		output string
+	}
+
+	testData := []data{
+		{"", "", ""},
+		{"a\nb", "a\nb", " a| b"},
+		{"", "a", "+a"},
+		{"a", "", "-a"},
+		{"a\nb\nc", "a\nc", " a|-b| c"},
+		{"a\nc", "a\nb\nc", " a|+b| c"},
+		{"a\nb\nc", "a\nB\nc", " a|-b|+B| c"},
+		{"x\na\ny", "a\nz", "-x| a|-y|+z"},
+		{"a\r\nb\r\n", "a\nb", " a| b"},
+	}
+
+	for _, test := range testData {
+		result := formatDiff(DiffLines(test.before, test.after))
+
+		if result != test.output {
+			t.Errorf("expected the diff of %q and %q to be \"%s\", got \"%s\"", test.before, test.after, test.output, result)
+		}
+	}
+}
+
+func TestDiffLinesTooLarge(t *testing.T) {
+	before := []string{"head"}
+	after := []string{"head"}
+
+	for i := range 3000 {
+		before = append(before, "before "+strconv.Itoa(i))
+		after = append(after, "after "+strconv.Itoa(i))
+	}
+
+	diff := DiffLines(strings.Join(append(before, "tail"), "\n"), strings.Join(append(after, "tail"), "\n"))
+	counts := map[string]int{}
+
+	for _, line := range diff {
+		counts[line.Kind]++
+	}
+
+	if counts[DiffEqual] != 2 || counts[DiffDelete] != 3000 || counts[DiffInsert] != 3000 {
+		t.Errorf("expected the changed lines to be replaced around the common ones, got %v", counts)
+	}
+
+	if diff[1] != (DiffLine{Kind: DiffDelete, Text: "before 0"}) || diff[3001] != (DiffLine{Kind: DiffInsert, Text: "after 0"}) {
+		t.Errorf("expected the lines before to be deleted then the lines after inserted, got %v and %v", diff[1], diff[3001])
+	}
+}
@@ -3,3 +3,11 @@ package blog
 import "errors"
 
 var ErrNotFound = errors.New("no article found")
+var ErrInvalidStatus = errors.New("unknown post status")
+var ErrScheduleInPast = errors.New("a scheduled post needs a publication time in the future")
+var ErrTagTaken = errors.New("another tag already has this name")
+var ErrTagNameEmpty = errors.New("a tag needs a name in one language at least")
+var ErrTranslationLanguage = errors.New("a translation must be written in another language")
+var ErrTranslationTaken = errors.New("the post already has a translation in this language")
+var ErrSlugEmpty = errors.New("the slug must not be empty")
+var ErrSlugTaken = errors.New("another post in this language already uses this slug")
@@ -0,0 +1,66 @@
+package blog
+
+import (
+	"html"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// highlightStyle is the color theme of the code blocks.
+const highlightStyle = "github"
+
+// highlightFormatter writes the tokens with CSS classes, the colors come from
+// the stylesheet written by WriteHighlightCss.
+var highlightFormatter = chromahtml.New(chromahtml.WithClasses(true), chromahtml.PreventSurroundingPre(true))
+
+// renderCodeBlock highlights the fenced code blocks whose language is known.
+// Mermaid diagrams are drawn in the browser and the unknown languages are
+// left to the default renderer, which escapes them.
+func renderCodeBlock(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	block, ok := node.(*ast.CodeBlock)
+
+	if !ok {
+		return ast.GoToNext, false
+	}
+
+	language, _, _ := strings.Cut(strings.TrimSpace(string(block.Info)), " ")
+
+	if language == "" || language == "mermaid" {
+		return ast.GoToNext, false
+	}
+
+	lexer := lexers.Get(language)
+
+	if lexer == nil {
+		return ast.GoToNext, false
+	}
+
+	tokens, err := chroma.Coalesce(lexer).Tokenise(nil, string(block.Literal))
+
+	if err != nil {
+		return ast.GoToNext, false
+	}
+
+	highlighted := strings.Builder{}
+
+	if err := highlightFormatter.Format(&highlighted, styles.Get(highlightStyle), tokens); err != nil {
+		return ast.GoToNext, false
+	}
+
+	io.WriteString(w, `<pre><code class="language-`+html.EscapeString(language)+` chroma">`)
+	io.WriteString(w, highlighted.String())
+	io.WriteString(w, "</code></pre>\n")
+
+	return ast.GoToNext, true
+}
+
+// WriteHighlightCss writes the stylesheet coloring the highlighted code.
+func WriteHighlightCss(w io.Writer) error {
+	return highlightFormatter.WriteCSS(w, styles.Get(highlightStyle))
+}
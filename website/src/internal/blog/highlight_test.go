@@ -0,0 +1,41 @@
+package blog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderCodeBlock(t *testing.T) {
+	type data struct {
+		content  string
+		expected string
+	}
+
+	testData := []data{
+		{"```go\nfunc main() {}\n```", `<pre><code class="language-go chroma"><span class="kd">func</span>`},
+		{"```nosuchlanguage\n<b>bold</b>\n```", `<pre><code class="language-nosuchlanguage">&lt;b&gt;bold&lt;/b&gt;`},
+		{"```mermaid\ngraph TD\n```", `<pre><code class="language-mermaid">graph TD`},
+		{"    indented <code>\n", `<pre><code>indented &lt;code&gt;`},
+	}
+
+	for _, test := range testData {
+		post := RenderedPost{Post: Post{Content: test.content}}
+		post.CalculateHtmlContent()
+
+		if !strings.Contains(string(post.Html), test.expected) {
+			t.Errorf("expected %q to render %s, got %s", test.content, test.expected, post.Html)
+		}
+	}
+}
+
+func TestWriteHighlightCss(t *testing.T) {
+	css := strings.Builder{}
+
+	if err := WriteHighlightCss(&css); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(css.String(), ".chroma .kd") {
+		t.Errorf("expected the stylesheet to color the keywords, got %s", css.String())
+	}
+}
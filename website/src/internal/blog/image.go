@@ -0,0 +1,80 @@
+package blog
+
+import (
+	"html"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+
+	"valette.software/internal/media"
+)
+
+// imageSizes tells the browsers how wide the images of a post are displayed,
+// the content of the article page is at most 64rem wide.
+const imageSizes = "(max-width: 64rem) 100vw, 64rem"
+
+// findImage looks up the uploaded images, it is replaced in the tests.
+var findImage = media.FindByUrl
+
+// renderImage writes the images of the media library with their dimensions
+// and their resized variants, letting the browsers download the smallest
+// one that fits. The other images are left to the default renderer.
+func renderImage(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	image, ok := node.(*ast.Image)
+
+	if !ok || !strings.HasPrefix(string(image.Destination), "/uploads/") {
+		return ast.GoToNext, false
+	}
+
+	// the alt text was written when entering the node
+	if !entering {
+		return ast.GoToNext, true
+	}
+
+	src := string(image.Destination)
+	attributes := []string{`src="` + html.EscapeString(src) + `"`}
+
+	if uploaded, err := findImage(src); err == nil {
+		attributes = append(attributes, imageAttributes(uploaded)...)
+	}
+
+	attributes = append(attributes, `alt="`+html.EscapeString(nodeText(image))+`"`)
+
+	if len(image.Title) > 0 {
+		attributes = append(attributes, `title="`+html.EscapeString(string(image.Title))+`"`)
+	}
+
+	io.WriteString(w, "<img "+strings.Join(attributes, " ")+">")
+
+	return ast.SkipChildren, true
+}
+
+func imageAttributes(uploaded media.Media) []string {
+	attributes := []string{}
+
+	if len(uploaded.Variants) > 0 {
+		sources := []string{}
+
+		for _, variant := range uploaded.Variants {
+			sources = append(sources, variant.Url()+" "+strconv.Itoa(variant.Width)+"w")
+		}
+
+		sources = append(sources, uploaded.Url()+" "+strconv.Itoa(uploaded.Width)+"w")
+
+		attributes = append(attributes,
+			`srcset="`+html.EscapeString(strings.Join(sources, ", "))+`"`,
+			`sizes="`+imageSizes+`"`,
+		)
+	}
+
+	if uploaded.Width > 0 && uploaded.Height > 0 {
+		attributes = append(attributes,
+			`width="`+strconv.Itoa(uploaded.Width)+`"`,
+			`height="`+strconv.Itoa(uploaded.Height)+`"`,
+		)
+	}
+
+	return append(attributes, `loading="lazy"`)
+}
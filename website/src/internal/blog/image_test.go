@@ -0,0 +1,56 @@
+package blog
+
+import (
+	"strings"
+	"testing"
+
+	"valette.software/internal/media"
+)
+
+func TestRenderImage(t *testing.T) {
+	openTestDatabase(t)
+
+	findImage = func(url string) (media.Media, error) {
+		if url != "/uploads/photo.jpg" {
+			return media.Media{}, media.ErrNotFound
+		}
+
+		return media.Media{
+			Filename: "photo.jpg",
+			Width:    2000,
+			Height:   1000,
+			Variants: []media.Variant{{Width: 480, Height: 240, Filename: "photo-480.jpg"}},
+		}, nil
+	}
+
+	t.Cleanup(func() { findImage = media.FindByUrl })
+
+	type data struct {
+		content  string
+		expected string
+	}
+
+	testData := []data{
+		{
+			"![A <nice> photo](/uploads/photo.jpg \"Title\")",
+			`<img src="/uploads/photo.jpg" srcset="/uploads/photo-480.jpg 480w, /uploads/photo.jpg 2000w" sizes="(max-width: 64rem) 100vw, 64rem" width="2000" height="1000" loading="lazy" alt="A &lt;nice&gt; photo" title="Title">`,
+		},
+		{
+			"![Gone](/uploads/missing.png)",
+			`<img src="/uploads/missing.png" alt="Gone">`,
+		},
+		{
+			"![Logo](/static/image/shield.svg)",
+			`<img src="/static/image/shield.svg" alt="Logo"`,
+		},
+	}
+
+	for _, test := range testData {
+		post := RenderedPost{Post: Post{Content: test.content}}
+		post.CalculateHtmlContent()
+
+		if !strings.Contains(string(post.Html), test.expected) {
+			t.Errorf("expected \"%s\" to render %s, got %s", test.content, test.expected, post.Html)
+		}
+	}
+}
@@ -1,21 +1,63 @@
 package blog
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"time"
 
 	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
 	"github.com/gomarkdown/markdown/parser"
 )
 
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+// visibleCondition is the SQL filter matching the posts the public can read,
+// its only parameter is the current unix time.
+const visibleCondition = "status IN ('published', 'scheduled') AND publish_at <= ?"
+
+const localTimeLayout = "2006-01-02T15:04"
+
+// rendererVersion identifies the way Markdown is rendered in HTML. It must be
+// increased whenever the renderer's configuration changes, the posts stored
+// with an older version are then rendered again when read, until the
+// render-posts command updates them.
+const rendererVersion = 6
+
+// renderHooks replace the default rendering of some nodes, the first hook
+// handling a node renders it.
+var renderHooks = []html.RenderNodeFunc{renderImage, renderCodeBlock, renderHeadingAnchor}
+
+// lastModifiedColumn selects the time of the last revision of the post, or
+// its date if it has none.
+const lastModifiedColumn = "COALESCE((SELECT MAX(created_at) FROM post_revision WHERE post_revision.post_id = post.post_id), timestamp)"
+
 type NewPost struct {
 	Author    string `json:"author"`
 	Language  string `json:"language"`
 	Timestamp int64  `json:"timestamp"`
 	Title     string `json:"title"`
+	Slug      string `json:"slug"`
 	Summary   string `json:"summary"`
 	Content   string `json:"content"`
+	Status    string `json:"status"`
+	PublishAt int64  `json:"publishAt"`
+	Tags      []Tag  `json:"tags"`
+	// UserId is the account creating the post, it is never imported.
+	UserId int64 `json:"-"`
+	// SkipHtml drops the HTML typed in the content, the contributors' one.
+	SkipHtml bool `json:"-"`
+
+	Series       PostSeries    `json:"series"`
+	Translations []Translation `json:"translations"`
 }
 
 type Post struct {
@@ -27,13 +69,27 @@ type Post struct {
 	Timestamp int64
 	Summary   string
 	Content   string
+	Status    string
+	PublishAt int64
+	WordCount int
+	// UserId is the account which created the post, zero when unknown.
+	UserId int64
+	// SkipHtml drops the HTML typed in the content, it is set for the posts
+	// created by the contributors.
+	SkipHtml bool
 }
 
 type RenderedPost struct {
 	Post
-	Html      template.HTML
-	DateHuman string
-	DateIso   string
+	Html           template.HTML
+	DateHuman      string
+	DateIso        string
+	PublishAtInput string
+	LastModified   int64
+	Toc            []Heading
+	Tags           []Tag
+	Series         PostSeries
+	Translations   []Translation
 }
 
 func (post *NewPost) ToRenderedPost(id int64, slug string) RenderedPost {
@@ -46,7 +102,11 @@ func (post *NewPost) ToRenderedPost(id int64, slug string) RenderedPost {
 			Timestamp: post.Timestamp,
 			Summary:   post.Summary,
 			Content:   post.Content,
+			Status:    post.Status,
+			PublishAt: post.PublishAt,
 			Slug:      slug,
+			UserId:    post.UserId,
+			SkipHtml:  post.SkipHtml,
 		},
 	}
 
@@ -70,13 +130,76 @@ func (post *RenderedPost) CalculateDates() {
 	}
 
 	post.DateIso = datetime.UTC().Format("2006-01-02T15:04:05Z")
+
+	if post.PublishAt != 0 {
+		post.PublishAtInput = time.Unix(post.PublishAt, 0).In(timezoneCet).Format(localTimeLayout)
+	} else {
+		post.PublishAtInput = ""
+	}
+}
+
+// IsVisible tells whether the public can read the post right now.
+func (post Post) IsVisible() bool {
+	isPublic := post.Status == StatusPublished || post.Status == StatusScheduled
+
+	return isPublic && post.PublishAt <= time.Now().Unix()
+}
+
+// CurrentStatus is the status as the public sees it: a scheduled post whose
+// publication time has passed is published.
+func (post Post) CurrentStatus() string {
+	if post.Status == StatusScheduled && post.IsVisible() {
+		return StatusPublished
+	}
+
+	return post.Status
+}
+
+// ParseLocalTime reads a "datetime-local" form value in the blog's timezone.
+func ParseLocalTime(value string) (time.Time, error) {
+	return time.ParseInLocation(localTimeLayout, value, timezoneCet)
 }
 
 func (post *RenderedPost) CalculateHtmlContent() {
-	htmlFile := markdown.Render(
-		parser.NewWithExtensions(parser.CommonExtensions).Parse([]byte(post.Content)),
-		htmlRenderer,
-	)
+	// the parser and the renderer keep the state of the document they
+	// process, they can't be shared
+	flags := html.FlagsNone
+
+	if post.SkipHtml {
+		flags = html.SkipHTML
+	}
+
+	renderer := html.NewRenderer(html.RendererOptions{Flags: flags, RenderNodeHook: renderNode})
+	doc := parser.NewWithExtensions(parser.CommonExtensions).Parse([]byte(post.Content))
+
+	post.Toc = setHeadingIds(doc)
+	post.WordCount = countWords(doc)
+	post.Html = template.HTML(markdown.Render(doc, renderer))
+}
+
+func renderNode(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	for _, hook := range renderHooks {
+		if status, handled := hook(w, node, entering); handled {
+			return status, true
+		}
+	}
+
+	return ast.GoToNext, false
+}
+
+// useStoredHtml takes the HTML and the table of contents saved with the
+// post, unless an older renderer produced them.
+func (post *RenderedPost) useStoredHtml(html string, toc string, version int) {
+	if version != rendererVersion || json.Unmarshal([]byte(toc), &post.Toc) != nil {
+		post.CalculateHtmlContent()
+		return
+	}
+
+	post.Html = template.HTML(html)
+}
+
+func (post RenderedPost) tocJson() string {
+	toc, _ := json.Marshal(post.Toc)
 
-	post.Html = template.HTML(htmlFile)
+	return string(toc)
 }
@@ -0,0 +1,126 @@
+package blog
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Revision struct {
+	RevisionId int64
+	Editor     string
+	CreatedAt  int64
+	DateHuman  string
+	Post       Post
+}
+
+// FieldDiff is the line diff of one field of the post between two revisions.
+type FieldDiff struct {
+	Name  string
+	Lines []DiffLine
+}
+
+const revisionColumns = "revision_id, editor, created_at, post_id, title, language, author, timestamp, slug, summary, content, status, publish_at"
+
+func saveRevision(tx *sql.Tx, post Post, editor string) error {
+	_, err := tx.Exec(
+		"INSERT INTO post_revision(post_id, editor, created_at, title, language, author, timestamp, slug, summary, content, status, publish_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		post.ArticleId, editor, time.Now().Unix(), post.Title, post.Language, post.Author, post.Timestamp, post.Slug, post.Summary, post.Content, post.Status, post.PublishAt,
+	)
+
+	return err
+}
+
+func scanRevision(row interface{ Scan(...any) error }) (Revision, error) {
+	revision := Revision{}
+	post := &revision.Post
+
+	err := row.Scan(
+		&revision.RevisionId, &revision.Editor, &revision.CreatedAt,
+		&post.ArticleId, &post.Title, &post.Language, &post.Author, &post.Timestamp, &post.Slug, &post.Summary, &post.Content, &post.Status, &post.PublishAt,
+	)
+
+	if err != nil {
+		return Revision{}, err
+	}
+
+	revision.DateHuman = time.Unix(revision.CreatedAt, 0).In(timezoneCet).Format("2006-01-02 15:04:05")
+
+	return revision, nil
+}
+
+// ListRevisions returns the revisions of a post, the most recent first.
+func ListRevisions(postId int64) ([]Revision, error) {
+	results, err := db.Query("SELECT "+revisionColumns+" FROM post_revision WHERE post_id = ? ORDER BY revision_id DESC", postId)
+
+	if err != nil {
+		return []Revision{}, err
+	}
+
+	defer results.Close()
+
+	revisions := []Revision{}
+
+	for results.Next() {
+		revision, err := scanRevision(results)
+
+		if err != nil {
+			return []Revision{}, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, results.Err()
+}
+
+// GetRevision finds a revision, it must belong to the post postId.
+func GetRevision(postId int64, revisionId int64) (Revision, error) {
+	row := db.QueryRow("SELECT "+revisionColumns+" FROM post_revision WHERE post_id = ? AND revision_id = ?", postId, revisionId)
+
+	revision, err := scanRevision(row)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Revision{}, ErrNotFound
+	}
+
+	return revision, err
+}
+
+// RestoreRevision brings back the texts of an old revision. The restoration
+// is saved as a new revision, the history is never rewritten. The language,
+// slug and publication state of the post are left as they currently are.
+func RestoreRevision(postId int64, revisionId int64, editor string) (RenderedPost, error) {
+	revision, err := GetRevision(postId, revisionId)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	post, err := GetPostById(postId)
+
+	if err != nil {
+		return RenderedPost{}, err
+	}
+
+	post.Title = revision.Post.Title
+	post.Author = revision.Post.Author
+	post.Timestamp = revision.Post.Timestamp
+	post.Summary = revision.Post.Summary
+	post.Content = revision.Post.Content
+	// a scheduled post whose time has passed is saved as published
+	post.Status = post.CurrentStatus()
+
+	return UpdatePost(post, editor)
+}
+
+// CompareRevisions diffs the texts of two revisions line by line.
+func CompareRevisions(from Revision, to Revision) []FieldDiff {
+	return []FieldDiff{
+		{Name: "title", Lines: DiffLines(from.Post.Title, to.Post.Title)},
+		{Name: "author", Lines: DiffLines(from.Post.Author, to.Post.Author)},
+		{Name: "slug", Lines: DiffLines(from.Post.Slug, to.Post.Slug)},
+		{Name: "summary", Lines: DiffLines(from.Post.Summary, to.Post.Summary)},
+		{Name: "content", Lines: DiffLines(from.Post.Content, to.Post.Content)},
+	}
+}
@@ -0,0 +1,56 @@
+package blog
+
+import "testing"
+
+func TestRestoreRevision(t *testing.T) {
+	openTestDatabase(t)
+
+	post, err := AddPost(NewPost{Title: "First title", Language: "fr", Author: "Mehdi", Content: "first"}, "mehdi")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post.Title = "Second title"
+	post.Content = "second"
+
+	_, err = UpdatePost(post, "editor")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revisions, err := ListRevisions(post.ArticleId)
+
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %d, error: %s", len(revisions), err)
+	}
+
+	first := revisions[1]
+
+	if first.Editor != "mehdi" || first.Post.Content != "first" {
+		t.Errorf("expected the first revision to be the creation by mehdi, got %+v", first)
+	}
+
+	restored, err := RestoreRevision(post.ArticleId, first.RevisionId, "restorer")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Title != "First title" || restored.Content != "first" {
+		t.Errorf("expected the first texts to be restored, got \"%s\" and \"%s\"", restored.Title, restored.Content)
+	}
+
+	revisions, _ = ListRevisions(post.ArticleId)
+
+	if len(revisions) != 3 || revisions[0].Editor != "restorer" {
+		t.Errorf("expected the restoration to be a new revision, got %+v", revisions)
+	}
+
+	_, err = GetRevision(post.ArticleId+1, first.RevisionId)
+
+	if err != ErrNotFound {
+		t.Errorf("expected a revision of another post to be not found, got %s", err)
+	}
+}
@@ -0,0 +1,120 @@
+package blog
+
+import (
+	"html"
+	"html/template"
+	"strings"
+	"time"
+)
+
+type SearchResult struct {
+	RenderedPost
+	Snippet template.HTML
+}
+
+// the snippets are delimited with control characters, which cannot be found
+// in the posts, so that they can be escaped before being highlighted
+const snippetStart = "\x02"
+const snippetEnd = "\x03"
+
+var snippetHighlighter = strings.NewReplacer(snippetStart, "<mark>", snippetEnd, "</mark>")
+
+// Search finds the posts written in lang, or in any language if lang is
+// empty, matching every word of query, the most relevant first. Unless
+// withHidden is set, only the posts visible to the public are searched.
+func Search(lang string, query string, withHidden bool) ([]SearchResult, error) {
+	match := buildMatchExpression(query)
+
+	if match == "" {
+		return []SearchResult{}, nil
+	}
+
+	sqlQuery := "SELECT post.post_id, post.title, post.author, post.language, post.timestamp, post.summary, post.slug, post.status, post.publish_at, post.word_count, " +
+		"snippet(post_search, -1, ?, ?, '…', 24) " +
+		"FROM post_search JOIN post ON post.post_id = post_search.rowid " +
+		"WHERE post_search MATCH ?"
+	args := []any{snippetStart, snippetEnd, match}
+
+	if lang != "" {
+		sqlQuery += " AND post.language = ?"
+		args = append(args, lang)
+	}
+
+	if !withHidden {
+		sqlQuery += " AND " + visibleCondition
+		args = append(args, time.Now().Unix())
+	}
+
+	// a match in the title weighs more than in the summary, which weighs more than in the content
+	results, err := db.Query(sqlQuery+" ORDER BY bm25(post_search, 10.0, 5.0, 1.0) LIMIT 50", args...)
+
+	if err != nil {
+		return []SearchResult{}, err
+	}
+
+	defer results.Close()
+
+	found := []SearchResult{}
+
+	for results.Next() {
+		result := SearchResult{}
+		var snippet string
+
+		err := results.Scan(
+			&result.ArticleId,
+			&result.Title,
+			&result.Author,
+			&result.Language,
+			&result.Timestamp,
+			&result.Summary,
+			&result.Slug,
+			&result.Status,
+			&result.PublishAt,
+			&result.WordCount,
+			&snippet,
+		)
+
+		if err != nil {
+			return []SearchResult{}, err
+		}
+
+		result.CalculateDates()
+		result.Snippet = template.HTML(snippetHighlighter.Replace(html.EscapeString(snippet)))
+
+		found = append(found, result)
+	}
+
+	if err := results.Err(); err != nil {
+		return []SearchResult{}, err
+	}
+
+	posts := make([]RenderedPost, len(found))
+
+	for i := range found {
+		posts[i] = found[i].RenderedPost
+	}
+
+	err = loadTags(posts)
+
+	for i := range found {
+		found[i].Tags = posts[i].Tags
+	}
+
+	return found, err
+}
+
+// buildMatchExpression turns what a visitor typed into an FTS5 query: every
+// word must be found, as a prefix, and the FTS5 operators are neutralized.
+func buildMatchExpression(query string) string {
+	terms := []string{}
+
+	for word := range strings.FieldsSeq(query) {
+		word = strings.ReplaceAll(word, `"`, "")
+
+		if word != "" {
+			terms = append(terms, `"`+word+`"*`)
+		}
+	}
+
+	return strings.Join(terms, " ")
+}
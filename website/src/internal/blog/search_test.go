@@ -0,0 +1,74 @@
+package blog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildMatchExpression(t *testing.T) {
+	type data struct {
+		input  string
+		output string
+	}
+
+	testData := []data{
+		{"", ""},
+		{"   ", ""},
+		{"linux", `"linux"*`},
+		{" sécurité  réseau ", `"sécurité"* "réseau"*`},
+		{`"quoted" OR NOT`, `"quoted"* "OR"* "NOT"*`},
+		{`a"b`, `"ab"*`},
+	}
+
+	for _, test := range testData {
+		result := buildMatchExpression(test.input)
+
+		if result != test.output {
+			t.Errorf("expected \"%s\" to become \"%s\", got \"%s\"", test.input, test.output, result)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	openTestDatabase(t)
+
+	posts := []NewPost{
+		{Title: "Sécuriser un serveur", Language: "fr", Status: StatusPublished, Content: "Le pare-feu <b>bloque</b> les connexions."},
+		{Title: "Securing a server", Language: "en", Status: StatusPublished, Content: "The firewall blocks connections."},
+		{Title: "Brouillon sécurité", Language: "fr", Status: StatusDraft, Content: "Pas encore prêt."},
+	}
+
+	for _, post := range posts {
+		if _, err := AddPost(post, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := Search("fr", "securi", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].Title != "Sécuriser un serveur" {
+		t.Fatalf("expected the published french post only, got %+v", results)
+	}
+
+	results, _ = Search("fr", "bloque", false)
+
+	if len(results) != 1 || !strings.Contains(string(results[0].Snippet), "&lt;b&gt;<mark>bloque</mark>&lt;/b&gt;") {
+		t.Errorf("expected an escaped and highlighted snippet, got %+v", results)
+	}
+
+	results, _ = Search("", "securi", true)
+
+	if len(results) != 3 {
+		t.Errorf("expected every post for the admin, got %d", len(results))
+	}
+
+	results, err = Search("fr", `"("`, false)
+
+	if err != nil || len(results) != 0 {
+		t.Errorf("expected no result and no error for a query of operators, got %d and %s", len(results), err)
+	}
+}
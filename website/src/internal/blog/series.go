@@ -0,0 +1,220 @@
+package blog
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Series is a group of posts of one language read in order.
+type Series struct {
+	SeriesId int64
+	Language string
+	Title    string
+	Slug     string
+}
+
+// SeriesPart is a post of a series, numbered from 1 among the parts listed.
+type SeriesPart struct {
+	ArticleId int64
+	Slug      string
+	Title     string
+	Number    int
+}
+
+// PostSeries is the series of a post. Position sorts the post among the
+// parts, a zero position puts a post added to the series after the others.
+type PostSeries struct {
+	Series
+	Position int
+	Parts    []SeriesPart
+	// Current is the number of the post among the parts.
+	Current int
+}
+
+// Previous is the part before the post, it has no ID for the first part.
+func (series PostSeries) Previous() SeriesPart {
+	if series.Current < 2 {
+		return SeriesPart{}
+	}
+
+	return series.Parts[series.Current-2]
+}
+
+// Next is the part after the post, it has no ID for the last part.
+func (series PostSeries) Next() SeriesPart {
+	if series.Current == 0 || series.Current >= len(series.Parts) {
+		return SeriesPart{}
+	}
+
+	return series.Parts[series.Current]
+}
+
+// setPostSeries puts the post in the series titled series.Title in lang,
+// which is created if missing. An empty title takes the post out of its
+// series, the series left without posts are removed.
+func setPostSeries(tx *sql.Tx, postId int64, lang string, series PostSeries) (PostSeries, error) {
+	_, err := tx.Exec("DELETE FROM post_series WHERE post_id = ?", postId)
+
+	if err != nil {
+		return PostSeries{}, err
+	}
+
+	saved := PostSeries{Series: Series{Language: lang, Title: strings.TrimSpace(series.Title)}, Position: series.Position}
+	saved.Slug = makeSlug(saved.Title)
+
+	if saved.Title == "" {
+		return PostSeries{}, removeEmptySeries(tx)
+	}
+
+	err = tx.QueryRow("SELECT series_id, title FROM series WHERE language = ? AND slug = ?", lang, saved.Slug).Scan(&saved.SeriesId, &saved.Title)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		var result sql.Result
+
+		result, err = tx.Exec("INSERT INTO series(language, title, slug) VALUES(?, ?, ?)", lang, saved.Title, saved.Slug)
+
+		if err == nil {
+			saved.SeriesId, err = result.LastInsertId()
+		}
+	}
+
+	if err != nil {
+		return PostSeries{}, err
+	}
+
+	if saved.Position <= 0 {
+		err = tx.QueryRow("SELECT COALESCE(MAX(position), 0) + 1 FROM post_series WHERE series_id = ?", saved.SeriesId).Scan(&saved.Position)
+
+		if err != nil {
+			return PostSeries{}, err
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO post_series(post_id, series_id, position) VALUES(?, ?, ?)", postId, saved.SeriesId, saved.Position)
+
+	if err != nil {
+		return PostSeries{}, err
+	}
+
+	return saved, removeEmptySeries(tx)
+}
+
+// removeEmptySeries deletes the series whose last post was removed.
+func removeEmptySeries(conn interface {
+	Exec(string, ...any) (sql.Result, error)
+}) error {
+	_, err := conn.Exec("DELETE FROM series WHERE series_id NOT IN (SELECT series_id FROM post_series)")
+
+	return err
+}
+
+// GetPostSeries returns the series of the post with its parts, the post has
+// no series if the ID of the result is zero. Unless withHidden is set, only
+// the parts visible to the public are listed, besides the post itself.
+func GetPostSeries(postId int64, withHidden bool) (PostSeries, error) {
+	series := PostSeries{}
+
+	err := db.QueryRow(
+		"SELECT series.series_id, series.language, series.title, series.slug, post_series.position FROM post_series JOIN series ON series.series_id = post_series.series_id WHERE post_series.post_id = ?",
+		postId,
+	).Scan(&series.SeriesId, &series.Language, &series.Title, &series.Slug, &series.Position)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return PostSeries{}, nil
+	} else if err != nil {
+		return PostSeries{}, err
+	}
+
+	query := "SELECT post.post_id, post.slug, post.title FROM post_series JOIN post ON post.post_id = post_series.post_id WHERE post_series.series_id = ?"
+	args := []any{series.SeriesId}
+
+	if !withHidden {
+		query += " AND (post.post_id = ? OR " + visibleCondition + ")"
+		args = append(args, postId, time.Now().Unix())
+	}
+
+	results, err := db.Query(query+" ORDER BY post_series.position, post.timestamp", args...)
+
+	if err != nil {
+		return PostSeries{}, err
+	}
+
+	defer results.Close()
+
+	for results.Next() {
+		part := SeriesPart{Number: len(series.Parts) + 1}
+
+		if err := results.Scan(&part.ArticleId, &part.Slug, &part.Title); err != nil {
+			return PostSeries{}, err
+		}
+
+		if part.ArticleId == postId {
+			series.Current = part.Number
+		}
+
+		series.Parts = append(series.Parts, part)
+	}
+
+	return series, results.Err()
+}
+
+// loadSeries fills the series of the listed posts, without their parts.
+func loadSeries(posts []RenderedPost) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	list, ids := postIdList(posts)
+
+	results, err := db.Query(
+		"SELECT post_series.post_id, series.series_id, series.language, series.title, series.slug, post_series.position FROM post_series "+
+			"JOIN series ON series.series_id = post_series.series_id WHERE post_series.post_id IN "+list,
+		ids...,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	defer results.Close()
+
+	seriesByPost := map[int64]PostSeries{}
+
+	for results.Next() {
+		var postId int64
+		series := PostSeries{}
+
+		if err := results.Scan(&postId, &series.SeriesId, &series.Language, &series.Title, &series.Slug, &series.Position); err != nil {
+			return err
+		}
+
+		seriesByPost[postId] = series
+	}
+
+	for i := range posts {
+		posts[i].Series = seriesByPost[posts[i].ArticleId]
+	}
+
+	return results.Err()
+}
+
+// GetSeriesBySlug finds a series by its slug in lang.
+func GetSeriesBySlug(lang string, slug string) (Series, error) {
+	series := Series{Language: lang, Slug: slug}
+
+	err := db.QueryRow("SELECT series_id, title FROM series WHERE language = ? AND slug = ?", lang, slug).Scan(&series.SeriesId, &series.Title)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Series{}, ErrNotFound
+	}
+
+	return series, err
+}
+
+// ListSeriesPosts returns the summaries of the parts of the series in their
+// order, with the same visibility rules as ListPosts.
+func ListSeriesPosts(series Series, withHidden bool) ([]RenderedPost, error) {
+	return listPosts(postFilter{language: series.Language, seriesId: series.SeriesId, withHidden: withHidden})
+}
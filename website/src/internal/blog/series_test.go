@@ -0,0 +1,71 @@
+package blog
+
+import "testing"
+
+func TestSeries(t *testing.T) {
+	openTestDatabase(t)
+
+	add := func(title string, status string, series PostSeries) RenderedPost {
+		post, err := AddPost(NewPost{Title: title, Language: "en", Status: status, Series: series}, "test")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return post
+	}
+
+	second := add("Second", StatusPublished, PostSeries{Series: Series{Title: "Deploying"}, Position: 2})
+	first := add("First", StatusPublished, PostSeries{Series: Series{Title: "deploying "}, Position: 1})
+	draft := add("Draft", StatusDraft, PostSeries{Series: Series{Title: "Deploying"}})
+	add("Alone", StatusPublished, PostSeries{})
+
+	if first.Series.SeriesId != second.Series.SeriesId || first.Series.Title != "Deploying" {
+		t.Errorf("expected \"deploying \" to reuse the series \"Deploying\", got %+v", first.Series)
+	}
+
+	if draft.Series.Position != 3 {
+		t.Errorf("expected a post without position to be added last, got %d", draft.Series.Position)
+	}
+
+	series, err := GetPostSeries(second.ArticleId, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(series.Parts) != 2 || series.Current != 2 || series.Previous().ArticleId != first.ArticleId || series.Next().ArticleId != 0 {
+		t.Errorf("expected the second of 2 visible parts, got %+v", series)
+	}
+
+	series, _ = GetPostSeries(second.ArticleId, true)
+
+	if len(series.Parts) != 3 || series.Next().ArticleId != draft.ArticleId {
+		t.Errorf("expected the draft to follow for the admin, got %+v", series)
+	}
+
+	found, err := GetSeriesBySlug("en", "deploying")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts, err := ListSeriesPosts(found, false)
+
+	if err != nil || len(posts) != 2 || posts[0].ArticleId != first.ArticleId {
+		t.Errorf("expected the visible parts in order, got %+v, error: %v", posts, err)
+	}
+
+	draft.Series = PostSeries{}
+
+	if _, err := UpdatePost(draft, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	DeletePostById(first.ArticleId)
+	DeletePostById(second.ArticleId)
+
+	if _, err := GetSeriesBySlug("en", "deploying"); err != ErrNotFound {
+		t.Errorf("expected the series without posts to be removed, got %v", err)
+	}
+}
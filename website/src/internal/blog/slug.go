@@ -0,0 +1,85 @@
+package blog
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// claimSlug checks that no other post of lang uses slug, then takes it over
+// from the former slugs of the posts.
+func claimSlug(tx *sql.Tx, postId int64, lang string, slug string) error {
+	if slug == "" {
+		return ErrSlugEmpty
+	}
+
+	var taken int
+
+	err := tx.QueryRow("SELECT COUNT(*) FROM post WHERE language = ? AND slug = ? AND post_id != ?", lang, slug, postId).Scan(&taken)
+
+	if err != nil {
+		return err
+	}
+
+	if taken > 0 {
+		return ErrSlugTaken
+	}
+
+	_, err = tx.Exec("DELETE FROM post_slug_history WHERE language = ? AND slug = ?", lang, slug)
+
+	return err
+}
+
+// moveSlug claims the new slug of the post and keeps its current one in the
+// history, if it changes.
+func moveSlug(tx *sql.Tx, postId int64, lang string, slug string) error {
+	var formerLang, formerSlug string
+
+	err := tx.QueryRow("SELECT language, slug FROM post WHERE post_id = ?", postId).Scan(&formerLang, &formerSlug)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	err = claimSlug(tx, postId, lang, slug)
+
+	if err != nil || (formerLang == lang && formerSlug == slug) {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT OR REPLACE INTO post_slug_history(language, slug, post_id) VALUES(?, ?, ?)",
+		formerLang, formerSlug, postId,
+	)
+
+	return err
+}
+
+// FindMovedPost looks for the post which used to have slug, preferably in
+// lang, then in any language. The post returned only has its current
+// language and slug. Unless withHidden is set, posts that aren't visible to
+// the public are reported as not found.
+func FindMovedPost(lang string, slug string, withHidden bool) (Post, error) {
+	post := Post{}
+
+	query := "SELECT post.post_id, post.language, post.slug FROM post_slug_history JOIN post ON post.post_id = post_slug_history.post_id WHERE post_slug_history.slug = ?"
+	args := []any{slug}
+
+	if !withHidden {
+		query += " AND " + visibleCondition
+		args = append(args, time.Now().Unix())
+	}
+
+	query += " ORDER BY post_slug_history.language = ? DESC LIMIT 1"
+	args = append(args, lang)
+
+	err := db.QueryRow(query, args...).Scan(&post.ArticleId, &post.Language, &post.Slug)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Post{}, ErrNotFound
+	}
+
+	return post, err
+}
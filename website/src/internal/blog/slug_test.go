@@ -0,0 +1,47 @@
+package blog
+
+import "testing"
+
+func TestSlugHistory(t *testing.T) {
+	openTestDatabase(t)
+
+	post, err := AddPost(NewPost{Title: "Premier titre", Language: "fr", Status: StatusPublished}, "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post.Slug = "nouveau-titre"
+
+	if _, err := UpdatePost(post, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := FindMovedPost("fr", "premier-titre", false)
+
+	if err != nil || moved.Slug != "nouveau-titre" || moved.Language != "fr" {
+		t.Errorf("expected \"premier-titre\" to lead to \"nouveau-titre\", got %+v, error: %s", moved, err)
+	}
+
+	_, err = AddPost(NewPost{Title: "Nouveau titre", Language: "fr"}, "test")
+
+	if err != ErrSlugTaken {
+		t.Errorf("expected ErrSlugTaken for a slug used in the same language, got %s", err)
+	}
+
+	_, err = AddPost(NewPost{Title: "Nouveau titre", Language: "en"}, "test")
+
+	if err != nil {
+		t.Errorf("expected the slug to be free in another language, got %s", err)
+	}
+
+	_, err = AddPost(NewPost{Title: "Premier titre", Language: "fr"}, "test")
+
+	if err != nil {
+		t.Fatalf("expected a former slug to be reusable, got %s", err)
+	}
+
+	if _, err := FindMovedPost("fr", "premier-titre", true); err != ErrNotFound {
+		t.Errorf("expected the reused slug to leave the history, got %s", err)
+	}
+}
@@ -0,0 +1,314 @@
+package blog
+
+import (
+	"database/sql"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Tag is a tag as named in one language.
+type Tag struct {
+	TagId int64
+	Name  string
+	Slug  string
+}
+
+// TagNames is a tag with its name in each language, as edited by the admin.
+type TagNames struct {
+	TagId int64
+	Names map[string]string
+	Posts int
+}
+
+// ParseTags reads a comma separated list of tag names, such as the one typed
+// in the post editor. The tags returned only have a name.
+func ParseTags(input string) []Tag {
+	tags := []Tag{}
+	seen := map[string]bool{}
+
+	for name := range strings.SplitSeq(input, ",") {
+		name = strings.TrimSpace(name)
+		slug := makeSlug(name)
+
+		if name == "" || seen[slug] {
+			continue
+		}
+
+		seen[slug] = true
+		tags = append(tags, Tag{Name: name})
+	}
+
+	return tags
+}
+
+// TagInput lists the names of the tags of the post for the post editor.
+func (post RenderedPost) TagInput() string {
+	names := make([]string, 0, len(post.Tags))
+
+	for _, tag := range post.Tags {
+		names = append(names, tag.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// setPostTags replaces the tags of the post by the ones named in tags, the
+// names missing in lang become new tags.
+func setPostTags(tx *sql.Tx, postId int64, lang string, tags []Tag) ([]Tag, error) {
+	_, err := tx.Exec("DELETE FROM post_tag WHERE post_id = ?", postId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	savedTags := make([]Tag, 0, len(tags))
+	seen := map[string]bool{}
+
+	for _, tag := range tags {
+		tag.Name = strings.TrimSpace(tag.Name)
+		tag.Slug = makeSlug(tag.Name)
+
+		if tag.Name == "" || seen[tag.Slug] {
+			continue
+		}
+
+		seen[tag.Slug] = true
+
+		err := tx.QueryRow("SELECT tag_id, name FROM tag_name WHERE language = ? AND slug = ?", lang, tag.Slug).Scan(&tag.TagId, &tag.Name)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			tag.TagId, err = createTag(tx, lang, tag.Name, tag.Slug)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec("INSERT INTO post_tag(post_id, tag_id) VALUES(?, ?)", postId, tag.TagId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		savedTags = append(savedTags, tag)
+	}
+
+	return savedTags, nil
+}
+
+func createTag(tx *sql.Tx, lang string, name string, slug string) (int64, error) {
+	result, err := tx.Exec("INSERT INTO tag DEFAULT VALUES")
+
+	if err != nil {
+		return 0, err
+	}
+
+	tagId, err := result.LastInsertId()
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO tag_name(tag_id, language, name, slug) VALUES(?, ?, ?, ?)", tagId, lang, name, slug)
+
+	return tagId, err
+}
+
+// ListPostTags returns the tags of a post, named in lang.
+func ListPostTags(postId int64, lang string) ([]Tag, error) {
+	results, err := db.Query(
+		"SELECT tag_name.tag_id, name, slug FROM post_tag JOIN tag_name ON tag_name.tag_id = post_tag.tag_id WHERE post_id = ? AND language = ? ORDER BY name",
+		postId, lang,
+	)
+
+	if err != nil {
+		return []Tag{}, err
+	}
+
+	defer results.Close()
+
+	tags := []Tag{}
+
+	for results.Next() {
+		tag := Tag{}
+
+		if err := results.Scan(&tag.TagId, &tag.Name, &tag.Slug); err != nil {
+			return []Tag{}, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, results.Err()
+}
+
+// postIdList is the list of the IDs of the posts for an IN condition, with
+// its arguments.
+func postIdList(posts []RenderedPost) (string, []any) {
+	ids := make([]any, len(posts))
+
+	for i, post := range posts {
+		ids[i] = post.ArticleId
+	}
+
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", len(posts)), ", ") + ")", ids
+}
+
+// loadTags fills the tags of the listed posts, each named in the language
+// of its post.
+func loadTags(posts []RenderedPost) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	list, ids := postIdList(posts)
+
+	results, err := db.Query(
+		"SELECT post_tag.post_id, tag_name.tag_id, name, tag_name.slug FROM post_tag "+
+			"JOIN post ON post.post_id = post_tag.post_id "+
+			"JOIN tag_name ON tag_name.tag_id = post_tag.tag_id AND tag_name.language = post.language "+
+			"WHERE post_tag.post_id IN "+list+" ORDER BY name",
+		ids...,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	defer results.Close()
+
+	tagsByPost := map[int64][]Tag{}
+
+	for results.Next() {
+		var postId int64
+		tag := Tag{}
+
+		if err := results.Scan(&postId, &tag.TagId, &tag.Name, &tag.Slug); err != nil {
+			return err
+		}
+
+		tagsByPost[postId] = append(tagsByPost[postId], tag)
+	}
+
+	for i := range posts {
+		posts[i].Tags = tagsByPost[posts[i].ArticleId]
+	}
+
+	return results.Err()
+}
+
+// GetTagBySlug finds a tag by its slug in lang.
+func GetTagBySlug(lang string, slug string) (Tag, error) {
+	tag := Tag{Slug: slug}
+
+	err := db.QueryRow("SELECT tag_id, name FROM tag_name WHERE language = ? AND slug = ?", lang, slug).Scan(&tag.TagId, &tag.Name)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tag{}, ErrNotFound
+	}
+
+	return tag, err
+}
+
+// ListPostsByTag returns the summaries of the posts written in lang and
+// tagged with tag, with the same visibility rules as ListPosts.
+func ListPostsByTag(lang string, tag Tag, withHidden bool) ([]RenderedPost, error) {
+	return listPosts(postFilter{language: lang, tagId: tag.TagId, withHidden: withHidden})
+}
+
+// ListTags returns every tag with its names, for the admin.
+func ListTags() ([]TagNames, error) {
+	results, err := db.Query(
+		"SELECT tag.tag_id, COALESCE(language, ''), COALESCE(name, ''), (SELECT COUNT(*) FROM post_tag WHERE post_tag.tag_id = tag.tag_id) " +
+			"FROM tag LEFT JOIN tag_name ON tag_name.tag_id = tag.tag_id ORDER BY tag.tag_id",
+	)
+
+	if err != nil {
+		return []TagNames{}, err
+	}
+
+	defer results.Close()
+
+	tags := []TagNames{}
+
+	for results.Next() {
+		var tagId int64
+		var lang, name string
+		var posts int
+
+		if err := results.Scan(&tagId, &lang, &name, &posts); err != nil {
+			return []TagNames{}, err
+		}
+
+		if len(tags) == 0 || tags[len(tags)-1].TagId != tagId {
+			tags = append(tags, TagNames{TagId: tagId, Names: map[string]string{}, Posts: posts})
+		}
+
+		if lang != "" {
+			tags[len(tags)-1].Names[lang] = name
+		}
+	}
+
+	return tags, results.Err()
+}
+
+// RenameTag sets the names of the tag, by language, at once: an empty name
+// removes the name in its language, but the tag keeps at least one.
+func RenameTag(tagId int64, names map[string]string) error {
+	empty := true
+
+	for lang, name := range names {
+		names[lang] = strings.TrimSpace(name)
+		empty = empty && names[lang] == ""
+	}
+
+	if empty {
+		return ErrTagNameEmpty
+	}
+
+	// the slugs are checked and taken at once, two renames can't both take
+	// one, and a name taken leaves the others unchanged
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, lang := range slices.Sorted(maps.Keys(names)) {
+		if err := renameTagIn(tx, tagId, lang, names[lang]); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// renameTagIn sets the name of the tag in lang within the transaction.
+func renameTagIn(tx *sql.Tx, tagId int64, lang string, name string) error {
+	if name == "" {
+		_, err := tx.Exec("DELETE FROM tag_name WHERE tag_id = ? AND language = ?", tagId, lang)
+		return err
+	}
+
+	slug := makeSlug(name)
+
+	var owner int64
+	err := tx.QueryRow("SELECT tag_id FROM tag_name WHERE language = ? AND slug = ?", lang, slug).Scan(&owner)
+
+	if err == nil && owner != tagId {
+		return ErrTagTaken
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO tag_name(tag_id, language, name, slug) VALUES(?, ?, ?, ?) ON CONFLICT(tag_id, language) DO UPDATE SET name = excluded.name, slug = excluded.slug",
+		tagId, lang, name, slug,
+	)
+
+	return err
+}
@@ -0,0 +1,76 @@
+package blog
+
+import "testing"
+
+func TestParseTags(t *testing.T) {
+	tags := ParseTags(" Linux, sécurité,,linux , Sécurité,Réseau ")
+	expected := []string{"Linux", "sécurité", "Réseau"}
+
+	if len(tags) != len(expected) {
+		t.Fatalf("expected %d tags, got %+v", len(expected), tags)
+	}
+
+	for i, tag := range tags {
+		if tag.Name != expected[i] {
+			t.Errorf("expected tag %d to be \"%s\", got \"%s\"", i, expected[i], tag.Name)
+		}
+	}
+}
+
+func TestTagsAreSharedPerLanguage(t *testing.T) {
+	openTestDatabase(t)
+
+	first, err := AddPost(NewPost{Title: "Un", Language: "fr", Status: StatusPublished, Tags: ParseTags("Sécurité, Linux")}, "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := AddPost(NewPost{Title: "Deux", Language: "fr", Status: StatusPublished, Tags: ParseTags("securite")}, "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Tags[0].TagId != first.Tags[0].TagId || second.Tags[0].Name != "Sécurité" {
+		t.Errorf("expected \"securite\" to reuse the tag \"Sécurité\", got %+v", second.Tags)
+	}
+
+	tag, err := GetTagBySlug("fr", "securite")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts, err := ListPostsByTag("fr", tag, false)
+
+	if err != nil || len(posts) != 2 {
+		t.Errorf("expected 2 posts tagged \"Sécurité\", got %d, error: %s", len(posts), err)
+	}
+
+	if _, err := GetTagBySlug("en", "securite"); err != ErrNotFound {
+		t.Errorf("expected the tag to have no english name yet, got %s", err)
+	}
+
+	if err := RenameTag(tag.TagId, map[string]string{"fr": "Sécurité", "en": "Linux"}); err != nil {
+		t.Fatal(err)
+	}
+
+	other := first.Tags[1].TagId
+
+	if err := RenameTag(other, map[string]string{"fr": "Noyau", "en": "linux"}); err != ErrTagTaken {
+		t.Errorf("expected ErrTagTaken when two tags share an english name, got %s", err)
+	}
+
+	if _, err := GetTagBySlug("fr", "noyau"); err != ErrNotFound {
+		t.Errorf("expected a refused rename to leave the french name unchanged, got %v", err)
+	}
+
+	if err := RenameTag(other, map[string]string{"fr": " ", "en": ""}); err != ErrTagNameEmpty {
+		t.Errorf("expected ErrTagNameEmpty when every name is empty, got %v", err)
+	}
+
+	if renamed, err := GetTagBySlug("fr", makeSlug(first.Tags[1].Name)); err != nil || renamed.TagId != other {
+		t.Errorf("expected the tag to keep its name, got %+v, error: %v", renamed, err)
+	}
+}
@@ -0,0 +1,155 @@
+package blog
+
+import (
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gomarkdown/markdown/ast"
+	mdhtml "github.com/gomarkdown/markdown/html"
+	"golang.org/x/text/unicode/norm"
+)
+
+// wordsPerMinute is the reading speed the reading time is estimated with.
+const wordsPerMinute = 200
+
+// tocMaxLevel is the deepest heading listed in the table of contents.
+const tocMaxLevel = 3
+
+// Heading is an entry of the table of contents of a post.
+type Heading struct {
+	Level int    `json:"level"`
+	Id    string `json:"id"`
+	Text  string `json:"text"`
+}
+
+// ReadingTime is the estimated number of minutes needed to read the post.
+func (post Post) ReadingTime() int {
+	return max(1, (post.WordCount+wordsPerMinute-1)/wordsPerMinute)
+}
+
+// setHeadingIds gives every heading of the document without an ID typed by
+// the author, such as {#intro}, an ID made from its text, unique in the
+// document, and returns the table of contents.
+func setHeadingIds(doc ast.Node) []Heading {
+	toc := []Heading{}
+	taken := map[string]bool{}
+
+	// the IDs typed are kept as they are, the links to them must not break
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if heading, ok := node.(*ast.Heading); ok && entering {
+			taken[heading.HeadingID] = heading.HeadingID != ""
+			return ast.SkipChildren
+		}
+
+		return ast.GoToNext
+	})
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+
+		text := strings.TrimSpace(nodeText(heading))
+
+		if heading.HeadingID == "" {
+			heading.HeadingID = uniqueId(makeSlug(removeAccents(text)), taken)
+		}
+
+		if heading.Level <= tocMaxLevel {
+			toc = append(toc, Heading{Level: heading.Level, Id: heading.HeadingID, Text: text})
+		}
+
+		return ast.SkipChildren
+	})
+
+	return toc
+}
+
+// uniqueId returns id, or id followed by a number when it is taken, and
+// takes it.
+func uniqueId(id string, taken map[string]bool) string {
+	if id == "" {
+		id = "section"
+	}
+
+	base := id
+
+	for i := 2; taken[id]; i++ {
+		id = base + "-" + strconv.Itoa(i)
+	}
+
+	taken[id] = true
+
+	return id
+}
+
+// removeAccents splits the letters from their accents, whatever the
+// language, and drops the accents: "é" and "ñ" become "e" and "n". The IDs
+// of the headings are made without accents, unlike the slugs of the posts
+// which must not change.
+func removeAccents(text string) string {
+	return strings.Map(func(char rune) rune {
+		if unicode.Is(unicode.Mn, char) {
+			return -1
+		}
+
+		return char
+	}, norm.NFD.String(text))
+}
+
+// countWords counts the words of the text and of the code of the document.
+func countWords(doc ast.Node) int {
+	count := 0
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if leaf := node.AsLeaf(); leaf != nil && entering {
+			count += len(strings.Fields(string(leaf.Literal)))
+		}
+
+		return ast.GoToNext
+	})
+
+	return count
+}
+
+// nodeText is the text of the node without its formatting.
+func nodeText(node ast.Node) string {
+	text := strings.Builder{}
+
+	ast.WalkFunc(node, func(child ast.Node, entering bool) ast.WalkStatus {
+		if leaf := child.AsLeaf(); leaf != nil && entering {
+			text.Write(leaf.Literal)
+		}
+
+		return ast.GoToNext
+	})
+
+	return text.String()
+}
+
+// renderHeadingAnchor ends the headings with a link to themselves. Their ID
+// is escaped, the IDs typed by the authors may hold quotes.
+func renderHeadingAnchor(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	heading, ok := node.(*ast.Heading)
+
+	if !ok || heading.HeadingID == "" {
+		return ast.GoToNext, false
+	}
+
+	id := html.EscapeString(heading.HeadingID)
+
+	if entering {
+		io.WriteString(w, mdhtml.HeadingOpenTagFromLevel(heading.Level)+` id="`+id+`">`)
+		return ast.GoToNext, true
+	}
+
+	io.WriteString(w, `<a class="heading-anchor" href="#`+id+`" aria-hidden="true">#</a>`)
+	io.WriteString(w, mdhtml.HeadingCloseTagFromLevel(heading.Level)+"\n")
+
+	return ast.GoToNext, true
+}
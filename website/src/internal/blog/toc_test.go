@@ -0,0 +1,94 @@
+package blog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTableOfContents(t *testing.T) {
+	post := RenderedPost{Post: Post{Content: "# L'Été *chaud*\n\nUn deux trois.\n\n## Étape\n\n## Étape\n\n#### Détail\n\n```go\nfunc main() {}\n```\n"}}
+	post.CalculateHtmlContent()
+
+	expected := []Heading{
+		{Level: 1, Id: "lete-chaud", Text: "L'Été chaud"},
+		{Level: 2, Id: "etape", Text: "Étape"},
+		{Level: 2, Id: "etape-2", Text: "Étape"},
+	}
+
+	if len(post.Toc) != len(expected) {
+		t.Fatalf("expected %d headings, got %+v", len(expected), post.Toc)
+	}
+
+	for i, heading := range expected {
+		if post.Toc[i] != heading {
+			t.Errorf("expected %+v, got %+v", heading, post.Toc[i])
+		}
+	}
+
+	html := string(post.Html)
+
+	if !strings.Contains(html, `<h2 id="etape-2">Étape<a class="heading-anchor" href="#etape-2" aria-hidden="true">#</a></h2>`) {
+		t.Errorf("expected the headings to link to themselves, got %s", html)
+	}
+
+	if !strings.Contains(html, `<h4 id="detail">`) {
+		t.Errorf("expected the deep headings to have an ID too, got %s", html)
+	}
+
+	// the headings, the paragraph and the code
+	if post.WordCount != 11 {
+		t.Errorf("expected 11 words, got %d", post.WordCount)
+	}
+}
+
+func TestTypedHeadingIds(t *testing.T) {
+	post := RenderedPost{Post: Post{Content: "## Étape\n\n## Début {#etape}\n\n## Señor {#Old_Anchor}\n\n## Señor Ángel\n"}}
+	post.CalculateHtmlContent()
+
+	expected := []Heading{
+		{Level: 2, Id: "etape-2", Text: "Étape"},
+		{Level: 2, Id: "etape", Text: "Début"},
+		{Level: 2, Id: "Old_Anchor", Text: "Señor"},
+		{Level: 2, Id: "senor-angel", Text: "Señor Ángel"},
+	}
+
+	if len(post.Toc) != len(expected) {
+		t.Fatalf("expected %d headings, got %+v", len(expected), post.Toc)
+	}
+
+	for i, heading := range expected {
+		if post.Toc[i] != heading {
+			t.Errorf("expected %+v, got %+v", heading, post.Toc[i])
+		}
+	}
+
+	if !strings.Contains(string(post.Html), `<h2 id="Old_Anchor">Señor<a class="heading-anchor" href="#Old_Anchor"`) {
+		t.Errorf("expected the ID typed to be kept, got %s", post.Html)
+	}
+}
+
+func TestEscapedHeadingIds(t *testing.T) {
+	post := RenderedPost{Post: Post{Content: "## Intro {#a\"b<c>}\n"}}
+	post.CalculateHtmlContent()
+
+	expected := `<h2 id="a&#34;b&lt;c&gt;">Intro<a class="heading-anchor" href="#a&#34;b&lt;c&gt;" aria-hidden="true">#</a></h2>`
+
+	if !strings.Contains(string(post.Html), expected) {
+		t.Errorf("expected the ID typed to be escaped, got %s", post.Html)
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	type data struct {
+		words   int
+		minutes int
+	}
+
+	testData := []data{{0, 1}, {1, 1}, {200, 1}, {201, 2}, {1000, 5}}
+
+	for _, test := range testData {
+		if minutes := (Post{WordCount: test.words}).ReadingTime(); minutes != test.minutes {
+			t.Errorf("expected %d words to take %d minute(s), got %d", test.words, test.minutes, minutes)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package blog
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Translation points to the same post written in another language.
+type Translation struct {
+	ArticleId int64
+	Language  string
+	Slug      string
+	Title     string
+}
+
+// TranslationIn finds the translation of the post in lang.
+func (post RenderedPost) TranslationIn(lang string) (Translation, bool) {
+	for _, translation := range post.Translations {
+		if translation.Language == lang {
+			return translation, true
+		}
+	}
+
+	return Translation{}, false
+}
+
+// ListTranslations returns the other posts of the translation group of the
+// post. Unless withHidden is set, only the translations visible to the
+// public are listed.
+func ListTranslations(postId int64, withHidden bool) ([]Translation, error) {
+	query := "SELECT post_id, language, slug, title FROM post WHERE translation_group = (SELECT translation_group FROM post WHERE post_id = ?) AND post_id != ?"
+	args := []any{postId, postId}
+
+	if !withHidden {
+		query += " AND " + visibleCondition
+		args = append(args, time.Now().Unix())
+	}
+
+	results, err := db.Query(query+" ORDER BY language", args...)
+
+	if err != nil {
+		return []Translation{}, err
+	}
+
+	defer results.Close()
+
+	translations := []Translation{}
+
+	for results.Next() {
+		translation := Translation{}
+
+		if err := results.Scan(&translation.ArticleId, &translation.Language, &translation.Slug, &translation.Title); err != nil {
+			return []Translation{}, err
+		}
+
+		translations = append(translations, translation)
+	}
+
+	return translations, results.Err()
+}
+
+// setTranslation attaches the post to the translation group of the first
+// post of translations, or detaches it from its group if there is none.
+func setTranslation(tx *sql.Tx, postId int64, lang string, translations []Translation) error {
+	if len(translations) == 0 {
+		_, err := tx.Exec("UPDATE post SET translation_group = NULL WHERE post_id = ?", postId)
+		return err
+	}
+
+	target := translations[0].ArticleId
+
+	var targetLang string
+	var group int64
+
+	err := tx.QueryRow("SELECT language, COALESCE(translation_group, post_id) FROM post WHERE post_id = ?", target).Scan(&targetLang, &group)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if targetLang == lang {
+		return ErrTranslationLanguage
+	}
+
+	var taken int
+	err = tx.QueryRow("SELECT COUNT(*) FROM post WHERE translation_group = ? AND language = ? AND post_id != ?", group, lang, postId).Scan(&taken)
+
+	if err != nil {
+		return err
+	}
+
+	if taken > 0 {
+		return ErrTranslationTaken
+	}
+
+	_, err = tx.Exec("UPDATE post SET translation_group = ? WHERE post_id IN (?, ?)", group, postId, target)
+
+	return err
+}
@@ -0,0 +1,61 @@
+package blog
+
+import "testing"
+
+func TestTranslations(t *testing.T) {
+	openTestDatabase(t)
+
+	french, err := AddPost(NewPost{Title: "Bonjour", Language: "fr", Status: StatusPublished}, "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	english, err := AddPost(NewPost{Title: "Hello", Language: "en", Translations: []Translation{{ArticleId: french.ArticleId}}}, "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if translation, ok := english.TranslationIn("fr"); !ok || translation.Slug != "bonjour" {
+		t.Errorf("expected the english post to link to \"bonjour\", got %+v", english.Translations)
+	}
+
+	post, err := GetPostBySlug("en", "bonjour", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(post.Translations) != 0 {
+		t.Errorf("expected the english draft to be hidden from the public, got %+v", post.Translations)
+	}
+
+	post, _ = GetPostBySlug("en", "bonjour", true)
+
+	if translation, ok := post.TranslationIn("en"); !ok || translation.Slug != "hello" {
+		t.Errorf("expected the french post to link to \"hello\" for the admin, got %+v", post.Translations)
+	}
+
+	_, err = AddPost(NewPost{Title: "Salut", Language: "fr", Translations: []Translation{{ArticleId: french.ArticleId}}}, "test")
+
+	if err != ErrTranslationLanguage {
+		t.Errorf("expected ErrTranslationLanguage, got %s", err)
+	}
+
+	_, err = AddPost(NewPost{Title: "Hi", Language: "en", Translations: []Translation{{ArticleId: french.ArticleId}}}, "test")
+
+	if err != ErrTranslationTaken {
+		t.Errorf("expected ErrTranslationTaken, got %s", err)
+	}
+
+	english.Translations = nil
+
+	if _, err := UpdatePost(english, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if translations, _ := ListTranslations(french.ArticleId, true); len(translations) != 0 {
+		t.Errorf("expected the translation to be detached, got %+v", translations)
+	}
+}
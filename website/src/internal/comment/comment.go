@@ -0,0 +1,345 @@
+package comment
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"valette.software/internal/blog"
+	"valette.software/internal/database"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusSpam     = "spam"
+)
+
+// MaxAuthorLength and MaxContentLength bound the fields of the form, in
+// characters.
+const MaxAuthorLength = 100
+const MaxContentLength = 5000
+
+var ErrNotFound = errors.New("comment not found")
+var ErrPostNotFound = errors.New("the article can't be commented")
+var ErrAuthorMissing = errors.New("the name must not be empty")
+var ErrContentMissing = errors.New("the comment must not be empty")
+var ErrTooLong = errors.New("the comment is too long")
+var ErrInvalidStatus = errors.New("unknown comment status")
+
+const commentColumns = "comment.comment_id, comment.post_id, COALESCE(comment.parent_id, 0), comment.author, comment.email, comment.content, comment.html, comment.status, comment.from_admin, comment.created_at, post.title, post.language, post.slug"
+
+const commentTables = "comment JOIN post ON post.post_id = comment.post_id"
+
+var db *sql.DB
+
+// Comment is written by a reader under an article, or by the admin in reply
+// to a reader.
+type Comment struct {
+	CommentId int64
+	PostId    int64
+	ParentId  int64
+	Author    string
+	Email     string
+	Content   string
+	Html      template.HTML
+	Status    string
+	FromAdmin bool
+	CreatedAt int64
+	Replies   []Comment
+	// the article, linked from the moderation queue
+	PostTitle    string
+	PostLanguage string
+	PostSlug     string
+}
+
+func Init() {
+	db = database.Get()
+}
+
+// DateIso is the creation date in the format of the datetime attributes.
+func (comment Comment) DateIso() string {
+	return time.Unix(comment.CreatedAt, 0).UTC().Format(time.RFC3339)
+}
+
+// DateHuman is the creation date shown next to the comment.
+func (comment Comment) DateHuman() string {
+	return time.Unix(comment.CreatedAt, 0).UTC().Format("2006-01-02 15:04")
+}
+
+// Add saves the comment of a reader on a public article, it waits for the
+// moderation. A comment caught by the spam trap is saved as spam.
+func Add(postId int64, author string, email string, content string, trapped bool) (Comment, error) {
+	author = strings.TrimSpace(author)
+	content = strings.TrimSpace(content)
+
+	err := validate(author, content)
+
+	if err != nil {
+		return Comment{}, err
+	}
+
+	post, err := blog.GetPostById(postId)
+
+	if errors.Is(err, blog.ErrNotFound) || (err == nil && !post.IsVisible()) {
+		return Comment{}, ErrPostNotFound
+	} else if err != nil {
+		return Comment{}, err
+	}
+
+	comment := Comment{
+		PostId:       postId,
+		Author:       author,
+		Email:        strings.TrimSpace(email),
+		Content:      content,
+		Html:         Render(content),
+		Status:       StatusPending,
+		CreatedAt:    time.Now().Unix(),
+		PostTitle:    post.Title,
+		PostLanguage: post.Language,
+		PostSlug:     post.Slug,
+	}
+
+	if trapped {
+		comment.Status = StatusSpam
+	}
+
+	comment, err = insert(comment)
+
+	// the reader doesn't wait for the mail server
+	if err == nil && !trapped {
+		go notifyAdmin(comment)
+	}
+
+	return comment, err
+}
+
+// Reply saves the answer of the admin to a comment, it is published right
+// away and the comment answered gets approved as well.
+func Reply(parentId int64, content string) (Comment, error) {
+	content = strings.TrimSpace(content)
+
+	if content == "" {
+		return Comment{}, ErrContentMissing
+	}
+
+	if utf8.RuneCountInString(content) > MaxContentLength {
+		return Comment{}, ErrTooLong
+	}
+
+	parent, err := Get(parentId)
+
+	if err != nil {
+		return Comment{}, err
+	}
+
+	if parent.Status != StatusApproved {
+		_, err = SetStatus(parentId, StatusApproved)
+
+		if err != nil {
+			return Comment{}, err
+		}
+	}
+
+	post, err := blog.GetPostById(parent.PostId)
+
+	if err != nil {
+		return Comment{}, err
+	}
+
+	// the replies are attached to the first comment of the thread
+	threadId := parent.CommentId
+
+	if parent.ParentId != 0 {
+		threadId = parent.ParentId
+	}
+
+	reply, err := insert(Comment{
+		PostId:    parent.PostId,
+		ParentId:  threadId,
+		Author:    post.Author,
+		Content:   content,
+		Html:      Render(content),
+		Status:    StatusApproved,
+		FromAdmin: true,
+		CreatedAt: time.Now().Unix(),
+	})
+
+	if err != nil {
+		return Comment{}, err
+	}
+
+	return Get(reply.CommentId)
+}
+
+func validate(author string, content string) error {
+	if author == "" {
+		return ErrAuthorMissing
+	}
+
+	if content == "" {
+		return ErrContentMissing
+	}
+
+	if utf8.RuneCountInString(author) > MaxAuthorLength || utf8.RuneCountInString(content) > MaxContentLength {
+		return ErrTooLong
+	}
+
+	return nil
+}
+
+func insert(comment Comment) (Comment, error) {
+	var parentId any
+
+	if comment.ParentId != 0 {
+		parentId = comment.ParentId
+	}
+
+	result, err := db.Exec("INSERT INTO comment (post_id, parent_id, author, email, content, html, status, from_admin, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		comment.PostId, parentId, comment.Author, comment.Email, comment.Content, string(comment.Html), comment.Status, comment.FromAdmin, comment.CreatedAt)
+
+	if err != nil {
+		log.Print(err)
+		return Comment{}, err
+	}
+
+	comment.CommentId, err = result.LastInsertId()
+
+	return comment, err
+}
+
+// Get returns the comment with the title of its article.
+func Get(id int64) (Comment, error) {
+	row := db.QueryRow("SELECT "+commentColumns+" FROM "+commentTables+" WHERE comment_id = ?", id)
+
+	return scanComment(row)
+}
+
+func scanComment(row interface{ Scan(...any) error }) (Comment, error) {
+	comment := Comment{}
+	var html string
+
+	err := row.Scan(&comment.CommentId, &comment.PostId, &comment.ParentId, &comment.Author, &comment.Email, &comment.Content, &html, &comment.Status, &comment.FromAdmin, &comment.CreatedAt, &comment.PostTitle, &comment.PostLanguage, &comment.PostSlug)
+	comment.Html = template.HTML(html)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Comment{}, ErrNotFound
+	} else if err != nil {
+		log.Print(err)
+		return Comment{}, err
+	}
+
+	return comment, nil
+}
+
+// ListApproved returns the approved comments of the article, oldest first,
+// with their replies.
+func ListApproved(postId int64) ([]Comment, error) {
+	rows, err := db.Query("SELECT "+commentColumns+" FROM "+commentTables+" WHERE comment.post_id = ? AND comment.status = ? ORDER BY comment.created_at, comment.comment_id", postId, StatusApproved)
+
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var threads []Comment
+	replies := map[int64][]Comment{}
+
+	for rows.Next() {
+		comment, err := scanComment(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if comment.ParentId == 0 {
+			threads = append(threads, comment)
+		} else {
+			replies[comment.ParentId] = append(replies[comment.ParentId], comment)
+		}
+	}
+
+	for i := range threads {
+		threads[i].Replies = replies[threads[i].CommentId]
+	}
+
+	return threads, rows.Err()
+}
+
+// ListByStatus returns the comments with the status, the newest first, for
+// the moderation queue.
+func ListByStatus(status string) ([]Comment, error) {
+	rows, err := db.Query("SELECT "+commentColumns+" FROM "+commentTables+" WHERE comment.status = ? ORDER BY comment.created_at DESC, comment.comment_id DESC", status)
+
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var comments []Comment
+
+	for rows.Next() {
+		comment, err := scanComment(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// CountPending is the number of comments waiting for the moderation.
+func CountPending() (int, error) {
+	var count int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM comment WHERE status = ?", StatusPending).Scan(&count)
+
+	return count, err
+}
+
+// SetStatus approves a comment or marks it as spam.
+func SetStatus(id int64, status string) (Comment, error) {
+	if status != StatusPending && status != StatusApproved && status != StatusSpam {
+		return Comment{}, ErrInvalidStatus
+	}
+
+	result, err := db.Exec("UPDATE comment SET status = ? WHERE comment_id = ?", status, id)
+
+	if err != nil {
+		log.Print(err)
+		return Comment{}, err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return Comment{}, ErrNotFound
+	}
+
+	return Get(id)
+}
+
+// Delete removes the comment and its replies.
+func Delete(id int64) error {
+	result, err := db.Exec("DELETE FROM comment WHERE comment_id = ?", id)
+
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package comment
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"valette.software/internal/database/databasetest"
+)
+
+// openTestDatabase points the package to a freshly migrated database holding
+// one post.
+func openTestDatabase(t *testing.T) int64 {
+	conn := databasetest.Open(t)
+
+	db = conn
+
+	result, err := db.Exec("INSERT INTO post (title, language, author, timestamp, slug, summary, content) VALUES ('Title', 'en', 'Author', 0, 'title', '', '')")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postId, _ := result.LastInsertId()
+
+	return postId
+}
+
+func TestRender(t *testing.T) {
+	type data struct {
+		input    string
+		contains []string
+		excludes []string
+	}
+
+	testData := []data{
+		{"**bold** and _italic_", []string{"<strong>bold</strong>", "<em>italic</em>"}, nil},
+		{"<script>alert(1)</script>", nil, []string{"<script"}},
+		{"text <img src=x onerror=alert(1)> text", nil, []string{"<img", "onerror"}},
+		{"![image](https://example.com/a.png)", nil, []string{"<img"}},
+		{"[link](javascript:alert(1))", nil, []string{"href", "javascript:alert"}},
+		{"[link](https://example.com)", []string{`href="https://example.com"`, "nofollow"}, nil},
+		{"```x\"onmouseover=alert(1)\ncode\n```", []string{"<pre><code>code\n</code></pre>"}, []string{"onmouseover"}},
+		{"# Title", []string{"<p><strong>Title</strong></p>"}, []string{"<h1"}},
+		{"a {#id .class}", nil, []string{`id="id"`}},
+	}
+
+	for _, test := range testData {
+		output := string(Render(test.input))
+
+		for _, expected := range test.contains {
+			if !strings.Contains(output, expected) {
+				t.Errorf("expected %s in the rendering of %s, got %s", expected, test.input, output)
+			}
+		}
+
+		for _, unexpected := range test.excludes {
+			if strings.Contains(output, unexpected) {
+				t.Errorf("expected no %s in the rendering of %s, got %s", unexpected, test.input, output)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type data struct {
+		author  string
+		content string
+		err     error
+	}
+
+	testData := []data{
+		{"Reader", "Nice article", nil},
+		{"", "Nice article", ErrAuthorMissing},
+		{"Reader", "", ErrContentMissing},
+		{"Reader", strings.Repeat("a", MaxContentLength+1), ErrTooLong},
+		{strings.Repeat("a", MaxAuthorLength+1), "Nice article", ErrTooLong},
+	}
+
+	for _, test := range testData {
+		if err := validate(test.author, test.content); !errors.Is(err, test.err) {
+			t.Errorf("expected %v for %q, got %v", test.err, test.author, err)
+		}
+	}
+}
+
+func TestModeration(t *testing.T) {
+	postId := openTestDatabase(t)
+
+	first, err := insert(Comment{PostId: postId, Author: "Reader", Content: "First", Html: Render("First"), Status: StatusPending, CreatedAt: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := insert(Comment{PostId: postId, Author: "Spammer", Content: "Buy", Status: StatusPending, CreatedAt: 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if comments, _ := ListApproved(postId); len(comments) != 0 {
+		t.Errorf("expected the pending comments to be hidden, got %+v", comments)
+	}
+
+	if pending, _ := ListByStatus(StatusPending); len(pending) != 2 || pending[0].CommentId != second.CommentId || pending[0].PostTitle != "Title" {
+		t.Errorf("expected the queue to list the newest comment first with its article, got %+v", pending)
+	}
+
+	if _, err := SetStatus(first.CommentId, StatusApproved); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SetStatus(second.CommentId, StatusSpam); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SetStatus(second.CommentId, "deleted"); !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("expected ErrInvalidStatus, got %v", err)
+	}
+
+	_, err = insert(Comment{PostId: postId, ParentId: first.CommentId, Author: "Author", Content: "Thanks", Status: StatusApproved, FromAdmin: true, CreatedAt: 3})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comments, err := ListApproved(postId)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(comments) != 1 || comments[0].CommentId != first.CommentId {
+		t.Fatalf("expected the approved comment only, got %+v", comments)
+	}
+
+	if len(comments[0].Replies) != 1 || !comments[0].Replies[0].FromAdmin {
+		t.Errorf("expected the reply of the admin under the comment, got %+v", comments[0].Replies)
+	}
+
+	if count, _ := CountPending(); count != 0 {
+		t.Errorf("expected no pending comment, got %d", count)
+	}
+
+	if err := Delete(first.CommentId); err != nil {
+		t.Fatal(err)
+	}
+
+	if comments, _ := ListApproved(postId); len(comments) != 0 {
+		t.Errorf("expected the replies to be deleted with the comment, got %+v", comments)
+	}
+
+	if err := Delete(first.CommentId); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package comment
+
+import (
+	"log"
+	"net/smtp"
+
+	"valette.software/internal/config"
+)
+
+// sendMail is replaced in the tests, which have no mail server.
+var sendMail = smtp.SendMail
+
+// notifyAdmin tells the admin a comment waits for the moderation. A comment
+// is saved even if the mail can't be sent, it shows in the queue anyway.
+func notifyAdmin(comment Comment) {
+	conf := config.GetConfig()
+	smtpData := conf.GetSmtp()
+
+	if smtpData.Host == "" || len(smtpData.To) == 0 {
+		return
+	}
+
+	message := "From: " + smtpData.From + "\nTo: " + smtpData.To[0] + "\nSubject: valette.software - comment on " + comment.PostTitle +
+		"\n\nName: " + comment.Author + "\nContact: " + comment.Email +
+		"\nArticle: " + conf.GetBaseUrl() + "/" + comment.PostLanguage + "/articles/" + comment.PostSlug +
+		"\nModeration: " + conf.GetBaseUrl() + "/admin/comments\n\n" + comment.Content
+
+	err := sendMail(smtpData.Host+":"+smtpData.Port, conf.GetSmtpAuth(), smtpData.From, smtpData.To, []byte(message))
+
+	if err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,51 @@
+package comment
+
+import (
+	"html"
+	"html/template"
+	"io"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	mdhtml "github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// extensions are the Markdown features a reader can use, without the
+// attributes, the heading IDs or anything else writing raw attributes.
+const extensions = parser.NoIntraEmphasis | parser.FencedCode | parser.Autolink | parser.Strikethrough | parser.SpaceHeadings
+
+// flags drop the raw HTML and the images, keep only the links to the web and
+// the mail addresses, and tell the search engines not to follow them.
+const flags = mdhtml.SkipHTML | mdhtml.SkipImages | mdhtml.Safelink | mdhtml.NofollowLinks | mdhtml.NoreferrerLinks
+
+// Render turns the Markdown of a reader into HTML safe to publish.
+func Render(content string) template.HTML {
+	// the parser and the renderer keep the state of the document they
+	// process, they can't be shared
+	renderer := mdhtml.NewRenderer(mdhtml.RendererOptions{Flags: flags, RenderNodeHook: renderNode})
+	doc := parser.NewWithExtensions(extensions).Parse([]byte(content))
+
+	return template.HTML(markdown.Render(doc, renderer))
+}
+
+// renderNode writes the code blocks without the class of their language,
+// which the default renderer doesn't escape, and the headings as bold
+// paragraphs, the comments must not compete with the titles of the article.
+func renderNode(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	switch node := node.(type) {
+	case *ast.CodeBlock:
+		io.WriteString(w, "<pre><code>"+html.EscapeString(string(node.Literal))+"</code></pre>\n")
+		return ast.GoToNext, true
+	case *ast.Heading:
+		if entering {
+			io.WriteString(w, "<p><strong>")
+		} else {
+			io.WriteString(w, "</strong></p>\n")
+		}
+
+		return ast.GoToNext, true
+	}
+
+	return ast.GoToNext, false
+}
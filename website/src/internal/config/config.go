@@ -18,13 +18,15 @@ type Configurator interface {
 	GetSmtpAuth() smtp.Auth
 	GetSmtp() SmtpData
 	GetAdminPassword() string
-	setData(data SmtpData, auth smtp.Auth, adminPassword string)
+	GetBaseUrl() string
+	setData(data SmtpData, auth smtp.Auth, adminPassword string, baseUrl string)
 }
 
 type Config struct {
 	smtpAuth      smtp.Auth
 	smtpData      SmtpData
 	adminPassword string
+	baseUrl       string
 }
 
 type SmtpData struct {
@@ -50,10 +52,17 @@ func (c Config) GetAdminPassword() string {
 	return c.adminPassword
 }
 
-func (c *Config) setData(data SmtpData, auth smtp.Auth, adminPassword string) {
+// GetBaseUrl is the scheme and host the website is published at, without
+// trailing slash, it is used where links must be absolute.
+func (c Config) GetBaseUrl() string {
+	return c.baseUrl
+}
+
+func (c *Config) setData(data SmtpData, auth smtp.Auth, adminPassword string, baseUrl string) {
 	c.smtpData = data
 	c.smtpAuth = auth
 	c.adminPassword = adminPassword
+	c.baseUrl = baseUrl
 }
 
 func getValue(line string) (string, string, error) {
@@ -86,6 +95,7 @@ func Init() {
 	data, err := os.ReadFile("/etc/valettesoftware/valettesoftware.conf")
 	smtpData := SmtpData{}
 	adminPassword := ""
+	baseUrl := "https://valette.software"
 
 	if err != nil {
 		log.Fatal(err)
@@ -113,6 +123,8 @@ func Init() {
 			smtpData.User = value
 		case "admin_password":
 			adminPassword = value
+		case "base_url":
+			baseUrl = strings.TrimSuffix(value, "/")
 		default:
 			log.Printf("the key '%s' is unknown", key)
 		}
@@ -122,7 +134,7 @@ func Init() {
 		log.Fatal("admin_password not found in config file /etc/valettesoftware/valettesoftware.conf")
 	}
 
-	config.setData(smtpData, smtp.PlainAuth("", smtpData.User, smtpData.Password, smtpData.Host), adminPassword)
+	config.setData(smtpData, smtp.PlainAuth("", smtpData.User, smtpData.Password, smtpData.Host), adminPassword, baseUrl)
 }
 
 func GetConfig() Configurator {
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+const DataDir = "/var/lib/valettesoftware"
+
+var db *sql.DB
+
+func Init() {
+	var err error
+
+	db, err = Open(filepath.Join(DataDir, "blog.db"))
+
+	if err != nil {
+		log.Fatal("couldn't open the database: ", err)
+	}
+}
+
+func Get() *sql.DB {
+	return db
+}
+
+// Set makes conn the database returned by Get.
+func Set(conn *sql.DB) {
+	db = conn
+}
+
+// Open connects to the SQLite file at path and brings its schema up to date.
+func Open(path string) (*sql.DB, error) {
+	conn, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := loadMigrations(fsMigration)
+
+	if err == nil {
+		err = migrate(conn, migrations)
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
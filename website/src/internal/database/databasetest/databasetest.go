@@ -0,0 +1,26 @@
+// Package databasetest opens the databases of the tests.
+package databasetest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"valette.software/internal/database"
+)
+
+// Open connects the test to a freshly migrated database of its own, closed
+// when it ends.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+
+	conn, err := database.Open(filepath.Join(t.TempDir(), "blog.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
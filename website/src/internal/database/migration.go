@@ -0,0 +1,119 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migration/*.sql
+var fsMigration embed.FS
+
+var ErrSchemaTooNew = errors.New("the database schema is newer than this binary")
+var errMigrationName = errors.New("migration files must be named 'NNNN_description.sql'")
+var errMigrationGap = errors.New("migration versions must follow each other without gap")
+
+type migration struct {
+	version int
+	name    string
+	script  string
+}
+
+// loadMigrations reads the scripts in the "migration" directory of fsys,
+// ordered by the version number prefixing their name.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, "migration")
+
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(entries))
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+
+		prefix, _, found := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+
+		if !found || err != nil || version < 1 {
+			return nil, fmt.Errorf("%w: %s", errMigrationName, name)
+		}
+
+		script, err := fs.ReadFile(fsys, "migration/"+name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{version: version, name: name, script: string(script)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("%w: expected version %d, got %s", errMigrationGap, i+1, m.name)
+		}
+	}
+
+	return migrations, nil
+}
+
+// migrate applies the migrations newer than the schema version recorded in
+// the database, all in a single transaction.
+func migrate(conn *sql.DB, migrations []migration) error {
+	tx, err := conn.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec("CREATE TABLE IF NOT EXISTS schema_version (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at INTEGER NOT NULL)")
+
+	if err != nil {
+		return err
+	}
+
+	var current int
+
+	err = tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current)
+
+	if err != nil {
+		return err
+	}
+
+	if current > len(migrations) {
+		return fmt.Errorf("%w: database is at version %d, the latest known is %d", ErrSchemaTooNew, current, len(migrations))
+	}
+
+	for _, m := range migrations[current:] {
+		_, err = tx.Exec(m.script)
+
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.name, err)
+		}
+
+		_, err = tx.Exec("INSERT INTO schema_version(version, name, applied_at) VALUES(?, ?, ?)", m.version, m.name, time.Now().Unix())
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
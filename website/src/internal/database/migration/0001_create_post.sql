@@ -0,0 +1,11 @@
+-- the post table predates the migrations, IF NOT EXISTS adopts existing databases
+CREATE TABLE IF NOT EXISTS post (
+  post_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  title TEXT NOT NULL,
+  language TEXT NOT NULL,
+  author TEXT NOT NULL,
+  timestamp INTEGER NOT NULL,
+  slug TEXT NOT NULL,
+  summary TEXT NOT NULL,
+  content TEXT NOT NULL
+);
@@ -0,0 +1,5 @@
+ALTER TABLE post ADD COLUMN status TEXT NOT NULL DEFAULT 'draft';
+ALTER TABLE post ADD COLUMN publish_at INTEGER NOT NULL DEFAULT 0;
+
+-- every post written before the statuses existed was public
+UPDATE post SET status = 'published', publish_at = timestamp;
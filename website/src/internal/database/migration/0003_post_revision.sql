@@ -0,0 +1,21 @@
+CREATE TABLE post_revision (
+  revision_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  post_id INTEGER NOT NULL REFERENCES post(post_id) ON DELETE CASCADE,
+  editor TEXT NOT NULL,
+  created_at INTEGER NOT NULL,
+  title TEXT NOT NULL,
+  language TEXT NOT NULL,
+  author TEXT NOT NULL,
+  timestamp INTEGER NOT NULL,
+  slug TEXT NOT NULL,
+  summary TEXT NOT NULL,
+  content TEXT NOT NULL,
+  status TEXT NOT NULL,
+  publish_at INTEGER NOT NULL
+);
+
+CREATE INDEX post_revision_post_id ON post_revision(post_id);
+
+-- the current state of the existing posts is their first revision
+INSERT INTO post_revision(post_id, editor, created_at, title, language, author, timestamp, slug, summary, content, status, publish_at)
+SELECT post_id, author, unixepoch(), title, language, author, timestamp, slug, summary, content, status, publish_at FROM post;
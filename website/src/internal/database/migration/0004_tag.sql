@@ -0,0 +1,19 @@
+CREATE TABLE tag (
+  tag_id INTEGER PRIMARY KEY AUTOINCREMENT
+);
+
+-- a tag is named in every language it is used in
+CREATE TABLE tag_name (
+  tag_id INTEGER NOT NULL REFERENCES tag(tag_id) ON DELETE CASCADE,
+  language TEXT NOT NULL,
+  name TEXT NOT NULL,
+  slug TEXT NOT NULL,
+  PRIMARY KEY (tag_id, language),
+  UNIQUE (language, slug)
+);
+
+CREATE TABLE post_tag (
+  post_id INTEGER NOT NULL REFERENCES post(post_id) ON DELETE CASCADE,
+  tag_id INTEGER NOT NULL REFERENCES tag(tag_id) ON DELETE CASCADE,
+  PRIMARY KEY (post_id, tag_id)
+);
@@ -0,0 +1,24 @@
+-- full-text index of the posts, remove_diacritics lets "securite" match "sécurité"
+CREATE VIRTUAL TABLE post_search USING fts5(
+  title,
+  summary,
+  content,
+  content = 'post',
+  content_rowid = 'post_id',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER post_search_insert AFTER INSERT ON post BEGIN
+  INSERT INTO post_search(rowid, title, summary, content) VALUES (new.post_id, new.title, new.summary, new.content);
+END;
+
+CREATE TRIGGER post_search_delete AFTER DELETE ON post BEGIN
+  INSERT INTO post_search(post_search, rowid, title, summary, content) VALUES ('delete', old.post_id, old.title, old.summary, old.content);
+END;
+
+CREATE TRIGGER post_search_update AFTER UPDATE OF title, summary, content ON post BEGIN
+  INSERT INTO post_search(post_search, rowid, title, summary, content) VALUES ('delete', old.post_id, old.title, old.summary, old.content);
+  INSERT INTO post_search(rowid, title, summary, content) VALUES (new.post_id, new.title, new.summary, new.content);
+END;
+
+INSERT INTO post_search(post_search) VALUES ('rebuild');
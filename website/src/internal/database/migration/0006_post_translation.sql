@@ -0,0 +1,4 @@
+-- the posts sharing a translation group are translations of each other
+ALTER TABLE post ADD COLUMN translation_group INTEGER;
+
+CREATE INDEX post_translation_group ON post(translation_group);
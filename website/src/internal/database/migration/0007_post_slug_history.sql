@@ -0,0 +1,9 @@
+-- the former slugs of the posts, to redirect the links already shared
+CREATE TABLE post_slug_history (
+  language TEXT NOT NULL,
+  slug TEXT NOT NULL,
+  post_id INTEGER NOT NULL REFERENCES post(post_id) ON DELETE CASCADE,
+  PRIMARY KEY (language, slug)
+);
+
+CREATE INDEX post_language_slug ON post(language, slug);
@@ -0,0 +1,11 @@
+CREATE TABLE media (
+  media_id INTEGER PRIMARY KEY,
+  filename TEXT NOT NULL UNIQUE,
+  original_name TEXT NOT NULL,
+  mime_type TEXT NOT NULL,
+  size INTEGER NOT NULL,
+  alt TEXT NOT NULL DEFAULT '',
+  width INTEGER NOT NULL DEFAULT 0,
+  height INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL
+);
@@ -0,0 +1,8 @@
+-- the resized copies of an image, offered to the browsers in its srcset
+CREATE TABLE media_variant (
+  media_id INTEGER NOT NULL REFERENCES media(media_id) ON DELETE CASCADE,
+  width INTEGER NOT NULL,
+  height INTEGER NOT NULL,
+  filename TEXT NOT NULL UNIQUE,
+  PRIMARY KEY (media_id, width)
+);
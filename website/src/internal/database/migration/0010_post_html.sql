@@ -0,0 +1,4 @@
+-- the content rendered in HTML when the post is saved, html_version is the
+-- version of the renderer that produced it, 0 for the posts to render again
+ALTER TABLE post ADD COLUMN html TEXT NOT NULL DEFAULT '';
+ALTER TABLE post ADD COLUMN html_version INTEGER NOT NULL DEFAULT 0;
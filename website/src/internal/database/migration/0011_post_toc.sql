@@ -0,0 +1,4 @@
+-- computed with the HTML when the post is saved, toc is a JSON array of
+-- the headings
+ALTER TABLE post ADD COLUMN toc TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE post ADD COLUMN word_count INTEGER NOT NULL DEFAULT 0;
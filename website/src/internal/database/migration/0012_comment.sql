@@ -0,0 +1,16 @@
+-- the comments of the readers, published once the admin approved them, the
+-- replies of the admin point to the comment they answer
+CREATE TABLE comment (
+  comment_id INTEGER PRIMARY KEY,
+  post_id INTEGER NOT NULL REFERENCES post(post_id) ON DELETE CASCADE,
+  parent_id INTEGER REFERENCES comment(comment_id) ON DELETE CASCADE,
+  author TEXT NOT NULL,
+  email TEXT NOT NULL DEFAULT '',
+  content TEXT NOT NULL,
+  html TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'spam')),
+  from_admin INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL
+);
+CREATE INDEX comment_post ON comment(post_id, status);
+CREATE INDEX comment_status ON comment(status, created_at);
@@ -0,0 +1,25 @@
+-- the mentions of the articles received from other sites, checked in the
+-- background then moderated like the comments
+CREATE TABLE webmention (
+  webmention_id INTEGER PRIMARY KEY,
+  post_id INTEGER NOT NULL REFERENCES post(post_id) ON DELETE CASCADE,
+  source TEXT NOT NULL,
+  target TEXT NOT NULL,
+  title TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'unverified' CHECK (status IN ('unverified', 'invalid', 'pending', 'approved', 'spam')),
+  created_at INTEGER NOT NULL,
+  verified_at INTEGER NOT NULL DEFAULT 0,
+  UNIQUE (source, target)
+);
+CREATE INDEX webmention_post ON webmention(post_id, status);
+
+-- the mentions sent for the external links of the articles, each link is
+-- notified once
+CREATE TABLE webmention_sent (
+  post_id INTEGER NOT NULL REFERENCES post(post_id) ON DELETE CASCADE,
+  target TEXT NOT NULL,
+  endpoint TEXT NOT NULL DEFAULT '',
+  result TEXT NOT NULL DEFAULT '',
+  sent_at INTEGER NOT NULL,
+  PRIMARY KEY (post_id, target)
+);
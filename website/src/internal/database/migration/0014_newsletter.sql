@@ -0,0 +1,31 @@
+-- the readers subscribed to the newsletter of a language, confirmed by the
+-- link mailed to them
+CREATE TABLE subscriber (
+  subscriber_id INTEGER PRIMARY KEY,
+  email TEXT NOT NULL,
+  language TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'confirmed', 'unsubscribed')),
+  created_at INTEGER NOT NULL,
+  confirmation_sent_at INTEGER NOT NULL DEFAULT 0,
+  confirmed_at INTEGER NOT NULL DEFAULT 0,
+  UNIQUE (email, language)
+);
+
+-- a post mailed to a subscriber, sent one after the other in the background
+CREATE TABLE newsletter_delivery (
+  delivery_id INTEGER PRIMARY KEY,
+  post_id INTEGER NOT NULL REFERENCES post(post_id) ON DELETE CASCADE,
+  subscriber_id INTEGER NOT NULL REFERENCES subscriber(subscriber_id) ON DELETE CASCADE,
+  status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'sent', 'failed')),
+  error TEXT NOT NULL DEFAULT '',
+  created_at INTEGER NOT NULL,
+  sent_at INTEGER NOT NULL DEFAULT 0,
+  UNIQUE (post_id, subscriber_id)
+);
+CREATE INDEX newsletter_delivery_status ON newsletter_delivery(status, delivery_id);
+
+-- the keys generated on the first start, signing the links sent by mail
+CREATE TABLE secret (
+  name TEXT PRIMARY KEY,
+  value BLOB NOT NULL
+);
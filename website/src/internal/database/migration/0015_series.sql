@@ -0,0 +1,16 @@
+-- a series groups posts of one language meant to be read in order
+CREATE TABLE series (
+  series_id INTEGER PRIMARY KEY,
+  language TEXT NOT NULL,
+  title TEXT NOT NULL,
+  slug TEXT NOT NULL,
+  UNIQUE (language, slug)
+);
+
+-- a post is a part of at most one series, the parts are sorted by position
+CREATE TABLE post_series (
+  post_id INTEGER PRIMARY KEY REFERENCES post(post_id) ON DELETE CASCADE,
+  series_id INTEGER NOT NULL REFERENCES series(series_id) ON DELETE CASCADE,
+  position INTEGER NOT NULL
+);
+CREATE INDEX post_series_position ON post_series(series_id, position);
@@ -0,0 +1,13 @@
+-- the accounts of the admin area, the first owner is created from the
+-- password of the configuration file
+CREATE TABLE user (
+  user_id INTEGER PRIMARY KEY,
+  username TEXT NOT NULL UNIQUE,
+  display_name TEXT NOT NULL,
+  password_hash TEXT NOT NULL,
+  role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'contributor')),
+  created_at INTEGER NOT NULL
+);
+
+-- the account which created the post, the contributors only edit theirs
+ALTER TABLE post ADD COLUMN user_id INTEGER REFERENCES user(user_id) ON DELETE SET NULL;
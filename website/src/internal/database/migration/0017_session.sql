@@ -0,0 +1,13 @@
+-- the sessions of the admin area, they outlive the restarts. Only the hash
+-- of the token of the cookie is kept, a copy of the database opens none.
+CREATE TABLE session (
+  session_id INTEGER PRIMARY KEY,
+  token_hash TEXT NOT NULL UNIQUE,
+  user_id INTEGER NOT NULL REFERENCES user(user_id) ON DELETE CASCADE,
+  created_at INTEGER NOT NULL,
+  last_seen_at INTEGER NOT NULL,
+  user_agent TEXT NOT NULL DEFAULT '',
+  ip TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX session_user_id ON session(user_id);
@@ -0,0 +1,22 @@
+-- the second factor of the users, enabled once a first code is typed.
+-- last_step is the step of the last code accepted, it isn't accepted again
+CREATE TABLE user_totp (
+  user_id INTEGER PRIMARY KEY REFERENCES user(user_id) ON DELETE CASCADE,
+  secret TEXT NOT NULL,
+  enabled_at INTEGER NOT NULL DEFAULT 0,
+  last_step INTEGER NOT NULL DEFAULT 0
+);
+
+-- the codes used once instead of the second factor, when the phone is lost
+CREATE TABLE recovery_code (
+  recovery_code_id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES user(user_id) ON DELETE CASCADE,
+  code_hash TEXT NOT NULL,
+  used_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX recovery_code_user_id ON recovery_code(user_id);
+
+-- a session opened with the password only waits for the second factor
+ALTER TABLE session ADD COLUMN pending INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE session ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;
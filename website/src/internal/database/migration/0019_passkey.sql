@@ -0,0 +1,22 @@
+-- the passkeys of the users, found by the ID of their credential. The
+-- signature counter tells the cloned authenticators
+CREATE TABLE passkey (
+  passkey_id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES user(user_id) ON DELETE CASCADE,
+  credential_id TEXT NOT NULL UNIQUE,
+  public_key BLOB NOT NULL,
+  sign_count INTEGER NOT NULL DEFAULT 0,
+  name TEXT NOT NULL DEFAULT '',
+  created_at INTEGER NOT NULL,
+  last_used_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX passkey_user_id ON passkey(user_id);
+
+-- the challenges sent to the browsers, each is signed once. The ones of the
+-- logins have no user, it is known from the passkey
+CREATE TABLE webauthn_challenge (
+  challenge TEXT PRIMARY KEY,
+  user_id INTEGER REFERENCES user(user_id) ON DELETE CASCADE,
+  created_at INTEGER NOT NULL
+);
@@ -0,0 +1,6 @@
+-- the mentions sent are recorded for the address of the article they were
+-- sent from, a new slug notifies the links again. The rows sent before are
+-- taken for the current address. The targets which couldn't be reached are
+-- recorded too, they are tried again later instead of at every change
+ALTER TABLE webmention_sent ADD COLUMN source TEXT NOT NULL DEFAULT '';
+ALTER TABLE webmention_sent ADD COLUMN reached INTEGER NOT NULL DEFAULT 1;
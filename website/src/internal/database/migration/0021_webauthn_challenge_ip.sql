@@ -0,0 +1,5 @@
+-- the address which started a passkey login, the challenges of the logins
+-- waiting for their signature are counted for each address
+ALTER TABLE webauthn_challenge ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX webauthn_challenge_ip ON webauthn_challenge(ip) WHERE user_id IS NULL;
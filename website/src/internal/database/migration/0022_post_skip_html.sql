@@ -0,0 +1,5 @@
+-- the HTML typed in the posts of the contributors is not rendered, it would
+-- run in the sessions of the editors reading their drafts
+ALTER TABLE post ADD COLUMN skip_html INTEGER NOT NULL DEFAULT 0;
+
+UPDATE post SET skip_html = 1 WHERE user_id IN (SELECT user_id FROM user WHERE role = 'contributor');
@@ -0,0 +1,5 @@
+-- the wrong codes typed in a row for the second factor of the user, whatever
+-- the session they come from. Every few of them lock the second factor until
+-- locked_until, for longer each time
+ALTER TABLE user_totp ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_totp ADD COLUMN locked_until INTEGER NOT NULL DEFAULT 0;
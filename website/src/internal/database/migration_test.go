@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func openEmpty(t *testing.T) *sql.DB {
+	conn, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func schemaVersion(t *testing.T, conn *sql.DB) int {
+	var version int
+
+	err := conn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return version
+}
+
+func TestLoadMigrationsOrder(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migration/0002_second.sql": {Data: []byte("SELECT 2;")},
+		"migration/0001_first.sql":  {Data: []byte("SELECT 1;")},
+	}
+
+	migrations, err := loadMigrations(fsys)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 2 || migrations[0].name != "0001_first.sql" || migrations[1].name != "0002_second.sql" {
+		t.Errorf("expected the migrations to be sorted by version, got %v", migrations)
+	}
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	testData := []struct {
+		files    fstest.MapFS
+		expected error
+	}{
+		{fstest.MapFS{"migration/first.sql": {}}, errMigrationName},
+		{fstest.MapFS{"migration/0001_first.sql": {}, "migration/0003_third.sql": {}}, errMigrationGap},
+	}
+
+	for _, test := range testData {
+		_, err := loadMigrations(test.files)
+
+		if !errors.Is(err, test.expected) {
+			t.Errorf("expected error \"%s\", got \"%s\"", test.expected, err)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	conn, err := Open(filepath.Join(t.TempDir(), "blog.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Exec("SELECT post_id, title, language, author, timestamp, slug, summary, content FROM post")
+
+	if err != nil {
+		t.Errorf("expected the post table to exist, got %s", err)
+	}
+}
+
+func TestMigrateIsIncremental(t *testing.T) {
+	conn := openEmpty(t)
+
+	migrations := []migration{
+		{version: 1, name: "0001_a.sql", script: "CREATE TABLE a (id INTEGER);"},
+	}
+
+	if err := migrate(conn, migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations = append(migrations, migration{version: 2, name: "0002_b.sql", script: "CREATE TABLE b (id INTEGER);"})
+
+	if err := migrate(conn, migrations); err != nil {
+		t.Fatalf("expected the second run to only apply the new migration, got %s", err)
+	}
+
+	if version := schemaVersion(t, conn); version != 2 {
+		t.Errorf("expected schema version 2, got %d", version)
+	}
+}
+
+func TestMigrateRollsBack(t *testing.T) {
+	conn := openEmpty(t)
+
+	migrations := []migration{
+		{version: 1, name: "0001_a.sql", script: "CREATE TABLE a (id INTEGER);"},
+		{version: 2, name: "0002_broken.sql", script: "CREATE TABLE;"},
+	}
+
+	if err := migrate(conn, migrations); err == nil {
+		t.Fatal("expected the broken migration to fail")
+	}
+
+	var count int
+
+	conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'a'").Scan(&count)
+
+	if count != 0 {
+		t.Error("expected the first migration to be rolled back")
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	conn := openEmpty(t)
+
+	migrations := []migration{
+		{version: 1, name: "0001_a.sql", script: "CREATE TABLE a (id INTEGER);"},
+		{version: 2, name: "0002_b.sql", script: "CREATE TABLE b (id INTEGER);"},
+	}
+
+	if err := migrate(conn, migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(conn, migrations[:1]); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("expected ErrSchemaTooNew, got %s", err)
+	}
+}
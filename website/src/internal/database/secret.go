@@ -0,0 +1,28 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+)
+
+// secretSize is the number of random bytes of the generated secrets.
+const secretSize = 32
+
+// LoadSecret returns the secret key called name, generated the first time it
+// is asked for and kept in the database afterwards.
+func LoadSecret(conn *sql.DB, name string) ([]byte, error) {
+	generated := make([]byte, secretSize)
+	rand.Read(generated)
+
+	_, err := conn.Exec("INSERT INTO secret (name, value) VALUES (?, ?) ON CONFLICT DO NOTHING", name, generated)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var value []byte
+
+	err = conn.QueryRow("SELECT value FROM secret WHERE name = ?", name).Scan(&value)
+
+	return value, err
+}
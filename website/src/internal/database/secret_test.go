@@ -0,0 +1,35 @@
+package database
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSecret(t *testing.T) {
+	conn, err := Open(filepath.Join(t.TempDir(), "blog.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	first, err := LoadSecret(conn, "newsletter")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first) != secretSize {
+		t.Errorf("expected a secret of %d bytes, got %d", secretSize, len(first))
+	}
+
+	if again, _ := LoadSecret(conn, "newsletter"); !bytes.Equal(first, again) {
+		t.Errorf("expected the secret to be kept")
+	}
+
+	if other, _ := LoadSecret(conn, "other"); bytes.Equal(first, other) {
+		t.Errorf("expected every secret to be generated")
+	}
+}
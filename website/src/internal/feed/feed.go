@@ -0,0 +1,219 @@
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	"valette.software/internal/blog"
+)
+
+// Feed is the list of articles of one language, as syndicated in Atom and
+// RSS 2.0.
+type Feed struct {
+	Title   string
+	Lang    string
+	BaseUrl string
+	Posts   []blog.RenderedPost
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang    string      `xml:"xml:lang,attr"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	Id         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     atomAuthor     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary"`
+	Content    atomText       `xml:"content"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	Self          rssSelf   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssSelf struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Guid        rssGuid  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+// WriteAtom writes the feed in the Atom format.
+func WriteAtom(w io.Writer, feed Feed) error {
+	doc := atomFeed{
+		Lang:  feed.Lang,
+		Title: feed.Title,
+		Id:    feed.listUrl(),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: feed.listUrl() + "feed.atom"},
+			{Rel: "alternate", Type: "text/html", Href: feed.listUrl()},
+		},
+		Updated: feed.updated(),
+		Author:  atomAuthor{Name: "Valette Software"},
+	}
+
+	for _, post := range feed.Posts {
+		entry := atomEntry{
+			Title:     post.Title,
+			Id:        feed.postId(post),
+			Link:      atomLink{Rel: "alternate", Type: "text/html", Href: feed.postUrl(post)},
+			Published: post.DateIso,
+			Updated:   post.DateIso,
+			Author:    atomAuthor{Name: post.Author},
+			Summary:   post.Summary,
+			Content:   atomText{Type: "html", Value: string(post.Html)},
+		}
+
+		for _, tag := range post.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag.Slug, Label: tag.Name})
+		}
+
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return write(w, doc)
+}
+
+// WriteRss writes the feed in the RSS 2.0 format.
+func WriteRss(w io.Writer, feed Feed) error {
+	doc := rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       feed.Title,
+			Link:        feed.listUrl(),
+			Description: feed.Title,
+			Language:    feed.Lang,
+			Self:        rssSelf{Rel: "self", Type: "application/rss+xml", Href: feed.listUrl() + "feed.rss"},
+		},
+	}
+
+	if len(feed.Posts) > 0 {
+		doc.Channel.LastBuildDate = rssDate(feed.Posts[0])
+	}
+
+	for _, post := range feed.Posts {
+		item := rssItem{
+			Title:       post.Title,
+			Link:        feed.postUrl(post),
+			Guid:        rssGuid{IsPermaLink: false, Value: feed.postId(post)},
+			PubDate:     rssDate(post),
+			Description: string(post.Html),
+		}
+
+		for _, tag := range post.Tags {
+			item.Categories = append(item.Categories, tag.Name)
+		}
+
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+
+	return write(w, doc)
+}
+
+func write(w io.Writer, doc any) error {
+	_, err := io.WriteString(w, xml.Header)
+
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	return encoder.Encode(doc)
+}
+
+func (feed Feed) listUrl() string {
+	return feed.BaseUrl + "/" + feed.Lang + "/articles/"
+}
+
+func (feed Feed) postUrl(post blog.RenderedPost) string {
+	return feed.listUrl() + post.Slug
+}
+
+// postId identifies the post for the feed readers, it must not change
+// when the post's slug does.
+func (feed Feed) postId(post blog.RenderedPost) string {
+	host := feed.BaseUrl
+
+	if parsed, err := url.Parse(feed.BaseUrl); err == nil && parsed.Host != "" {
+		host = parsed.Hostname()
+	}
+
+	return "tag:" + host + ",2025:post-" + strconv.FormatInt(post.ArticleId, 10)
+}
+
+// updated is the date of the most recent post, the feed is sorted by date.
+func (feed Feed) updated() string {
+	if len(feed.Posts) == 0 {
+		return time.Unix(0, 0).UTC().Format(time.RFC3339)
+	}
+
+	return feed.Posts[0].DateIso
+}
+
+func rssDate(post blog.RenderedPost) string {
+	return time.Unix(post.Timestamp, 0).UTC().Format(time.RFC1123Z)
+}
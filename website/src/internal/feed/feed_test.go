@@ -0,0 +1,81 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"valette.software/internal/blog"
+)
+
+func testFeed() Feed {
+	post := blog.RenderedPost{
+		Post: blog.Post{ArticleId: 7, Language: "en", Slug: "hello", Title: "Hello & welcome", Author: "Mehdi", Timestamp: 1767225600, Summary: "A summary"},
+		Html: "<p>Some <em>content</em></p>",
+		Tags: []blog.Tag{{Name: "Linux", Slug: "linux"}},
+	}
+	post.DateIso = "2026-01-01T00:00:00Z"
+
+	return Feed{Title: "Articles", Lang: "en", BaseUrl: "https://valette.software", Posts: []blog.RenderedPost{post}}
+}
+
+func TestWriteAtom(t *testing.T) {
+	buf := bytes.Buffer{}
+
+	if err := WriteAtom(&buf, testFeed()); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := atomFeed{}
+
+	if err := xml.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("expected a valid XML document, got %s", err)
+	}
+
+	if len(parsed.Entries) != 1 {
+		t.Fatalf("expected one entry, got %d", len(parsed.Entries))
+	}
+
+	entry := parsed.Entries[0]
+
+	if entry.Title != "Hello & welcome" || entry.Content.Value != "<p>Some <em>content</em></p>" || entry.Content.Type != "html" {
+		t.Errorf("expected the title and the HTML content to survive the escaping, got %+v", entry)
+	}
+
+	if entry.Id != "tag:valette.software,2025:post-7" || entry.Link.Href != "https://valette.software/en/articles/hello" {
+		t.Errorf("expected a stable id and an absolute link, got \"%s\" and \"%s\"", entry.Id, entry.Link.Href)
+	}
+
+	if parsed.Updated != "2026-01-01T00:00:00Z" || entry.Published != "2026-01-01T00:00:00Z" {
+		t.Errorf("expected the dates of the post, got \"%s\" and \"%s\"", parsed.Updated, entry.Published)
+	}
+}
+
+func TestWriteRss(t *testing.T) {
+	buf := bytes.Buffer{}
+
+	if err := WriteRss(&buf, testFeed()); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := rssFeed{}
+
+	if err := xml.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("expected a valid XML document, got %s", err)
+	}
+
+	if parsed.Version != "2.0" || len(parsed.Channel.Items) != 1 {
+		t.Fatalf("expected an RSS 2.0 channel with one item, got %+v", parsed)
+	}
+
+	item := parsed.Channel.Items[0]
+
+	if item.PubDate != "Thu, 01 Jan 2026 00:00:00 +0000" || item.Description != "<p>Some <em>content</em></p>" {
+		t.Errorf("expected an RFC 1123 date and the HTML content, got %+v", item)
+	}
+
+	if !strings.Contains(buf.String(), `<atom:link rel="self" type="application/rss+xml" href="https://valette.software/en/articles/feed.rss">`) {
+		t.Errorf("expected a self link, got %s", buf.String())
+	}
+}
@@ -0,0 +1,275 @@
+package markdownfile
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"valette.software/internal/blog"
+)
+
+var ErrFrontMatterMissing = errors.New("the file must begin with a front matter between --- (YAML) or +++ (TOML) lines")
+var ErrFrontMatterUnclosed = errors.New("the front matter is never closed")
+var ErrMalformedLine = errors.New("malformed front matter line")
+var ErrTitleMissing = errors.New("the front matter has no title")
+var ErrLanguage = errors.New("the language must be fr or en")
+var ErrDate = errors.New("dates must be written as 2006-01-02 or 2006-01-02T15:04:05Z")
+var ErrSlug = errors.New("the slug may only contain lowercase letters, digits and dashes")
+
+// validSlug matches the slugs the blog gives, they name the exported files.
+var validSlug = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// Parse reads a Markdown file beginning with a front matter. Only flat
+// "key: value" (YAML) or "key = value" (TOML) lines are understood, the
+// values being bare or quoted strings, or lists of them between brackets.
+// The unknown keys are ignored.
+func Parse(data []byte) (blog.NewPost, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.TrimPrefix(text, "\ufeff")
+
+	delimiter, separator := "", ""
+
+	switch {
+	case strings.HasPrefix(text, "---\n"):
+		delimiter, separator = "---", ":"
+	case strings.HasPrefix(text, "+++\n"):
+		delimiter, separator = "+++", "="
+	default:
+		return blog.NewPost{}, ErrFrontMatterMissing
+	}
+
+	frontMatter, content, found := strings.Cut(text[len(delimiter)+1:], "\n"+delimiter+"\n")
+
+	if !found {
+		frontMatter, found = strings.CutSuffix(strings.TrimRight(text[len(delimiter)+1:], "\n"), "\n"+delimiter)
+	}
+
+	if !found {
+		return blog.NewPost{}, ErrFrontMatterUnclosed
+	}
+
+	post := blog.NewPost{Content: strings.TrimLeft(content, "\n")}
+
+	for i, line := range strings.Split(frontMatter, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, separator)
+
+		if !found {
+			return blog.NewPost{}, lineError(i, ErrMalformedLine)
+		}
+
+		values, err := parseValue(strings.TrimSpace(value))
+
+		if err != nil {
+			return blog.NewPost{}, lineError(i, err)
+		}
+
+		err = setField(&post, strings.TrimSpace(key), values)
+
+		if err != nil {
+			return blog.NewPost{}, lineError(i, err)
+		}
+	}
+
+	if post.Title == "" {
+		return blog.NewPost{}, ErrTitleMissing
+	}
+
+	if post.Language != "fr" && post.Language != "en" {
+		return blog.NewPost{}, ErrLanguage
+	}
+
+	return post, nil
+}
+
+// Format writes the post as a Markdown file with a YAML front matter, which
+// Parse reads back.
+func Format(post blog.RenderedPost) []byte {
+	file := strings.Builder{}
+
+	file.WriteString("---\n")
+	file.WriteString("title: " + strconv.Quote(post.Title) + "\n")
+	file.WriteString("language: " + post.Language + "\n")
+	file.WriteString("author: " + strconv.Quote(post.Author) + "\n")
+	file.WriteString("date: " + formatTime(post.Timestamp) + "\n")
+	file.WriteString("slug: " + post.Slug + "\n")
+	file.WriteString("status: " + post.CurrentStatus() + "\n")
+
+	if post.PublishAt != 0 {
+		file.WriteString("publish_at: " + formatTime(post.PublishAt) + "\n")
+	}
+
+	if len(post.Tags) > 0 {
+		names := []string{}
+
+		for _, tag := range post.Tags {
+			names = append(names, strconv.Quote(tag.Name))
+		}
+
+		file.WriteString("tags: [" + strings.Join(names, ", ") + "]\n")
+	}
+
+	if post.Series.Title != "" {
+		file.WriteString("series: " + strconv.Quote(post.Series.Title) + "\n")
+		file.WriteString("series_position: " + strconv.Itoa(post.Series.Position) + "\n")
+	}
+
+	file.WriteString("summary: " + strconv.Quote(post.Summary) + "\n")
+	file.WriteString("---\n\n")
+	file.WriteString(post.Content)
+
+	if !strings.HasSuffix(post.Content, "\n") {
+		file.WriteString("\n")
+	}
+
+	return []byte(file.String())
+}
+
+func setField(post *blog.NewPost, key string, values []string) error {
+	value := strings.Join(values, ", ")
+
+	var err error
+
+	switch key {
+	case "title":
+		post.Title = value
+	case "language", "lang":
+		post.Language = value
+	case "author":
+		post.Author = value
+	case "date":
+		post.Timestamp, err = parseTime(value)
+	case "summary", "description":
+		post.Summary = value
+	case "slug":
+		post.Slug = value
+
+		if value != "" && !validSlug.MatchString(value) {
+			err = ErrSlug
+		}
+	case "status":
+		post.Status = value
+	case "publish_at":
+		post.PublishAt, err = parseTime(value)
+	case "tags":
+		post.Tags = blog.ParseTags(value)
+	case "series":
+		post.Series.Title = value
+	case "series_position":
+		post.Series.Position, err = strconv.Atoi(value)
+	}
+
+	return err
+}
+
+// parseValue reads a string, quoted or not, or a list of strings.
+func parseValue(value string) ([]string, error) {
+	if !strings.HasPrefix(value, "[") {
+		unquoted, err := unquote(value)
+		return []string{unquoted}, err
+	}
+
+	if !strings.HasSuffix(value, "]") {
+		return []string{}, ErrMalformedLine
+	}
+
+	values := []string{}
+	inner := strings.TrimSpace(value[1 : len(value)-1])
+
+	for inner != "" {
+		item, rest := inner, ""
+
+		if inner[0] == '"' || inner[0] == '\'' {
+			end := closingQuote(inner)
+
+			if end == -1 {
+				return []string{}, ErrMalformedLine
+			}
+
+			item, rest = inner[:end+1], inner[end+1:]
+		} else if comma := strings.Index(inner, ","); comma != -1 {
+			item, rest = inner[:comma], inner[comma:]
+		}
+
+		unquoted, err := unquote(strings.TrimSpace(item))
+
+		if err != nil {
+			return []string{}, err
+		}
+
+		values = append(values, unquoted)
+
+		rest = strings.TrimSpace(rest)
+
+		if rest != "" && rest[0] != ',' {
+			return []string{}, ErrMalformedLine
+		}
+
+		inner = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+	}
+
+	return values, nil
+}
+
+func unquote(value string) (string, error) {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		// YAML and TOML literal strings only escape the quote, by doubling it in YAML
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+
+	if strings.HasPrefix(value, "\"") {
+		unquoted, err := strconv.Unquote(value)
+
+		if err != nil {
+			return "", ErrMalformedLine
+		}
+
+		return unquoted, nil
+	}
+
+	return value, nil
+}
+
+// closingQuote finds the quote ending the string value begins with.
+func closingQuote(value string) int {
+	quote := value[0]
+
+	for i := 1; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && quote == '"':
+			i++
+		case value[i] == quote && quote == '\'' && i+1 < len(value) && value[i+1] == '\'':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+
+	return -1
+}
+
+func parseTime(value string) (int64, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed.Unix(), nil
+		}
+	}
+
+	return 0, ErrDate
+}
+
+func formatTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+func lineError(index int, err error) error {
+	return fmt.Errorf("front matter line %d: %w", index+1, err)
+}
@@ -0,0 +1,122 @@
+package markdownfile
+
+import (
+	"errors"
+	"testing"
+
+	"valette.software/internal/blog"
+)
+
+func TestParse(t *testing.T) {
+	yaml := "---\n" +
+		"title: \"L'été \\\"chaud\\\"\"\n" +
+		"language: fr\n" +
+		"# a comment\n" +
+		"author: Mehdi Valette\n" +
+		"date: 2025-06-21\n" +
+		"summary: 'C''est l''été'\n" +
+		"tags: [Linux, \"Go, le langage\", 'web']\n" +
+		"draft: true\n" +
+		"---\n\n# Titre\r\n\nTexte\n"
+
+	post, err := Parse([]byte(yaml))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if post.Title != "L'été \"chaud\"" || post.Language != "fr" || post.Author != "Mehdi Valette" || post.Summary != "C'est l'été" {
+		t.Errorf("expected the strings to be unquoted, got %+v", post)
+	}
+
+	if post.Timestamp != 1750464000 {
+		t.Errorf("expected the date to be read, got %d", post.Timestamp)
+	}
+
+	// the tags are given to blog.ParseTags, which splits them on commas
+	if len(post.Tags) != 4 || post.Tags[1].Name != "Go" || post.Tags[3].Name != "web" {
+		t.Errorf("expected four tags, got %+v", post.Tags)
+	}
+
+	if post.Content != "# Titre\n\nTexte\n" {
+		t.Errorf("expected the content after the front matter, got %q", post.Content)
+	}
+
+	toml := "+++\ntitle = \"Hello\"\nlang = \"en\"\nslug = \"hello-world\"\npublish_at = 2026-01-01T10:00:00Z\n+++"
+
+	post, err = Parse([]byte(toml))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if post.Title != "Hello" || post.Language != "en" || post.Slug != "hello-world" || post.PublishAt != 1767261600 || post.Content != "" {
+		t.Errorf("expected the TOML front matter to be read, got %+v", post)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	type data struct {
+		input    string
+		expected error
+	}
+
+	testData := []data{
+		{"# No front matter", ErrFrontMatterMissing},
+		{"---\ntitle: Hello\nlanguage: en\n", ErrFrontMatterUnclosed},
+		{"---\ntitle Hello\n---\n", ErrMalformedLine},
+		{"---\ntitle: \"Hello\n---\n", ErrMalformedLine},
+		{"---\ntitle: Hello\nlanguage: en\ntags: [a, b\n---\n", ErrMalformedLine},
+		{"---\ntitle: Hello\nlanguage: en\ndate: yesterday\n---\n", ErrDate},
+		{"---\nlanguage: en\n---\n", ErrTitleMissing},
+		{"---\ntitle: Hallo\nlanguage: de\n---\n", ErrLanguage},
+		{"---\ntitle: Hello\nlanguage: en\nslug: ../../x\n---\n", ErrSlug},
+		{"---\ntitle: Hello\nlanguage: en\nslug: a/b\n---\n", ErrSlug},
+		{"---\ntitle: Hello\nlanguage: en\nslug: My post\n---\n", ErrSlug},
+	}
+
+	for _, test := range testData {
+		_, err := Parse([]byte(test.input))
+
+		if !errors.Is(err, test.expected) {
+			t.Errorf("expected %q to fail with \"%s\", got %v", test.input, test.expected, err)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	post := blog.RenderedPost{
+		Post: blog.Post{
+			Language:  "en",
+			Slug:      "hello",
+			Author:    "Mehdi",
+			Title:     "Hello \"world\"",
+			Timestamp: 1767225600,
+			Summary:   "Line one\nline two",
+			Content:   "# Hello\n\n---\n\nText",
+			Status:    blog.StatusScheduled,
+			PublishAt: 4102480800,
+		},
+		Tags:   []blog.Tag{{Name: "Linux"}, {Name: "l'été"}},
+		Series: blog.PostSeries{Series: blog.Series{Title: "Deploying: the basics"}, Position: 2},
+	}
+
+	parsed, err := Parse(Format(post))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Title != post.Title || parsed.Summary != post.Summary || parsed.Slug != post.Slug || parsed.Timestamp != post.Timestamp ||
+		parsed.Status != post.Status || parsed.PublishAt != post.PublishAt || parsed.Content != post.Content+"\n" {
+		t.Errorf("expected the post to survive the round trip, got %+v", parsed)
+	}
+
+	if len(parsed.Tags) != 2 || parsed.Tags[1].Name != "l'été" {
+		t.Errorf("expected the tags to survive the round trip, got %+v", parsed.Tags)
+	}
+
+	if parsed.Series.Title != post.Series.Title || parsed.Series.Position != 2 {
+		t.Errorf("expected the series to survive the round trip, got %+v", parsed.Series)
+	}
+}
@@ -0,0 +1,187 @@
+package markdownfile
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"valette.software/internal/blog"
+)
+
+// MaxFileSize is the size in bytes of the largest file that can be imported,
+// as large as the archives uploaded.
+const MaxFileSize = 50 << 20
+
+var ErrFileTooLarge = errors.New("the file is larger than 50 MB")
+var ErrUnsafeName = errors.New("the language or the slug of the post can't name a file")
+
+// validLanguage matches the languages, they name the exported directories.
+var validLanguage = regexp.MustCompile(`^[a-z]{2}$`)
+
+// Conflict is a file that couldn't be imported.
+type Conflict struct {
+	File   string
+	Reason string
+}
+
+// Report tells which files were imported as new posts and which weren't.
+type Report struct {
+	Imported  []string
+	Conflicts []Conflict
+}
+
+// Import adds a post for every .md file of fsys, in any sub directory. A
+// file that can't be read or whose slug is already taken in its language is
+// reported as a conflict and skipped, the existing posts are never
+// modified.
+func Import(fsys fs.FS, editor string) (Report, error) {
+	report := Report{Imported: []string{}, Conflicts: []Conflict{}}
+
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		base := path.Base(name)
+
+		// skip the hidden files, and the metadata added to the zip files by macOS
+		if name != "." && (strings.HasPrefix(base, ".") || base == "__MACOSX") {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if entry.IsDir() || !strings.EqualFold(path.Ext(name), ".md") {
+			return nil
+		}
+
+		data, err := readFile(fsys, name)
+
+		if err == nil {
+			err = importFile(data, editor)
+		}
+
+		if err != nil {
+			report.Conflicts = append(report.Conflicts, Conflict{File: name, Reason: err.Error()})
+		} else {
+			report.Imported = append(report.Imported, name)
+		}
+
+		return nil
+	})
+
+	return report, err
+}
+
+// ImportZip imports the .md files of a zip archive.
+func ImportZip(archive io.ReaderAt, size int64, editor string) (Report, error) {
+	reader, err := zip.NewReader(archive, size)
+
+	if err != nil {
+		return Report{}, err
+	}
+
+	return Import(reader, editor)
+}
+
+// ExportDir writes every post in dir, as dir/<language>/<slug>.md, and
+// returns the number of posts written.
+func ExportDir(dir string) (int, error) {
+	return export(func(name string, data []byte) error {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+
+		return os.WriteFile(file, data, 0644)
+	})
+}
+
+// ExportZip writes every post in a zip archive, as <language>/<slug>.md.
+func ExportZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	_, err := export(func(name string, data []byte) error {
+		file, err := archive.Create(name)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = file.Write(data)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// readFile reads the file unless it's larger than MaxFileSize, the files of
+// a zip archive may be much larger once decompressed.
+func readFile(fsys fs.FS, name string) ([]byte, error) {
+	file, err := fsys.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, MaxFileSize+1))
+
+	if err == nil && len(data) > MaxFileSize {
+		err = ErrFileTooLarge
+	}
+
+	return data, err
+}
+
+func importFile(data []byte, editor string) error {
+	post, err := Parse(data)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = blog.AddPost(post, editor)
+
+	return err
+}
+
+func export(write func(name string, data []byte) error) (int, error) {
+	posts, err := blog.ListAllPosts()
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, post := range posts {
+		// the posts saved before the slugs were checked could leave the
+		// directory of the export
+		if !validLanguage.MatchString(post.Language) || !validSlug.MatchString(post.Slug) {
+			return 0, fmt.Errorf("%w: %q of the post %d", ErrUnsafeName, post.Language+"/"+post.Slug, post.ArticleId)
+		}
+
+		err = write(post.Language+"/"+post.Slug+".md", Format(post))
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(posts), nil
+}
@@ -0,0 +1,28 @@
+package markdownfile
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestImportUnsafeSlug(t *testing.T) {
+	fsys := fstest.MapFS{
+		"en/escape.md": {Data: []byte("---\ntitle: Escape\nlanguage: en\nslug: ../../etc/x\n---\n")},
+	}
+
+	report, err := Import(fsys, "admin")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Imported) != 0 || len(report.Conflicts) != 1 || !strings.HasSuffix(report.Conflicts[0].Reason, ErrSlug.Error()) {
+		t.Errorf("expected the unsafe slug to be reported as a conflict, got %+v", report)
+	}
+
+	if _, err := readFile(fstest.MapFS{"big.md": {Data: make([]byte, MaxFileSize+1)}}, "big.md"); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("expected ErrFileTooLarge, got %v", err)
+	}
+}
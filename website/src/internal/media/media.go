@@ -0,0 +1,317 @@
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "golang.org/x/image/webp"
+
+	"valette.software/internal/database"
+)
+
+// MaxSize is the size in bytes of the largest file that can be uploaded.
+const MaxSize = 10 << 20
+
+// MaxPixels is the largest width × height of the images that can be
+// uploaded, a small file may declare a huge image that wouldn't fit in memory
+// once decoded.
+const MaxPixels = 50_000_000
+
+var ErrNotFound = errors.New("media not found")
+var ErrTooLarge = errors.New("the file is larger than 10 MB")
+var ErrUnsupportedType = errors.New("only PNG, JPEG, GIF and WebP images can be uploaded")
+var ErrTooManyPixels = errors.New("the image is larger than 50 megapixels")
+
+// extensions maps the accepted MIME types to the extension of the files.
+var extensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// validFilename matches the names given to the uploaded files, nothing else
+// is ever served from the uploads directory.
+var validFilename = regexp.MustCompile(`^[0-9a-f]{64}(-[0-9]+)?\.[a-z]+$`)
+
+const mediaColumns = "media_id, filename, original_name, mime_type, size, alt, width, height, created_at"
+
+var db *sql.DB
+var dir string
+
+// Media is an uploaded file, named after the hash of its content.
+type Media struct {
+	MediaId      int64
+	Filename     string
+	OriginalName string
+	MimeType     string
+	Size         int64
+	Alt          string
+	Width        int
+	Height       int
+	CreatedAt    int64
+	Variants     []Variant
+}
+
+func Init() {
+	db = database.Get()
+	dir = filepath.Join(database.DataDir, "uploads")
+
+	err := os.MkdirAll(dir, 0755)
+
+	if err != nil {
+		log.Fatal("couldn't create the uploads directory: ", err)
+	}
+}
+
+// Url is the public address of the file.
+func (media Media) Url() string {
+	return "/uploads/" + media.Filename
+}
+
+// SizeHuman is the size of the file in kB or MB.
+func (media Media) SizeHuman() string {
+	if media.Size < 1<<20 {
+		return fmt.Sprintf("%.1f kB", float64(media.Size)/(1<<10))
+	}
+
+	return fmt.Sprintf("%.1f MB", float64(media.Size)/(1<<20))
+}
+
+// Markdown is the image syntax displaying the file in a post.
+func (media Media) Markdown() string {
+	alt := strings.NewReplacer("[", "", "]", "", "\n", " ").Replace(media.Alt)
+
+	return "![" + alt + "](" + media.Url() + ")"
+}
+
+// Save stores the uploaded image named name. Uploading the same content
+// twice returns the media saved the first time.
+func Save(name string, content io.Reader, alt string) (Media, error) {
+	data, err := io.ReadAll(io.LimitReader(content, MaxSize+1))
+
+	if err != nil {
+		return Media{}, err
+	}
+
+	if len(data) > MaxSize {
+		return Media{}, ErrTooLarge
+	}
+
+	mimeType := http.DetectContentType(data)
+	extension, ok := extensions[mimeType]
+
+	if !ok {
+		return Media{}, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return Media{}, ErrUnsupportedType
+	}
+
+	if config.Width*config.Height > MaxPixels {
+		return Media{}, ErrTooManyPixels
+	}
+
+	hash := sha256.Sum256(data)
+	filename := hex.EncodeToString(hash[:]) + extension
+
+	existing, err := getByFilename(filename)
+
+	if err == nil {
+		return existing, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return Media{}, err
+	}
+
+	err = writeFile(filename, data)
+
+	if err != nil {
+		return Media{}, err
+	}
+
+	media := Media{
+		Filename:     filename,
+		OriginalName: filepath.Base(name),
+		MimeType:     mimeType,
+		Size:         int64(len(data)),
+		Alt:          strings.TrimSpace(alt),
+		Width:        config.Width,
+		Height:       config.Height,
+		CreatedAt:    time.Now().Unix(),
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO media(filename, original_name, mime_type, size, alt, width, height, created_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?)",
+		media.Filename, media.OriginalName, media.MimeType, media.Size, media.Alt, media.Width, media.Height, media.CreatedAt,
+	)
+
+	if err != nil {
+		return Media{}, err
+	}
+
+	media.MediaId, err = result.LastInsertId()
+
+	if err != nil {
+		return Media{}, err
+	}
+
+	// the original is enough to display the image, it can be resized later
+	// with the regenerate-media command
+	media.Variants, err = makeVariants(media, data)
+
+	if err != nil {
+		log.Print("couldn't resize ", media.Filename, ": ", err)
+	}
+
+	return media, nil
+}
+
+// List returns every uploaded file, the most recent first.
+func List() ([]Media, error) {
+	results, err := db.Query("SELECT " + mediaColumns + " FROM media ORDER BY created_at DESC, media_id DESC")
+
+	if err != nil {
+		return []Media{}, err
+	}
+
+	defer results.Close()
+
+	allMedia := []Media{}
+
+	for results.Next() {
+		media, err := scanMedia(results)
+
+		if err != nil {
+			return []Media{}, err
+		}
+
+		allMedia = append(allMedia, media)
+	}
+
+	return allMedia, results.Err()
+}
+
+func Get(id int64) (Media, error) {
+	return scanMedia(db.QueryRow("SELECT "+mediaColumns+" FROM media WHERE media_id = ?", id))
+}
+
+// Delete forgets the media and removes its file, the posts showing it are
+// left untouched.
+func Delete(id int64) error {
+	media, err := Get(id)
+
+	if err != nil {
+		return err
+	}
+
+	err = removeVariants(id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM media WHERE media_id = ?", id)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(dir, media.Filename))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// Serve answers the requests for the uploaded files. A file never changes
+// once uploaded since it is named after its content, browsers may keep it
+// forever.
+func Serve() http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		name := req.URL.Path
+
+		if !validFilename.MatchString(name) {
+			http.NotFound(res, req)
+			return
+		}
+
+		path := filepath.Join(dir, name)
+
+		if _, err := os.Stat(path); err != nil {
+			http.NotFound(res, req)
+			return
+		}
+
+		res.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		res.Header().Set("X-Content-Type-Options", "nosniff")
+
+		http.ServeFile(res, req, path)
+	})
+}
+
+func getByFilename(filename string) (Media, error) {
+	return scanMedia(db.QueryRow("SELECT "+mediaColumns+" FROM media WHERE filename = ?", filename))
+}
+
+func scanMedia(row interface{ Scan(...any) error }) (Media, error) {
+	media := Media{}
+
+	err := row.Scan(&media.MediaId, &media.Filename, &media.OriginalName, &media.MimeType, &media.Size, &media.Alt, &media.Width, &media.Height, &media.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Media{}, ErrNotFound
+	}
+
+	return media, err
+}
+
+// writeFile writes the file next to its final place first, so that it is
+// never served half written.
+func writeFile(filename string, data []byte) error {
+	temp, err := os.CreateTemp(dir, filename+".*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(data)
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(temp.Name(), 0644)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), filepath.Join(dir, filename))
+}
@@ -0,0 +1,185 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"valette.software/internal/database/databasetest"
+)
+
+// openTestStorage points the package to a fresh database and uploads
+// directory.
+func openTestStorage(t *testing.T) {
+	conn := databasetest.Open(t)
+
+	db = conn
+	dir = t.TempDir()
+}
+
+func testImage(t *testing.T, width int, height int) []byte {
+	buf := bytes.Buffer{}
+
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// bombImage is a small PNG whose header declares width × height pixels.
+func bombImage(t *testing.T, width int, height int) []byte {
+	data := testImage(t, 1, 1)
+
+	// the IHDR chunk follows the 8 bytes of the signature, its type and
+	// fields are covered by the checksum
+	binary.BigEndian.PutUint32(data[16:], uint32(width))
+	binary.BigEndian.PutUint32(data[20:], uint32(height))
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	return data
+}
+
+func TestSave(t *testing.T) {
+	openTestStorage(t)
+
+	media, err := Save("photo.png", bytes.NewReader(testImage(t, 30, 20)), " A photo ")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if media.Width != 30 || media.Height != 20 || media.MimeType != "image/png" || media.Alt != "A photo" {
+		t.Errorf("expected a 30x20 PNG described as \"A photo\", got %+v", media)
+	}
+
+	if !strings.HasSuffix(media.Filename, ".png") || media.Markdown() != "![A photo](/uploads/"+media.Filename+")" {
+		t.Errorf("expected the file to be named after its content, got %s", media.Markdown())
+	}
+
+	again, err := Save("copy.png", bytes.NewReader(testImage(t, 30, 20)), "")
+
+	if err != nil || again.MediaId != media.MediaId {
+		t.Errorf("expected the same content to be stored once, got %+v (%v)", again, err)
+	}
+
+	_, err = Save("page.html", strings.NewReader("<html><script>alert(1)</script></html>"), "")
+
+	if err != ErrUnsupportedType {
+		t.Errorf("expected ErrUnsupportedType, got %v", err)
+	}
+
+	_, err = Save("bomb.png", bytes.NewReader(bombImage(t, 50000, 50000)), "")
+
+	if err != ErrTooManyPixels {
+		t.Errorf("expected ErrTooManyPixels, got %v", err)
+	}
+
+	if err := Delete(media.MediaId); err != nil {
+		t.Fatal(err)
+	}
+
+	if all, _ := List(); len(all) != 0 {
+		t.Errorf("expected the media to be deleted, got %+v", all)
+	}
+}
+
+func TestVariants(t *testing.T) {
+	openTestStorage(t)
+
+	media, err := Save("wide.png", bytes.NewReader(testImage(t, 1000, 500)), "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(media.Variants) != 2 || media.Variants[0].Width != 480 || media.Variants[0].Height != 240 || media.Variants[1].Width != 960 {
+		t.Fatalf("expected a 480 and a 960 pixels wide copy, got %+v", media.Variants)
+	}
+
+	Widths = []int{200}
+	t.Cleanup(func() { Widths = []int{480, 960, 1600} })
+
+	if err := RegenerateVariants(); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := FindByUrl(media.Url())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found.Variants) != 1 || found.Variants[0].Width != 200 {
+		t.Errorf("expected the copies to be made again with the new widths, got %+v", found.Variants)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, media.Variants[0].Filename)); !os.IsNotExist(err) {
+		t.Errorf("expected the former copies to be removed, got %v", err)
+	}
+}
+
+func TestVariantExtension(t *testing.T) {
+	type data struct {
+		mimeType  string
+		extension string
+	}
+
+	testData := []data{
+		{"image/jpeg", ".jpg"},
+		{"image/png", ".png"},
+		{"image/gif", ".png"},
+		{"image/webp", ".png"},
+	}
+
+	for _, test := range testData {
+		if extension := variantExtension(test.mimeType); extension != test.extension {
+			t.Errorf("expected the copies of %s in %s, got %s", test.mimeType, test.extension, extension)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	openTestStorage(t)
+
+	media, err := Save("photo.png", bytes.NewReader(testImage(t, 1, 1)), "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := http.StripPrefix("/uploads/", Serve())
+
+	type data struct {
+		path   string
+		status int
+	}
+
+	testData := []data{
+		{media.Url(), 200},
+		{"/uploads/" + strings.Repeat("0", 64) + ".png", 404},
+		{"/uploads/../blog.db", 404},
+		{"/uploads/", 404},
+	}
+
+	for _, test := range testData {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest("GET", test.path, nil))
+
+		if res.Code != test.status {
+			t.Errorf("expected %s to answer %d, got %d", test.path, test.status, res.Code)
+		}
+
+		if test.status == 200 && !strings.Contains(res.Header().Get("Cache-Control"), "immutable") {
+			t.Errorf("expected %s to be cached forever, got \"%s\"", test.path, res.Header().Get("Cache-Control"))
+		}
+	}
+}
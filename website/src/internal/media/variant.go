@@ -0,0 +1,209 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Widths are the widths in pixels of the copies made of every uploaded
+// image, run the regenerate-media command after changing them.
+var Widths = []int{480, 960, 1600}
+
+// Variant is a copy of an image resized to a smaller width.
+type Variant struct {
+	Width    int
+	Height   int
+	Filename string
+}
+
+func (variant Variant) Url() string {
+	return "/uploads/" + variant.Filename
+}
+
+// FindByUrl returns the media served at url, with its variants.
+func FindByUrl(url string) (Media, error) {
+	media, err := getByFilename(strings.TrimPrefix(url, "/uploads/"))
+
+	if err != nil {
+		return Media{}, err
+	}
+
+	media.Variants, err = listVariants(media.MediaId)
+
+	return media, err
+}
+
+// RegenerateVariants throws away the variants of every image and makes
+// them again from the original files, with the current Widths.
+func RegenerateVariants() error {
+	allMedia, err := List()
+
+	if err != nil {
+		return err
+	}
+
+	for _, media := range allMedia {
+		err = removeVariants(media.MediaId)
+
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, media.Filename))
+
+		if err != nil {
+			return err
+		}
+
+		variants, err := makeVariants(media, data)
+
+		if errors.Is(err, ErrTooManyPixels) {
+			log.Printf("%s: too large to be resized", media.Filename)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		log.Printf("%s: %d variant(s)", media.Filename, len(variants))
+	}
+
+	return nil
+}
+
+// makeVariants resizes the image to every width of Widths narrower than
+// itself. GIF images are left alone since they may be animated.
+func makeVariants(media Media, data []byte) ([]Variant, error) {
+	if media.MimeType == "image/gif" {
+		return []Variant{}, nil
+	}
+
+	// the files uploaded before the limit are not decoded either
+	if media.Width*media.Height > MaxPixels {
+		return []Variant{}, ErrTooManyPixels
+	}
+
+	original, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return []Variant{}, err
+	}
+
+	variants := []Variant{}
+	hash, _, _ := strings.Cut(media.Filename, ".")
+	extension := variantExtension(media.MimeType)
+
+	for _, width := range Widths {
+		if width >= media.Width {
+			continue
+		}
+
+		height := max(1, (media.Height*width+media.Width/2)/media.Width)
+
+		resized := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(resized, resized.Bounds(), original, original.Bounds(), draw.Src, nil)
+
+		encoded := bytes.Buffer{}
+
+		if extension == ".jpg" {
+			err = jpeg.Encode(&encoded, resized, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&encoded, resized)
+		}
+
+		if err != nil {
+			return []Variant{}, err
+		}
+
+		variant := Variant{Width: width, Height: height, Filename: hash + "-" + strconv.Itoa(width) + extension}
+
+		err = writeFile(variant.Filename, encoded.Bytes())
+
+		if err != nil {
+			return []Variant{}, err
+		}
+
+		_, err = db.Exec(
+			"INSERT INTO media_variant(media_id, width, height, filename) VALUES(?, ?, ?, ?)",
+			media.MediaId, variant.Width, variant.Height, variant.Filename,
+		)
+
+		if err != nil {
+			return []Variant{}, err
+		}
+
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+// variantExtension chooses the format of the copies: JPEG for the photos,
+// PNG for the others, which may have sharp edges or transparency. The WebP
+// images are copied in PNG as well, without a second lossy compression.
+// The copies are not made in WebP or AVIF: golang.org/x/image only decodes
+// WebP, and the standard library has no encoder for either.
+func variantExtension(mimeType string) string {
+	if mimeType == "image/jpeg" {
+		return ".jpg"
+	}
+
+	return ".png"
+}
+
+func listVariants(mediaId int64) ([]Variant, error) {
+	results, err := db.Query("SELECT width, height, filename FROM media_variant WHERE media_id = ? ORDER BY width", mediaId)
+
+	if err != nil {
+		return []Variant{}, err
+	}
+
+	defer results.Close()
+
+	variants := []Variant{}
+
+	for results.Next() {
+		variant := Variant{}
+
+		if err := results.Scan(&variant.Width, &variant.Height, &variant.Filename); err != nil {
+			return []Variant{}, err
+		}
+
+		variants = append(variants, variant)
+	}
+
+	return variants, results.Err()
+}
+
+func removeVariants(mediaId int64) error {
+	variants, err := listVariants(mediaId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("DELETE FROM media_variant WHERE media_id = ?", mediaId)
+
+	if err != nil {
+		return err
+	}
+
+	for _, variant := range variants {
+		err = os.Remove(filepath.Join(dir, variant.Filename))
+
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
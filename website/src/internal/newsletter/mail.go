@@ -0,0 +1,194 @@
+package newsletter
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"valette.software/internal/blog"
+	"valette.software/internal/config"
+	"valette.software/internal/i18n"
+)
+
+//go:embed template
+var fsTemplate embed.FS
+
+var htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(fsTemplate, "template/*.html"))
+var textTemplates = texttemplate.Must(texttemplate.ParseFS(fsTemplate, "template/*.txt"))
+
+// sendMail is replaced in the tests, which have no mail server.
+var sendMail = smtp.SendMail
+
+var rootRelativeLink = regexp.MustCompile(`\b(href|src)="(/[^/"][^"]*)"`)
+var srcsetAttribute = regexp.MustCompile(`\bsrcset="([^"]*)"`)
+
+type mailData struct {
+	T              i18n.Localizer
+	Subscriber     Subscriber
+	Post           blog.RenderedPost
+	PostUrl        string
+	Html           htmltemplate.HTML
+	UnsubscribeUrl string
+}
+
+// sendConfirmation mails the link confirming the subscription.
+func sendConfirmation(subscriber Subscriber) error {
+	locale, err := i18n.GetLocale(subscriber.Language)
+
+	if err != nil {
+		return err
+	}
+
+	text := bytes.Buffer{}
+
+	err = textTemplates.ExecuteTemplate(&text, "confirm.txt", mailData{T: locale, Subscriber: subscriber})
+
+	if err != nil {
+		return err
+	}
+
+	return send(subscriber.Email, locale.Get("Confirmez votre inscription à la newsletter"), nil, text.String(), "")
+}
+
+// sendPost mails the post with a plain text alternative, the links of the
+// post are made absolute for the mail clients.
+func sendPost(post blog.RenderedPost, subscriber Subscriber) error {
+	locale, err := i18n.GetLocale(subscriber.Language)
+
+	if err != nil {
+		return err
+	}
+
+	data := mailData{
+		T:              locale,
+		Subscriber:     subscriber,
+		Post:           post,
+		PostUrl:        baseUrl + "/" + post.Language + "/articles/" + post.Slug,
+		Html:           htmltemplate.HTML(absoluteLinks(string(post.Html))),
+		UnsubscribeUrl: subscriber.UnsubscribeUrl(),
+	}
+
+	text := bytes.Buffer{}
+	html := bytes.Buffer{}
+
+	err = textTemplates.ExecuteTemplate(&text, "post.txt", data)
+
+	if err == nil {
+		err = htmlTemplates.ExecuteTemplate(&html, "post.html", data)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		"List-Unsubscribe":      "<" + data.UnsubscribeUrl + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+
+	return send(subscriber.Email, post.Title, headers, text.String(), html.String())
+}
+
+// send mails the text to the address, with an HTML alternative if any.
+func send(to string, subject string, headers map[string]string, text string, html string) error {
+	conf := config.GetConfig()
+	smtpData := conf.GetSmtp()
+
+	message, err := buildMessage(smtpData.From, to, subject, headers, text, html)
+
+	if err != nil {
+		return err
+	}
+
+	return sendMail(smtpData.Host+":"+smtpData.Port, conf.GetSmtpAuth(), smtpData.From, []string{to}, message)
+}
+
+// buildMessage returns the mail in the MIME format, the parts are encoded as
+// quoted-printable since the posts have lines longer than SMTP allows.
+func buildMessage(from string, to string, subject string, headers map[string]string, text string, html string) ([]byte, error) {
+	message := bytes.Buffer{}
+
+	message.WriteString("From: " + from + "\r\n")
+	message.WriteString("To: " + to + "\r\n")
+	message.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	message.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	message.WriteString("MIME-Version: 1.0\r\n")
+
+	for name, value := range headers {
+		message.WriteString(name + ": " + value + "\r\n")
+	}
+
+	if html == "" {
+		message.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		err := writeQuotedPrintable(&message, text)
+
+		return message.Bytes(), err
+	}
+
+	parts := multipart.NewWriter(&message)
+	message.WriteString("Content-Type: multipart/alternative; boundary=" + parts.Boundary() + "\r\n\r\n")
+
+	// the clients show the last part they can read, the HTML one goes last
+	for _, part := range []struct{ contentType, content string }{{"text/plain", text}, {"text/html", html}} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		if err == nil {
+			err = writeQuotedPrintable(writer, part.content)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := parts.Close()
+
+	return message.Bytes(), err
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	writer := quotedprintable.NewWriter(w)
+
+	_, err := writer.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(content, "\r\n", "\n"), "\n", "\r\n")))
+
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// absoluteLinks prefixes the root-relative links and images of the post HTML
+// with the address of the site.
+func absoluteLinks(postHtml string) string {
+	postHtml = rootRelativeLink.ReplaceAllString(postHtml, `$1="`+baseUrl+`$2"`)
+
+	return srcsetAttribute.ReplaceAllStringFunc(postHtml, func(attribute string) string {
+		candidates := strings.Split(srcsetAttribute.FindStringSubmatch(attribute)[1], ",")
+
+		for i, candidate := range candidates {
+			candidate = strings.TrimSpace(candidate)
+
+			if strings.HasPrefix(candidate, "/") && !strings.HasPrefix(candidate, "//") {
+				candidate = baseUrl + candidate
+			}
+
+			candidates[i] = candidate
+		}
+
+		return `srcset="` + strings.Join(candidates, ", ") + `"`
+	})
+}
@@ -0,0 +1,297 @@
+package newsletter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"valette.software/internal/database"
+)
+
+const (
+	StatusPending      = "pending"
+	StatusConfirmed    = "confirmed"
+	StatusUnsubscribed = "unsubscribed"
+)
+
+// Languages are the languages of the newsletters, the subscribers receive
+// the posts written in theirs.
+var Languages = []string{"fr", "en"}
+
+// resendDelay is the time before a confirmation can be mailed again to the
+// same address, the form must not be used to flood a mailbox.
+const resendDelay = time.Hour
+
+var ErrNotFound = errors.New("subscriber not found")
+var ErrInvalidEmail = errors.New("the email address is invalid")
+var ErrLanguage = errors.New("there is no newsletter in this language")
+var ErrInvalidSignature = errors.New("the link is invalid or expired")
+
+const subscriberColumns = "subscriber_id, email, language, status, created_at, confirmation_sent_at, confirmed_at"
+
+var db *sql.DB
+var baseUrl string
+var secret []byte
+
+// Subscriber receives the posts of a language by mail, once confirmed.
+type Subscriber struct {
+	SubscriberId       int64
+	Email              string
+	Language           string
+	Status             string
+	CreatedAt          int64
+	ConfirmationSentAt int64
+	ConfirmedAt        int64
+}
+
+// Init prepares the newsletter of the site published at siteUrl and loads
+// the key signing the links of the mails.
+func Init(siteUrl string) {
+	var err error
+
+	db = database.Get()
+	baseUrl = siteUrl
+	secret, err = database.LoadSecret(db, "newsletter")
+
+	if err != nil {
+		log.Fatal("couldn't load the key of the newsletter: ", err)
+	}
+}
+
+// DateHuman is the subscription date shown to the admin.
+func (subscriber Subscriber) DateHuman() string {
+	return time.Unix(subscriber.CreatedAt, 0).UTC().Format("2006-01-02")
+}
+
+func scanSubscriber(row interface{ Scan(...any) error }) (Subscriber, error) {
+	subscriber := Subscriber{}
+
+	err := row.Scan(&subscriber.SubscriberId, &subscriber.Email, &subscriber.Language, &subscriber.Status, &subscriber.CreatedAt, &subscriber.ConfirmationSentAt, &subscriber.ConfirmedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Subscriber{}, ErrNotFound
+	} else if err != nil {
+		log.Print(err)
+		return Subscriber{}, err
+	}
+
+	return subscriber, nil
+}
+
+// Subscribe mails a confirmation link to the address. Whether the address
+// was already subscribed is never told, the form would disclose the
+// subscribers otherwise.
+func Subscribe(email string, lang string) error {
+	email, err := normalizeEmail(email)
+
+	if err != nil {
+		return err
+	}
+
+	if !isLanguage(lang) {
+		return ErrLanguage
+	}
+
+	now := time.Now().Unix()
+
+	_, err = db.Exec("INSERT INTO subscriber (email, language, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING", email, lang, now)
+
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	subscriber, err := scanSubscriber(db.QueryRow("SELECT "+subscriberColumns+" FROM subscriber WHERE email = ? AND language = ?", email, lang))
+
+	if err != nil {
+		return err
+	}
+
+	if subscriber.Status == StatusConfirmed || now-subscriber.ConfirmationSentAt < int64(resendDelay.Seconds()) {
+		return nil
+	}
+
+	// an unsubscribed reader subscribes again with the same steps
+	lastSentAt := subscriber.ConfirmationSentAt
+	subscriber.Status = StatusPending
+	subscriber.ConfirmationSentAt = now
+
+	_, err = db.Exec("UPDATE subscriber SET status = ?, confirmation_sent_at = ? WHERE subscriber_id = ?", StatusPending, now, subscriber.SubscriberId)
+
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	err = sendConfirmation(subscriber)
+
+	if err != nil {
+		// the reader may try again without waiting
+		log.Print(err)
+		db.Exec("UPDATE subscriber SET confirmation_sent_at = ? WHERE subscriber_id = ?", lastSentAt, subscriber.SubscriberId)
+	}
+
+	return err
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	address, err := mail.ParseAddress(email)
+
+	// the display names and the comments have no place in the form
+	if err != nil || address.Address != email || len(email) > 254 {
+		return "", ErrInvalidEmail
+	}
+
+	return email, nil
+}
+
+func isLanguage(lang string) bool {
+	for _, language := range Languages {
+		if language == lang {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get returns the subscriber.
+func Get(id int64) (Subscriber, error) {
+	return scanSubscriber(db.QueryRow("SELECT "+subscriberColumns+" FROM subscriber WHERE subscriber_id = ?", id))
+}
+
+// Confirm subscribes the reader who followed the link of the last
+// confirmation mailed.
+func Confirm(id int64, signature string) (Subscriber, error) {
+	subscriber, err := Get(id)
+
+	if errors.Is(err, ErrNotFound) || (err == nil && !hmac.Equal([]byte(signature), []byte(subscriber.confirmSignature()))) {
+		return Subscriber{}, ErrInvalidSignature
+	} else if err != nil {
+		return Subscriber{}, err
+	}
+
+	if subscriber.Status == StatusConfirmed {
+		return subscriber, nil
+	}
+
+	if subscriber.Status != StatusPending {
+		return Subscriber{}, ErrInvalidSignature
+	}
+
+	subscriber.Status = StatusConfirmed
+	subscriber.ConfirmedAt = time.Now().Unix()
+
+	_, err = db.Exec("UPDATE subscriber SET status = ?, confirmed_at = ? WHERE subscriber_id = ?", subscriber.Status, subscriber.ConfirmedAt, id)
+
+	if err != nil {
+		log.Print(err)
+		return Subscriber{}, err
+	}
+
+	return subscriber, nil
+}
+
+// Unsubscribe stops the mails to the reader who followed the link of a
+// newsletter, the posts still queued for them are dropped.
+func Unsubscribe(id int64, signature string) (Subscriber, error) {
+	subscriber, err := Get(id)
+
+	if errors.Is(err, ErrNotFound) || (err == nil && !hmac.Equal([]byte(signature), []byte(subscriber.unsubscribeSignature()))) {
+		return Subscriber{}, ErrInvalidSignature
+	} else if err != nil {
+		return Subscriber{}, err
+	}
+
+	subscriber.Status = StatusUnsubscribed
+
+	_, err = db.Exec("UPDATE subscriber SET status = ? WHERE subscriber_id = ?", subscriber.Status, id)
+
+	if err == nil {
+		_, err = db.Exec("DELETE FROM newsletter_delivery WHERE subscriber_id = ? AND status = 'queued'", id)
+	}
+
+	if err != nil {
+		log.Print(err)
+		return Subscriber{}, err
+	}
+
+	return subscriber, nil
+}
+
+// ListSubscribers returns every subscriber, the newest first.
+func ListSubscribers() ([]Subscriber, error) {
+	rows, err := db.Query("SELECT " + subscriberColumns + " FROM subscriber ORDER BY created_at DESC, subscriber_id DESC")
+
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var subscribers []Subscriber
+
+	for rows.Next() {
+		subscriber, err := scanSubscriber(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		subscribers = append(subscribers, subscriber)
+	}
+
+	return subscribers, rows.Err()
+}
+
+// sign returns the signature of the link doing action for the subscriber.
+func sign(action string, values ...any) string {
+	mac := hmac.New(sha256.New, secret)
+
+	fmt.Fprintln(mac, action)
+
+	for _, value := range values {
+		fmt.Fprintln(mac, value)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// confirmSignature changes with every confirmation mailed, only the last
+// link sent confirms the subscription.
+func (subscriber Subscriber) confirmSignature() string {
+	return sign("confirm", subscriber.SubscriberId, subscriber.Email, subscriber.ConfirmationSentAt)
+}
+
+// unsubscribeSignature never changes, the links of the old newsletters keep
+// working.
+func (subscriber Subscriber) unsubscribeSignature() string {
+	return sign("unsubscribe", subscriber.SubscriberId, subscriber.Email)
+}
+
+// ConfirmUrl is the link mailed to confirm the subscription.
+func (subscriber Subscriber) ConfirmUrl() string {
+	return subscriber.link("confirm", subscriber.confirmSignature())
+}
+
+// UnsubscribeUrl is the link of the newsletters stopping them.
+func (subscriber Subscriber) UnsubscribeUrl() string {
+	return subscriber.link("unsubscribe", subscriber.unsubscribeSignature())
+}
+
+func (subscriber Subscriber) link(action string, signature string) string {
+	query := url.Values{"id": {strconv.FormatInt(subscriber.SubscriberId, 10)}, "sig": {signature}}
+
+	return baseUrl + "/" + subscriber.Language + "/newsletter/" + action + "?" + query.Encode()
+}
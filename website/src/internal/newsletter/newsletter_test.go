@@ -0,0 +1,261 @@
+package newsletter
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"valette.software/internal/blog"
+	"valette.software/internal/database/databasetest"
+	"valette.software/internal/i18n"
+)
+
+type sentMail struct {
+	to      string
+	message string
+}
+
+// openTestDatabase points the package to a freshly migrated database holding
+// one published post in English, the mails sent are returned instead.
+func openTestDatabase(t *testing.T) (int64, *[]sentMail) {
+	conn := databasetest.Open(t)
+
+	i18n.Init()
+
+	db = conn
+	baseUrl = "https://valette.software"
+	secret = []byte("secret")
+
+	result, err := db.Exec("INSERT INTO post (title, language, author, timestamp, slug, summary, content, status) VALUES ('Title', 'en', 'Author', 0, 'title', '', 'Some *content*', 'published')")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postId, _ := result.LastInsertId()
+
+	findPost = func(id int64) (blog.RenderedPost, error) {
+		if id != postId {
+			return blog.RenderedPost{}, blog.ErrNotFound
+		}
+
+		return blog.RenderedPost{
+			Post: blog.Post{ArticleId: postId, Language: "en", Slug: "title", Title: "Title", Content: "Some *content*", Status: blog.StatusPublished},
+			Html: template.HTML(`<p>Some <em>content</em> <a href="/en/articles/other">link</a> <img src="/media/a.png" srcset="/media/a-480.webp 480w, https://cdn.example.com/b.webp 960w"></p>`),
+		}, nil
+	}
+
+	var mails []sentMail
+
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		mails = append(mails, sentMail{to[0], string(msg)})
+
+		return nil
+	}
+
+	return postId, &mails
+}
+
+// confirmLink returns the ID and the signature of the confirmation link of
+// the mail.
+func confirmLink(t *testing.T, message string) (int64, string) {
+	parsed, err := mail.ReadMessage(strings.NewReader(message))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	match := regexp.MustCompile(`id=(\d+)&sig=([\w-]+)`).FindStringSubmatch(string(body))
+
+	if match == nil {
+		t.Fatalf("expected a confirmation link, got %s", body)
+	}
+
+	id, _ := strconv.ParseInt(match[1], 10, 64)
+
+	return id, match[2]
+}
+
+func TestSubscribe(t *testing.T) {
+	_, mails := openTestDatabase(t)
+
+	type data struct {
+		email string
+		lang  string
+		err   error
+	}
+
+	testData := []data{
+		{"reader@example.com", "en", nil},
+		{" Reader@Example.com ", "en", nil},
+		{"reader@example.com", "fr", nil},
+		{"reader@example.com", "de", ErrLanguage},
+		{"not an email", "en", ErrInvalidEmail},
+		{"Reader <reader@example.com>", "en", ErrInvalidEmail},
+	}
+
+	for _, test := range testData {
+		err := Subscribe(test.email, test.lang)
+
+		if !errors.Is(err, test.err) {
+			t.Errorf("expected %v for %q, got %v", test.err, test.email, err)
+		}
+	}
+
+	if len(*mails) != 2 {
+		t.Fatalf("expected one confirmation for each language, got %d", len(*mails))
+	}
+
+	id, signature := confirmLink(t, (*mails)[0].message)
+
+	if _, err := Confirm(id, signature+"x"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected a forged link to be refused, got %v", err)
+	}
+
+	if _, err := Confirm(id+1, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected the link of another subscriber to be refused, got %v", err)
+	}
+
+	subscriber, err := Confirm(id, signature)
+
+	if err != nil || subscriber.Status != StatusConfirmed {
+		t.Fatalf("expected the subscription to be confirmed, got %+v and %v", subscriber, err)
+	}
+
+	Subscribe("reader@example.com", "en")
+
+	if len(*mails) != 2 {
+		t.Errorf("expected no confirmation for a confirmed subscriber, got %d mails", len(*mails))
+	}
+
+	unsubscribeUrl := subscriber.UnsubscribeUrl()
+	unsubscribeSignature := unsubscribeUrl[strings.Index(unsubscribeUrl, "sig=")+4:]
+
+	if _, err := Unsubscribe(id, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected the confirmation link not to unsubscribe, got %v", err)
+	}
+
+	subscriber, err = Unsubscribe(id, unsubscribeSignature)
+
+	if err != nil || subscriber.Status != StatusUnsubscribed {
+		t.Errorf("expected the subscriber to be unsubscribed, got %+v and %v", subscriber, err)
+	}
+
+	if _, err := Confirm(id, signature); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected an old confirmation link not to subscribe again, got %v", err)
+	}
+}
+
+func TestQueuePost(t *testing.T) {
+	postId, mails := openTestDatabase(t)
+	sendInterval = 0
+
+	for _, email := range []string{"first@example.com", "second@example.com", "pending@example.com"} {
+		Subscribe(email, "en")
+	}
+
+	Subscribe("french@example.com", "fr")
+
+	for _, sent := range (*mails)[:2] {
+		Confirm(confirmLink(t, sent.message))
+	}
+
+	db.Exec("UPDATE subscriber SET status = ? WHERE email = 'french@example.com'", StatusConfirmed)
+	*mails = nil
+
+	count, err := QueuePost(postId)
+
+	if err != nil || count != 2 {
+		t.Fatalf("expected the post to be queued for the 2 confirmed subscribers in English, got %d and %v", count, err)
+	}
+
+	if count, _ := QueuePost(postId); count != 0 {
+		t.Errorf("expected the post to be queued once for each subscriber, got %d", count)
+	}
+
+	if _, err := QueuePost(postId + 1); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("expected a missing post to be refused, got %v", err)
+	}
+
+	for sent, _ := deliverNext(); sent; sent, _ = deliverNext() {
+	}
+
+	if len(*mails) != 2 {
+		t.Fatalf("expected 2 mails, got %d", len(*mails))
+	}
+
+	deliveries, _ := ListDeliveries()
+
+	for _, delivery := range deliveries {
+		if delivery.Status != DeliverySent || delivery.PostTitle != "Title" {
+			t.Errorf("expected the delivery to %s to be sent, got %+v", delivery.Email, delivery)
+		}
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	_, mails := openTestDatabase(t)
+	post, _ := findPost(1)
+	subscriber := Subscriber{SubscriberId: 3, Email: "reader@example.com", Language: "en"}
+
+	if err := sendPost(post, subscriber); err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader((*mails)[0].message))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if message.Header.Get("List-Unsubscribe") != "<"+subscriber.UnsubscribeUrl()+">" || message.Header.Get("List-Unsubscribe-Post") != "List-Unsubscribe=One-Click" {
+		t.Errorf("expected the unsubscribe headers, got %v", message.Header)
+	}
+
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject")); subject != "Title" {
+		t.Errorf("expected the subject to be the title, got %s", subject)
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(message.Header.Get("Content-Type"))
+
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("expected a multipart/alternative mail, got %s", mediaType)
+	}
+
+	parts := map[string]string{}
+	reader := multipart.NewReader(message.Body, params["boundary"])
+
+	for part, err := reader.NextPart(); err == nil; part, err = reader.NextPart() {
+		// the reader decodes the quoted-printable parts
+		content, _ := io.ReadAll(part)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(content)
+	}
+
+	expected := map[string][]string{
+		"text/plain": {"Some *content*", "https://valette.software/en/articles/title", subscriber.UnsubscribeUrl()},
+		"text/html": {
+			`href="https://valette.software/en/articles/other"`,
+			`src="https://valette.software/media/a.png"`,
+			`srcset="https://valette.software/media/a-480.webp 480w, https://cdn.example.com/b.webp 960w"`,
+		},
+	}
+
+	for contentType, contains := range expected {
+		for _, value := range contains {
+			if !strings.Contains(parts[contentType], value) {
+				t.Errorf("expected %s in the %s part, got %s", value, contentType, parts[contentType])
+			}
+		}
+	}
+}
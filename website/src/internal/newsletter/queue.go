@@ -0,0 +1,204 @@
+package newsletter
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"valette.software/internal/blog"
+)
+
+const (
+	DeliveryQueued = "queued"
+	DeliverySent   = "sent"
+	DeliveryFailed = "failed"
+)
+
+// sendInterval is the time between two mails, the SMTP servers refuse the
+// senders going faster.
+var sendInterval = 2 * time.Second
+
+var ErrPostNotPublished = errors.New("only the published posts can be mailed")
+
+// deliverSignals wakes the delivery up after posts were queued.
+var deliverSignals = make(chan struct{}, 1)
+
+// findPost is replaced in the tests.
+var findPost = blog.GetPostById
+
+// Delivery is a post mailed to a subscriber.
+type Delivery struct {
+	DeliveryId   int64
+	PostId       int64
+	SubscriberId int64
+	Status       string
+	Error        string
+	CreatedAt    int64
+	SentAt       int64
+	PostTitle    string
+	Email        string
+}
+
+// DateHuman is the sending date shown to the admin, or the queuing date if
+// the mail wasn't sent yet.
+func (delivery Delivery) DateHuman() string {
+	date := delivery.SentAt
+
+	if date == 0 {
+		date = delivery.CreatedAt
+	}
+
+	return time.Unix(date, 0).UTC().Format("2006-01-02 15:04")
+}
+
+// Start sends the queued mails in the background, for as long as the server
+// runs.
+func Start() {
+	go deliverLoop()
+
+	requestDelivery()
+}
+
+func requestDelivery() {
+	select {
+	case deliverSignals <- struct{}{}:
+	default:
+		// a delivery is already requested
+	}
+}
+
+// QueuePost queues the published post for every confirmed subscriber of its
+// language, it returns the number of mails queued. The subscribers who
+// already received it are skipped.
+func QueuePost(postId int64) (int, error) {
+	post, err := findPost(postId)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !post.IsVisible() {
+		return 0, ErrPostNotPublished
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO newsletter_delivery (post_id, subscriber_id, created_at) SELECT ?, subscriber_id, ? FROM subscriber WHERE language = ? AND status = ? ON CONFLICT DO NOTHING",
+		postId, time.Now().Unix(), post.Language, StatusConfirmed,
+	)
+
+	if err != nil {
+		log.Print(err)
+		return 0, err
+	}
+
+	count, _ := result.RowsAffected()
+	requestDelivery()
+
+	return int(count), nil
+}
+
+// ListDeliveries returns the mails queued or sent, the newest first, with
+// the title of their post and the address they are sent to.
+func ListDeliveries() ([]Delivery, error) {
+	rows, err := db.Query(
+		"SELECT newsletter_delivery.delivery_id, newsletter_delivery.post_id, newsletter_delivery.subscriber_id, newsletter_delivery.status, newsletter_delivery.error, newsletter_delivery.created_at, newsletter_delivery.sent_at, post.title, subscriber.email " +
+			"FROM newsletter_delivery JOIN post ON post.post_id = newsletter_delivery.post_id JOIN subscriber ON subscriber.subscriber_id = newsletter_delivery.subscriber_id " +
+			"ORDER BY newsletter_delivery.delivery_id DESC",
+	)
+
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var deliveries []Delivery
+
+	for rows.Next() {
+		delivery := Delivery{}
+
+		err := rows.Scan(&delivery.DeliveryId, &delivery.PostId, &delivery.SubscriberId, &delivery.Status, &delivery.Error, &delivery.CreatedAt, &delivery.SentAt, &delivery.PostTitle, &delivery.Email)
+
+		if err != nil {
+			log.Print(err)
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// deliverLoop sends the queued mails one after the other, then waits for
+// other posts to be queued.
+func deliverLoop() {
+	for range deliverSignals {
+		for {
+			sent, err := deliverNext()
+
+			if err != nil {
+				log.Print(err)
+			}
+
+			if !sent {
+				break
+			}
+
+			time.Sleep(sendInterval)
+		}
+	}
+}
+
+// deliverNext sends the oldest queued mail and records its result, it
+// returns false when the queue is empty.
+func deliverNext() (bool, error) {
+	var id, postId, subscriberId int64
+
+	err := db.QueryRow("SELECT delivery_id, post_id, subscriber_id FROM newsletter_delivery WHERE status = ? ORDER BY delivery_id LIMIT 1", DeliveryQueued).Scan(&id, &postId, &subscriberId)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	status, message := DeliverySent, ""
+	err = deliver(postId, subscriberId)
+
+	if err != nil {
+		status, message = DeliveryFailed, err.Error()
+	}
+
+	_, err = db.Exec("UPDATE newsletter_delivery SET status = ?, error = ?, sent_at = ? WHERE delivery_id = ?", status, message, time.Now().Unix(), id)
+
+	if err != nil {
+		// the mail would be sent again and again otherwise
+		return false, err
+	}
+
+	return true, nil
+}
+
+func deliver(postId int64, subscriberId int64) error {
+	post, err := findPost(postId)
+
+	if err != nil {
+		return err
+	}
+
+	// the post may have been unpublished since it was queued
+	if !post.IsVisible() {
+		return ErrPostNotPublished
+	}
+
+	subscriber, err := Get(subscriberId)
+
+	if err != nil {
+		return err
+	}
+
+	return sendPost(post, subscriber)
+}
@@ -3,12 +3,25 @@ package page
 import (
 	"embed"
 	"errors"
+	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"net/url"
+	"strings"
 
+	"rsc.io/qr"
+
+	"valette.software/internal/authentication"
 	"valette.software/internal/blog"
+	"valette.software/internal/comment"
+	"valette.software/internal/markdownfile"
+	"valette.software/internal/media"
+	"valette.software/internal/newsletter"
 	"valette.software/internal/reqcontext"
+	"valette.software/internal/totp"
+	"valette.software/internal/user"
+	"valette.software/internal/webmention"
 )
 
 //go:embed template
@@ -20,6 +33,20 @@ type templateData struct {
 	Ctx reqcontext.ReqContext
 }
 
+type postsData struct {
+	templateData
+	Posts  []blog.RenderedPost
+	Tag    blog.Tag
+	Series blog.Series
+	Query  string
+}
+
+// PartNumber numbers the posts listed in a series from 1, the templates
+// can't add.
+func (data postsData) PartNumber(index int) int {
+	return index + 1
+}
+
 func Init() {
 	var err error
 	templates, err = template.New("").ParseFS(fsTemplate, "template/*.*")
@@ -40,35 +67,142 @@ func DisplayIndex(buf io.Writer, reqCtx reqcontext.ReqContext) error {
 }
 
 func DisplayPostsSummary(buf io.Writer, reqCtx reqcontext.ReqContext) error {
-	posts, err := blog.ListPosts(reqCtx.Localizer.Lang())
+	posts, err := blog.ListPosts(reqCtx.Localizer.Lang(), reqCtx.ShowsHiddenPosts())
+
+	if err != nil {
+		return err
+	}
+
+	return templates.ExecuteTemplate(buf, "posts.html", postsData{
+		templateData: templateData{Ctx: reqCtx}, Posts: posts,
+	})
+}
+
+// DisplayTagPosts lists the posts tagged with the tag whose slug is given,
+// it returns blog.ErrNotFound without writing anything if there is no such tag.
+func DisplayTagPosts(buf io.Writer, reqCtx reqcontext.ReqContext, slug string) error {
+	tag, err := blog.GetTagBySlug(reqCtx.Localizer.Lang(), slug)
+
+	if err != nil {
+		return err
+	}
+
+	posts, err := blog.ListPostsByTag(reqCtx.Localizer.Lang(), tag, reqCtx.ShowsHiddenPosts())
 
 	if err != nil {
 		return err
 	}
 
+	return templates.ExecuteTemplate(buf, "posts.html", postsData{
+		templateData: templateData{Ctx: reqCtx}, Posts: posts, Tag: tag,
+	})
+}
+
+// DisplaySeriesPosts lists the parts of the series whose slug is given in
+// their order, it returns blog.ErrNotFound without writing anything if there
+// is no such series.
+func DisplaySeriesPosts(buf io.Writer, reqCtx reqcontext.ReqContext, slug string) error {
+	series, err := blog.GetSeriesBySlug(reqCtx.Localizer.Lang(), slug)
+
+	if err != nil {
+		return err
+	}
+
+	posts, err := blog.ListSeriesPosts(series, reqCtx.ShowsHiddenPosts())
+
+	if err != nil {
+		return err
+	}
+
+	if len(posts) == 0 {
+		return blog.ErrNotFound
+	}
+
+	return templates.ExecuteTemplate(buf, "posts.html", postsData{
+		templateData: templateData{Ctx: reqCtx}, Posts: posts, Series: series,
+	})
+}
+
+// DisplayPost renders the article page with its approved comments, a post
+// without ID is rendered as not found. commentSent thanks the reader whose
+// comment was just saved.
+func DisplayPost(buf io.Writer, reqCtx reqcontext.ReqContext, post blog.RenderedPost, commentSent bool) error {
+	return displayPost(buf, reqCtx, post, commentForm{templateData: templateData{Ctx: reqCtx}, PostId: post.ArticleId, Sent: commentSent})
+}
+
+// DisplayRefusedComment renders the article with the form filled again with
+// the comment submitted, and the reason err it was refused.
+func DisplayRefusedComment(buf io.Writer, reqCtx reqcontext.ReqContext, post blog.RenderedPost, submitted comment.Comment, err error) error {
+	form := commentForm{
+		templateData: templateData{Ctx: reqCtx},
+		PostId:       post.ArticleId,
+		Author:       submitted.Author,
+		Email:        submitted.Email,
+		Content:      submitted.Content,
+		Error:        "Le commentaire n'a pas pu être enregistré.",
+	}
+
+	for known, message := range commentErrors {
+		if errors.Is(err, known) {
+			form.Error = message
+		}
+	}
+
+	return displayPost(buf, reqCtx, post, form)
+}
+
+func displayPost(buf io.Writer, reqCtx reqcontext.ReqContext, post blog.RenderedPost, form commentForm) error {
 	type data struct {
 		templateData
-		Posts []blog.RenderedPost
+		Post     blog.RenderedPost
+		Comments []comment.Comment
+		Mentions []webmention.Mention
+		Form     commentForm
 	}
 
-	return templates.ExecuteTemplate(buf, "posts.html", data{
-		templateData: templateData{Ctx: reqCtx}, Posts: posts,
+	var comments []comment.Comment
+	var mentions []webmention.Mention
+	var err error
+
+	if post.ArticleId != 0 {
+		comments, err = comment.ListApproved(post.ArticleId)
+
+		if err != nil {
+			return err
+		}
+
+		mentions, err = webmention.ListApproved(post.ArticleId)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return templates.ExecuteTemplate(buf, "post.html", data{
+		templateData: templateData{Ctx: reqCtx},
+		Post:         post,
+		Comments:     comments,
+		Mentions:     mentions,
+		Form:         form,
 	})
 }
 
-func DisplayPost(buf io.Writer, reqCtx reqcontext.ReqContext, slug string) error {
-	post, err := blog.GetPostBySlug(slug)
+func DisplaySearch(buf io.Writer, reqCtx reqcontext.ReqContext, query string) error {
+	results, err := blog.Search(reqCtx.Localizer.Lang(), query, reqCtx.ShowsHiddenPosts())
 
-	if errors.Is(err, blog.ErrNotFound) {
-		return templates.ExecuteTemplate(buf, "post.html", nil)
+	if err != nil {
+		return err
 	}
 
 	type data struct {
 		templateData
-		Post blog.RenderedPost
+		Query   string
+		Results []blog.SearchResult
 	}
 
-	return templates.ExecuteTemplate(buf, "post.html", data{templateData: templateData{Ctx: reqCtx}, Post: post})
+	return templates.ExecuteTemplate(buf, "search.html", data{
+		templateData: templateData{Ctx: reqCtx}, Query: query, Results: results,
+	})
 }
 
 func DisplayContactFormSuccess(buf io.Writer, reqCtx reqcontext.ReqContext) error {
@@ -79,8 +213,8 @@ func DisplayAgenda(buf io.Writer) error {
 	return templates.ExecuteTemplate(buf, "agenda.html", nil)
 }
 
-func DisplayAdmin(buf io.Writer) error {
-	articles, err := blog.ListPosts("")
+func DisplayAdmin(buf io.Writer, editor user.User) error {
+	articles, err := blog.ListPosts("", true)
 
 	if err != nil {
 		return err
@@ -91,35 +225,113 @@ func DisplayAdmin(buf io.Writer) error {
 		Post   blog.RenderedPost
 	}
 
+	articles = editorPosts(articles, editor)
 	ps := make([]listItem, 0, len(articles))
 
 	for _, p := range articles {
 		ps = append(ps, listItem{Status: "update", Post: p})
 	}
 
+	otherPosts, err := listOtherPosts(0, editor)
+
+	if err != nil {
+		return err
+	}
+
 	type data struct {
-		Posts []listItem
+		Posts  []listItem
+		Editor postEditData
 	}
 
-	return templates.ExecuteTemplate(buf, "admin.html", data{ps})
+	return templates.ExecuteTemplate(buf, "admin.html", data{Posts: ps, Editor: postEditData{OtherPosts: otherPosts, User: editor}})
 }
 
-func DisplayPostEdition(buf io.Writer, post blog.RenderedPost) error {
-	type data struct {
-		Post blog.RenderedPost
+// editorPosts keeps the posts listed to the user in the admin area, the
+// contributors only see theirs.
+func editorPosts(posts []blog.RenderedPost, editor user.User) []blog.RenderedPost {
+	if editor.HasRole(user.RoleEditor) {
+		return posts
+	}
+
+	own := make([]blog.RenderedPost, 0, len(posts))
+
+	for _, post := range posts {
+		if post.UserId == editor.UserId {
+			own = append(own, post)
+		}
 	}
 
-	return templates.ExecuteTemplate(buf, "post-edit.html", data{Post: post})
+	return own
 }
 
-func DisplayPostNew(buf io.Writer) error {
-	return templates.ExecuteTemplate(buf, "post-edit.html", nil)
+type postEditData struct {
+	Post       blog.RenderedPost
+	OtherPosts []blog.RenderedPost
+	// User is the one editing, the author of the new posts.
+	User user.User
+}
+
+func DisplayPostEdition(buf io.Writer, post blog.RenderedPost, editor user.User) error {
+	otherPosts, err := listOtherPosts(post.ArticleId, editor)
+
+	if err != nil {
+		return err
+	}
+
+	return templates.ExecuteTemplate(buf, "post-edit.html", postEditData{Post: post, OtherPosts: otherPosts, User: editor})
+}
+
+func DisplayPostNew(buf io.Writer, editor user.User) error {
+	otherPosts, err := listOtherPosts(0, editor)
+
+	if err != nil {
+		return err
+	}
+
+	return templates.ExecuteTemplate(buf, "post-edit.html", postEditData{OtherPosts: otherPosts, User: editor})
+}
+
+// listOtherPosts returns the posts except the one being edited, they are the
+// candidates for its translation. The contributors only get the visible posts
+// and theirs, as in the admin list.
+func listOtherPosts(editedId int64, editor user.User) ([]blog.RenderedPost, error) {
+	posts, err := blog.ListPosts("", true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	otherPosts := make([]blog.RenderedPost, 0, len(posts))
+
+	for _, post := range posts {
+		if post.ArticleId == editedId {
+			continue
+		}
+
+		if editor.HasRole(user.RoleEditor) || post.IsVisible() || post.UserId == editor.UserId {
+			otherPosts = append(otherPosts, post)
+		}
+	}
+
+	return otherPosts, nil
 }
 
 func DisplayLoginForm(buf io.Writer) error {
 	return templates.ExecuteTemplate(buf, "admin-login.html", nil)
 }
 
+// DisplayLoginVerify renders the form of the second factor, asked after the
+// password, with the error of the code typed before.
+func DisplayLoginVerify(buf io.Writer, err error) error {
+	message := ""
+
+	if err != nil {
+		message = err.Error()
+	}
+
+	return templates.ExecuteTemplate(buf, "admin-login-verify.html", message)
+}
+
 func DisplayPostListItem(buf io.Writer, post blog.RenderedPost, status string) error {
 	type data struct {
 		Status string
@@ -128,3 +340,443 @@ func DisplayPostListItem(buf io.Writer, post blog.RenderedPost, status string) e
 
 	return templates.ExecuteTemplate(buf, "post-edit-list-item.html", data{Status: status, Post: post})
 }
+
+func DisplayRevisions(buf io.Writer, post blog.RenderedPost, revisions []blog.Revision) error {
+	type data struct {
+		Post      blog.RenderedPost
+		Revisions []blog.Revision
+	}
+
+	return templates.ExecuteTemplate(buf, "post-revisions.html", data{Post: post, Revisions: revisions})
+}
+
+func DisplayRevisionDiff(buf io.Writer, from blog.Revision, to blog.Revision, diffs []blog.FieldDiff) error {
+	type data struct {
+		From  blog.Revision
+		To    blog.Revision
+		Diffs []blog.FieldDiff
+	}
+
+	return templates.ExecuteTemplate(buf, "post-revision-diff.html", data{From: from, To: to, Diffs: diffs})
+}
+
+func DisplayTags(buf io.Writer) error {
+	tags, err := blog.ListTags()
+
+	if err != nil {
+		return err
+	}
+
+	type data struct {
+		Tags []blog.TagNames
+	}
+
+	return templates.ExecuteTemplate(buf, "admin-tags.html", data{Tags: tags})
+}
+
+// DisplayPostList renders the admin's list of posts, without replacing the
+// cards already displayed.
+func DisplayPostList(buf io.Writer, posts []blog.RenderedPost, editor user.User) error {
+	for _, post := range editorPosts(posts, editor) {
+		err := DisplayPostListItem(buf, post, "list")
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DisplayEditorError shows why the post in the editor couldn't be saved.
+func DisplayEditorError(buf io.Writer, err error) error {
+	return templates.ExecuteTemplate(buf, "post-edit-error.html", err.Error())
+}
+
+type mediaItem struct {
+	Status string
+	Picker bool
+	Media  media.Media
+}
+
+// DisplayMedia renders the media library.
+func DisplayMedia(buf io.Writer) error {
+	return displayMediaList(buf, "admin-media.html", false)
+}
+
+// DisplayMediaPicker renders the content of the editor's dialog choosing an
+// image to insert in the post.
+func DisplayMediaPicker(buf io.Writer) error {
+	return displayMediaList(buf, "media-picker.html", true)
+}
+
+func displayMediaList(buf io.Writer, name string, picker bool) error {
+	allMedia, err := media.List()
+
+	if err != nil {
+		return err
+	}
+
+	items := make([]mediaItem, 0, len(allMedia))
+
+	for _, m := range allMedia {
+		items = append(items, mediaItem{Picker: picker, Media: m})
+	}
+
+	type data struct {
+		Media []mediaItem
+	}
+
+	return templates.ExecuteTemplate(buf, name, data{Media: items})
+}
+
+// DisplayMediaItem renders an uploaded file, in the picker or in the media
+// library.
+func DisplayMediaItem(buf io.Writer, m media.Media, status string, picker bool) error {
+	return templates.ExecuteTemplate(buf, "media-item.html", mediaItem{Status: status, Picker: picker, Media: m})
+}
+
+// DisplayMediaError shows why a file couldn't be uploaded.
+func DisplayMediaError(buf io.Writer, err error) error {
+	return templates.ExecuteTemplate(buf, "media-error.html", err.Error())
+}
+
+// DisplayImportReport lists the files imported and the ones skipped, or why
+// the archive couldn't be read at all.
+func DisplayImportReport(buf io.Writer, report markdownfile.Report, err error) error {
+	type data struct {
+		Report markdownfile.Report
+		Error  string
+	}
+
+	message := ""
+
+	if err != nil {
+		message = err.Error()
+	}
+
+	return templates.ExecuteTemplate(buf, "import-report.html", data{Report: report, Error: message})
+}
+
+// commentForm is the form under the articles, filled again with what the
+// reader wrote when the comment is refused.
+type commentForm struct {
+	templateData
+	PostId  int64
+	Author  string
+	Email   string
+	Content string
+	Error   string
+	Sent    bool
+}
+
+// commentErrors are the messages shown to the readers, translated in the
+// template.
+var commentErrors = map[error]string{
+	comment.ErrAuthorMissing:  "Indiquez votre nom.",
+	comment.ErrContentMissing: "Le commentaire est vide.",
+	comment.ErrTooLong:        "Le commentaire est trop long.",
+	comment.ErrPostNotFound:   "Cet article ne peut pas être commenté.",
+}
+
+type commentCard struct {
+	Oob     bool
+	Comment comment.Comment
+}
+
+// DisplayComments renders the moderation queue, listing the comments with
+// the status.
+func DisplayComments(buf io.Writer, status string) error {
+	comments, err := comment.ListByStatus(status)
+
+	if err != nil {
+		return err
+	}
+
+	cards := make([]commentCard, 0, len(comments))
+
+	for _, c := range comments {
+		cards = append(cards, commentCard{Comment: c})
+	}
+
+	type data struct {
+		Status   string
+		Statuses []string
+		Comments []commentCard
+	}
+
+	return templates.ExecuteTemplate(buf, "admin-comments.html", data{
+		Status:   status,
+		Statuses: []string{comment.StatusPending, comment.StatusApproved, comment.StatusSpam},
+		Comments: cards,
+	})
+}
+
+// DisplayCommentCard renders a comment of the moderation queue, after its
+// status changed.
+func DisplayCommentCard(buf io.Writer, c comment.Comment) error {
+	return templates.ExecuteTemplate(buf, "comment-card.html", commentCard{Comment: c})
+}
+
+// DisplayCommentReply renders the reply of the admin, and the comment it
+// answers out of band since the reply approved it.
+func DisplayCommentReply(buf io.Writer, reply comment.Comment, parent comment.Comment) error {
+	err := templates.ExecuteTemplate(buf, "comment-card.html", commentCard{Comment: reply})
+
+	if err != nil {
+		return err
+	}
+
+	return templates.ExecuteTemplate(buf, "comment-card.html", commentCard{Oob: true, Comment: parent})
+}
+
+// DisplayWebmentions renders the moderation queue of the mentions received
+// from other sites, listing the ones with the status.
+func DisplayWebmentions(buf io.Writer, status string) error {
+	mentions, err := webmention.ListByStatus(status)
+
+	if err != nil {
+		return err
+	}
+
+	type data struct {
+		Status   string
+		Statuses []string
+		Mentions []webmention.Mention
+	}
+
+	return templates.ExecuteTemplate(buf, "admin-webmentions.html", data{
+		Status:   status,
+		Statuses: []string{webmention.StatusPending, webmention.StatusApproved, webmention.StatusSpam, webmention.StatusInvalid},
+		Mentions: mentions,
+	})
+}
+
+// DisplayWebmentionCard renders a mention of the moderation queue, after its
+// status changed.
+func DisplayWebmentionCard(buf io.Writer, mention webmention.Mention) error {
+	return templates.ExecuteTemplate(buf, "webmention-card.html", mention)
+}
+
+// newsletterErrors are the messages shown to the readers, translated in the
+// template.
+var newsletterErrors = map[error]string{
+	newsletter.ErrInvalidEmail: "L'adresse email n'est pas valide.",
+	newsletter.ErrLanguage:     "Il n'y a pas de newsletter dans cette langue.",
+}
+
+// DisplayNewsletterSubscription renders the page answering a subscription,
+// err is the reason it failed if any.
+func DisplayNewsletterSubscription(buf io.Writer, reqCtx reqcontext.ReqContext, err error) error {
+	type data struct {
+		templateData
+		Result string
+		Error  string
+	}
+
+	result, message := "subscribed", ""
+
+	if err != nil {
+		result, message = "refused", "L'inscription n'a pas pu être enregistrée."
+
+		for known, text := range newsletterErrors {
+			if errors.Is(err, known) {
+				message = text
+			}
+		}
+	}
+
+	return templates.ExecuteTemplate(buf, "newsletter.html", data{templateData: templateData{Ctx: reqCtx}, Result: result, Error: message})
+}
+
+// DisplayNewsletterLink renders the page of a link mailed to a subscriber:
+// result is "confirmed", "unsubscribed", "invalid", or "unsubscribe" to ask
+// before unsubscribing with the signature.
+func DisplayNewsletterLink(buf io.Writer, reqCtx reqcontext.ReqContext, result string, id int64, signature string) error {
+	type data struct {
+		templateData
+		Result    string
+		Id        int64
+		Signature string
+	}
+
+	return templates.ExecuteTemplate(buf, "newsletter.html", data{
+		templateData: templateData{Ctx: reqCtx}, Result: result, Id: id, Signature: signature,
+	})
+}
+
+// DisplayNewsletter renders the subscribers and the mails sent to them.
+func DisplayNewsletter(buf io.Writer) error {
+	subscribers, err := newsletter.ListSubscribers()
+
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := newsletter.ListDeliveries()
+
+	if err != nil {
+		return err
+	}
+
+	type data struct {
+		Subscribers []newsletter.Subscriber
+		Deliveries  []newsletter.Delivery
+	}
+
+	return templates.ExecuteTemplate(buf, "admin-newsletter.html", data{Subscribers: subscribers, Deliveries: deliveries})
+}
+
+// DisplayUsers renders the accounts of the admin area.
+func DisplayUsers(buf io.Writer) error {
+	return displayUsers(buf, "admin-users.html", nil)
+}
+
+// DisplayUserList renders the accounts after a change, with the error
+// which prevented it.
+func DisplayUserList(buf io.Writer, err error) error {
+	return displayUsers(buf, "user-list", err)
+}
+
+func displayUsers(buf io.Writer, name string, err error) error {
+	users, listErr := user.List()
+
+	if listErr != nil {
+		return listErr
+	}
+
+	type data struct {
+		Users []user.User
+		Roles []string
+		Error string
+	}
+
+	listed := data{Users: users, Roles: user.Roles}
+
+	if err != nil {
+		listed.Error = err.Error()
+	}
+
+	return templates.ExecuteTemplate(buf, name, listed)
+}
+
+// DisplaySessions renders the sessions open that the user logged in may end.
+func DisplaySessions(buf io.Writer, reqCtx reqcontext.ReqContext) error {
+	sessions, err := authentication.ListSessions(reqCtx.User)
+
+	if err != nil {
+		return err
+	}
+
+	type data struct {
+		Sessions  []authentication.Session
+		Current   int64
+		ShowUsers bool
+	}
+
+	return templates.ExecuteTemplate(buf, "admin-sessions.html", data{
+		Sessions: sessions, Current: reqCtx.SessionId, ShowUsers: reqCtx.User.HasRole(user.RoleOwner),
+	})
+}
+
+// DisplaySecondFactor renders the page of the second factor of the user
+// logged in.
+func DisplaySecondFactor(buf io.Writer, reqCtx reqcontext.ReqContext) error {
+	return displaySecondFactor(buf, "admin-2fa.html", reqCtx, nil, nil)
+}
+
+// DisplaySecondFactorStatus renders the second factor after a change, with
+// the recovery codes just generated, shown only once, or the error which
+// prevented the change.
+func DisplaySecondFactorStatus(buf io.Writer, reqCtx reqcontext.ReqContext, codes []string, err error) error {
+	return displaySecondFactor(buf, "totp", reqCtx, codes, err)
+}
+
+func displaySecondFactor(buf io.Writer, name string, reqCtx reqcontext.ReqContext, codes []string, err error) error {
+	status, statusErr := user.GetTotp(reqCtx.User.UserId)
+
+	if statusErr != nil {
+		return statusErr
+	}
+
+	type data struct {
+		Totp  user.Totp
+		Qr    template.HTML
+		Codes []string
+		Error string
+	}
+
+	shown := data{Totp: status, Codes: codes}
+
+	if err != nil {
+		shown.Error = err.Error()
+	}
+
+	// the secret is only known while the second factor is being enabled
+	if status.Secret != "" {
+		issuer := reqCtx.BaseUrl
+
+		if base, err := url.Parse(reqCtx.BaseUrl); err == nil && base.Host != "" {
+			issuer = base.Host
+		}
+
+		shown.Qr, err = qrSvg(totp.KeyUri(issuer, reqCtx.User.Username, status.Secret))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return templates.ExecuteTemplate(buf, name, shown)
+}
+
+// qrSvg draws the QR code of the text, the authenticator apps scan it from
+// the screen. The page needs no script nor image file.
+func qrSvg(text string) (template.HTML, error) {
+	code, err := qr.Encode(text, qr.M)
+
+	if err != nil {
+		return "", err
+	}
+
+	// the quiet zone around the code is 4 modules wide
+	size := code.Size + 8
+	svg := strings.Builder{}
+
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`, size, size, size*5, size*5)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="white"/><path fill="black" d="`, size, size)
+
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&svg, "M%d %dh1v1h-1z", x+4, y+4)
+			}
+		}
+	}
+
+	svg.WriteString(`"/></svg>`)
+
+	return template.HTML(svg.String()), nil
+}
+
+// DisplayPasskeys renders the passkeys of the user logged in.
+func DisplayPasskeys(buf io.Writer, reqCtx reqcontext.ReqContext) error {
+	passkeys, err := user.ListPasskeys(reqCtx.User.UserId)
+
+	if err != nil {
+		return err
+	}
+
+	hasTotp, err := user.HasTotp(reqCtx.User.UserId)
+
+	if err != nil {
+		return err
+	}
+
+	type data struct {
+		Passkeys []user.Passkey
+		HasTotp  bool
+	}
+
+	return templates.ExecuteTemplate(buf, "admin-passkeys.html", data{Passkeys: passkeys, HasTotp: hasTotp})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"valette.software/internal/i18n"
+	"valette.software/internal/user"
 )
 
 const requestContextKey = iota
@@ -12,6 +13,11 @@ type ReqContext struct {
 	Localizer   i18n.Localizer
 	CurrentPath string
 	Admin       bool
+	BaseUrl     string
+	// User is the account logged in, it has no ID for the visitors.
+	User user.User
+	// SessionId is the session of the user logged in.
+	SessionId int64
 }
 
 func NewContext() ReqContext {
@@ -19,9 +25,18 @@ func NewContext() ReqContext {
 		Localizer:   nil,
 		CurrentPath: "",
 		Admin:       false,
+		BaseUrl:     "",
+		User:        user.User{},
 	}
 }
 
+// ShowsHiddenPosts tells whether the drafts, the scheduled and the archived
+// posts are listed to the user on the pages of the site. The contributors
+// only see the published ones, like the visitors.
+func (reqCtx ReqContext) ShowsHiddenPosts() bool {
+	return reqCtx.User.HasRole(user.RoleEditor)
+}
+
 func SetValue(ctx context.Context, value ReqContext) context.Context {
 	return context.WithValue(ctx, requestContextKey, value)
 }
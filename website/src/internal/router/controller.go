@@ -1,15 +1,30 @@
 package router
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"valette.software/internal/authentication"
 	"valette.software/internal/blog"
+	"valette.software/internal/comment"
+	"valette.software/internal/feed"
+	"valette.software/internal/markdownfile"
+	"valette.software/internal/media"
+	"valette.software/internal/newsletter"
 	"valette.software/internal/page"
 	"valette.software/internal/reqcontext"
+	"valette.software/internal/sitemap"
+	"valette.software/internal/user"
+	"valette.software/internal/webauthn"
+	"valette.software/internal/webmention"
 )
 
 func getAgenda(res http.ResponseWriter, req *http.Request) {
@@ -23,12 +38,153 @@ func indexPage(res http.ResponseWriter, req *http.Request) {
 
 func getPost(res http.ResponseWriter, req *http.Request) {
 	reqCtx := reqcontext.GetValue(req.Context())
+	lang := reqCtx.Localizer.Lang()
 
-	printError(page.DisplayPost(res, reqCtx, req.PathValue("name")))
+	slug := req.PathValue("name")
+
+	post, err := blog.GetPostBySlug(lang, slug, reqCtx.ShowsHiddenPosts())
+
+	if errors.Is(err, blog.ErrNotFound) {
+		// the links shared before a change of slug lead to the current one
+		if moved, err := blog.FindMovedPost(lang, slug, reqCtx.ShowsHiddenPosts()); err == nil {
+			http.Redirect(res, req, "/"+moved.Language+"/articles/"+moved.Slug, http.StatusMovedPermanently)
+			return
+		}
+
+		res.WriteHeader(404)
+		printError(page.DisplayPost(res, reqCtx, blog.RenderedPost{}, false))
+		return
+	} else if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+		return
+	}
+
+	// a post followed in the other language leads to its translation, or to
+	// its own address, each article is published at one address only
+	if post.Language != lang {
+		target := "/" + post.Language + "/articles/" + post.Slug
+
+		if translation, ok := post.TranslationIn(lang); ok {
+			target = reqCtx.Localizer.Link("/articles/" + translation.Slug)
+		}
+
+		http.Redirect(res, req, target, http.StatusMovedPermanently)
+		return
+	}
+
+	printError(page.DisplayPost(res, reqCtx, post, req.FormValue("comment") == "sent"))
+}
+
+func listTagPosts(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	err := page.DisplayTagPosts(res, reqCtx, req.PathValue("tag"))
+
+	if errors.Is(err, blog.ErrNotFound) {
+		http.NotFound(res, req)
+		return
+	}
+
+	printError(err)
+}
+
+func listSeriesPosts(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	err := page.DisplaySeriesPosts(res, reqCtx, req.PathValue("series"))
+
+	if errors.Is(err, blog.ErrNotFound) {
+		http.NotFound(res, req)
+		return
+	}
+
+	printError(err)
+}
+
+func searchPosts(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	printError(page.DisplaySearch(res, reqCtx, req.FormValue("q")))
+}
+
+func getAtomFeed(res http.ResponseWriter, req *http.Request) {
+	writeFeed(res, req, "application/atom+xml", feed.WriteAtom)
+}
+
+func getRssFeed(res http.ResponseWriter, req *http.Request) {
+	writeFeed(res, req, "application/rss+xml", feed.WriteRss)
+}
+
+func writeFeed(res http.ResponseWriter, req *http.Request, contentType string, write func(io.Writer, feed.Feed) error) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	lang := reqCtx.Localizer.Lang()
+
+	// the feeds are public, the admin's hidden posts must never leak into them
+	posts, err := blog.ListLatestPosts(lang, 20)
+
+	if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+		return
+	}
+
+	res.Header().Set("Content-Type", contentType+"; charset=utf-8")
+
+	printError(write(res, feed.Feed{
+		Title:   "Valette Software - " + reqCtx.Localizer.Get("Articles (menu)"),
+		Lang:    lang,
+		BaseUrl: reqCtx.BaseUrl,
+		Posts:   posts,
+	}))
+}
+
+func getHighlightCss(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "text/css; charset=utf-8")
+
+	printError(blog.WriteHighlightCss(res))
+}
+
+func getRobots(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	printError(sitemap.WriteRobots(res, reqCtx.BaseUrl))
+}
+
+func getSitemapIndex(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	res.Header().Set("Content-Type", "application/xml; charset=utf-8")
+
+	printError(sitemap.WriteIndex(res, reqCtx.BaseUrl))
+}
+
+func getSitemap(lang string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		reqCtx := reqcontext.GetValue(req.Context())
+		buf := bytes.Buffer{}
+
+		err := sitemap.WriteLanguage(&buf, reqCtx.BaseUrl, lang, publicPages)
+
+		if err != nil {
+			res.WriteHeader(500)
+			log.Print(err)
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		_, err = buf.WriteTo(res)
+
+		printError(err)
+	}
 }
 
 func adminPage(res http.ResponseWriter, req *http.Request) {
-	printError(page.DisplayAdmin(res))
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	printError(page.DisplayAdmin(res, reqCtx.User))
 }
 
 func listPosts(res http.ResponseWriter, req *http.Request) {
@@ -38,35 +194,83 @@ func listPosts(res http.ResponseWriter, req *http.Request) {
 }
 
 func login(res http.ResponseWriter, req *http.Request) {
-	sessionId, err := authentication.Authenticate(req.FormValue("password"))
+	token, pending, err := authentication.Authenticate(req.FormValue("username"), req.FormValue("password"), req.UserAgent(), clientIp(req))
 
 	if err != nil {
 		printError(page.DisplayLoginForm(res))
 		return
 	}
 
-	sessionCookie := http.Cookie{
+	if pending {
+		http.SetCookie(res, sessionCookie(req, token, int(authentication.PendingTimeout.Seconds())))
+		printError(page.DisplayLoginVerify(res, nil))
+		return
+	}
+
+	http.SetCookie(res, sessionCookie(req, token, int(authentication.AbsoluteTimeout.Seconds())))
+
+	req.Method = "GET"
+	http.Redirect(res, req, "/admin", 303)
+}
+
+// verifyLogin opens the session waiting for the second factor of the user.
+func verifyLogin(res http.ResponseWriter, req *http.Request) {
+	token, err := authentication.VerifySecondFactor(getSessionId(req), req.FormValue("code"))
+
+	if errors.Is(err, user.ErrInvalidCode) || errors.Is(err, user.ErrSecondFactorLocked) {
+		printError(page.DisplayLoginVerify(res, err))
+		return
+	} else if err != nil {
+		// the session ended, the password must be typed again
+		http.SetCookie(res, sessionCookie(req, "", -1))
+		printError(page.DisplayLoginForm(res))
+		return
+	}
+
+	http.SetCookie(res, sessionCookie(req, token, int(authentication.AbsoluteTimeout.Seconds())))
+
+	req.Method = "GET"
+	http.Redirect(res, req, "/admin", 303)
+}
+
+// sessionCookie holds the token of the session, it is only sent over HTTPS
+// when the site is published with it, and never with the requests started
+// by the other sites but the links followed.
+func sessionCookie(req *http.Request, token string, maxAge int) *http.Cookie {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	return &http.Cookie{
 		HttpOnly: true,
+		Secure:   strings.HasPrefix(reqCtx.BaseUrl, "https://"),
+		SameSite: http.SameSiteLaxMode,
 		Path:     "/",
 		Name:     "session-id",
-		Value:    sessionId,
+		Value:    token,
+		MaxAge:   maxAge,
 	}
+}
 
-	http.SetCookie(res, &sessionCookie)
+// clientIp is the address the request comes from, without its port.
+func clientIp(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
 
-	req.Method = "GET"
-	http.Redirect(res, req, "/admin", 303)
+	if err != nil {
+		return req.RemoteAddr
+	}
 
-	printError(page.DisplayAdmin(res))
+	return host
 }
 
 func logout(res http.ResponseWriter, req *http.Request) {
-	authentication.Logout()
+	printError(authentication.Logout(getSessionId(req)))
+	http.SetCookie(res, sessionCookie(req, "", -1))
 	http.Redirect(res, req, "/", http.StatusTemporaryRedirect)
 }
 
 func newPostController(res http.ResponseWriter, req *http.Request) {
-	printError(page.DisplayPostNew(res))
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	printError(page.DisplayPostNew(res, reqCtx.User))
 }
 
 func getEditablePost(res http.ResponseWriter, req *http.Request) {
@@ -89,10 +293,47 @@ func getEditablePost(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	printError(page.DisplayPostEdition(res, post))
+	if !canEditPost(res, req, post.Post) {
+		return
+	}
+
+	printError(page.DisplayPostEdition(res, post, reqcontext.GetValue(req.Context()).User))
+}
+
+// canEditPost refuses the post to the contributors who can't edit it.
+func canEditPost(res http.ResponseWriter, req *http.Request, post blog.Post) bool {
+	if reqcontext.GetValue(req.Context()).User.CanEditPost(post) {
+		return true
+	}
+
+	res.WriteHeader(http.StatusForbidden)
+	res.Write([]byte("you can only edit your own drafts"))
+
+	return false
+}
+
+// postAuthor is the author of the post saved by editor, the contributors
+// always sign with their name.
+func postAuthor(editor user.User, submitted string) string {
+	if submitted == "" || !editor.HasRole(user.RoleEditor) {
+		return editor.DisplayName
+	}
+
+	return submitted
+}
+
+// postStatus is the status of the post saved by editor, the contributors
+// only write drafts.
+func postStatus(editor user.User, submitted string, publishAt int64) (string, int64) {
+	if !editor.HasRole(user.RoleEditor) {
+		return blog.StatusDraft, 0
+	}
+
+	return submitted, publishAt
 }
 
 func createPost(res http.ResponseWriter, req *http.Request) {
+	editor := reqcontext.GetValue(req.Context()).User
 	date, err := time.Parse("2006-01-02", req.FormValue("date"))
 
 	if err != nil {
@@ -103,23 +344,39 @@ func createPost(res http.ResponseWriter, req *http.Request) {
 		Author:    req.FormValue("author"),
 		Language:  req.FormValue("language"),
 		Title:     req.FormValue("title"),
+		Slug:      req.FormValue("slug"),
 		Timestamp: date.Unix(),
 		Summary:   req.FormValue("summary"),
 		Content:   req.FormValue("content"),
+		Status:    req.FormValue("status"),
+		PublishAt: parsePublishAt(req),
+		Tags:      blog.ParseTags(req.FormValue("tags")),
+
+		Series:       parseSeries(req),
+		Translations: parseTranslation(req),
+		UserId:       editor.UserId,
+		// the HTML of a contributor would run in the session of the
+		// editors reading the draft
+		SkipHtml: !editor.HasRole(user.RoleEditor),
 	}
 
-	renderedPost, err := blog.AddPost(newPost)
+	newPost.Author = postAuthor(editor, newPost.Author)
+	newPost.Status, newPost.PublishAt = postStatus(editor, newPost.Status, newPost.PublishAt)
+
+	renderedPost, err := blog.AddPost(newPost, editorName(req))
 
 	if err != nil {
-		res.WriteHeader(500)
+		printError(page.DisplayEditorError(res, err))
 		log.Print(err)
+		return
 	}
 
 	printError(page.DisplayPostListItem(res, renderedPost, "new"))
-	printError(page.DisplayPostEdition(res, renderedPost))
+	printError(page.DisplayPostEdition(res, renderedPost, editor))
 }
 
 func updatePost(res http.ResponseWriter, req *http.Request) {
+	editor := reqcontext.GetValue(req.Context()).User
 	id, err := strconv.ParseInt(req.FormValue("id"), 10, 64)
 
 	if err != nil {
@@ -128,6 +385,20 @@ func updatePost(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	saved, err := blog.GetPostById(id)
+
+	if errors.Is(err, blog.ErrNotFound) {
+		res.WriteHeader(404)
+		return
+	} else if err != nil {
+		res.WriteHeader(500)
+		return
+	}
+
+	if !canEditPost(res, req, saved.Post) {
+		return
+	}
+
 	date, err := time.Parse("2006-01-02", req.FormValue("date"))
 
 	if err != nil {
@@ -144,19 +415,27 @@ func updatePost(res http.ResponseWriter, req *http.Request) {
 			Timestamp: date.Unix(),
 			Summary:   req.FormValue("summary"),
 			Content:   req.FormValue("content"),
+			Status:    req.FormValue("status"),
+			PublishAt: parsePublishAt(req),
 		},
+		Tags:         blog.ParseTags(req.FormValue("tags")),
+		Series:       parseSeries(req),
+		Translations: parseTranslation(req),
 	}
 
-	renderedPost, err := blog.UpdatePost(newPost)
+	newPost.Author = postAuthor(editor, newPost.Author)
+	newPost.Status, newPost.PublishAt = postStatus(editor, newPost.Status, newPost.PublishAt)
+
+	renderedPost, err := blog.UpdatePost(newPost, editorName(req))
 
 	if err != nil {
-		res.Write([]byte(err.Error()))
+		printError(page.DisplayEditorError(res, err))
 		log.Print(err)
 		return
 	}
 
 	printError(page.DisplayPostListItem(res, renderedPost, "update"))
-	printError(page.DisplayPostEdition(res, renderedPost))
+	printError(page.DisplayPostEdition(res, renderedPost, editor))
 }
 
 func deletePost(res http.ResponseWriter, req *http.Request) {
@@ -184,5 +463,888 @@ func deletePost(res http.ResponseWriter, req *http.Request) {
 	}
 
 	printError(page.DisplayPostListItem(res, blog.RenderedPost{Post: blog.Post{ArticleId: id}}, "delete"))
-	printError(page.DisplayPostNew(res))
+	printError(page.DisplayPostNew(res, reqcontext.GetValue(req.Context()).User))
+}
+
+func publishPost(res http.ResponseWriter, req *http.Request) {
+	changePublication(res, req, blog.PublishPost)
+}
+
+func unpublishPost(res http.ResponseWriter, req *http.Request) {
+	changePublication(res, req, blog.UnpublishPost)
+}
+
+func changePublication(res http.ResponseWriter, req *http.Request, change func(int64) (blog.RenderedPost, error)) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the post's ID must be an integer"))
+		return
+	}
+
+	renderedPost, err := change(id)
+
+	if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+		return
+	}
+
+	printError(page.DisplayPostListItem(res, renderedPost, "update"))
+	printError(page.DisplayPostEdition(res, renderedPost, reqcontext.GetValue(req.Context()).User))
+}
+
+func listRevisions(res http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the post's ID must be an integer"))
+		return
+	}
+
+	post, err := blog.GetPostById(id)
+
+	if err != nil {
+		res.WriteHeader(404)
+		return
+	}
+
+	if !canEditPost(res, req, post.Post) {
+		return
+	}
+
+	revisions, err := blog.ListRevisions(id)
+
+	if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+		return
+	}
+
+	printError(page.DisplayRevisions(res, post, revisions))
+}
+
+func compareRevisions(res http.ResponseWriter, req *http.Request) {
+	id, errId := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	fromId, errFrom := strconv.ParseInt(req.FormValue("from"), 10, 64)
+	toId, errTo := strconv.ParseInt(req.FormValue("to"), 10, 64)
+
+	if errId != nil || errFrom != nil || errTo != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the post and revisions' IDs must be integers"))
+		return
+	}
+
+	post, err := blog.GetPostById(id)
+
+	if err != nil {
+		res.WriteHeader(404)
+		return
+	}
+
+	if !canEditPost(res, req, post.Post) {
+		return
+	}
+
+	from, errFrom := blog.GetRevision(id, fromId)
+	to, errTo := blog.GetRevision(id, toId)
+
+	if errFrom != nil || errTo != nil {
+		res.WriteHeader(404)
+		res.Write([]byte("revision not found"))
+		return
+	}
+
+	printError(page.DisplayRevisionDiff(res, from, to, blog.CompareRevisions(from, to)))
+}
+
+func restoreRevision(res http.ResponseWriter, req *http.Request) {
+	id, errId := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	revisionId, errRevision := strconv.ParseInt(req.PathValue("revision"), 10, 64)
+
+	if errId != nil || errRevision != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the post and revision's IDs must be integers"))
+		return
+	}
+
+	renderedPost, err := blog.RestoreRevision(id, revisionId, editorName(req))
+
+	if errors.Is(err, blog.ErrNotFound) {
+		res.WriteHeader(404)
+		return
+	} else if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+		return
+	}
+
+	printError(page.DisplayPostListItem(res, renderedPost, "update"))
+	printError(page.DisplayPostEdition(res, renderedPost, reqcontext.GetValue(req.Context()).User))
+}
+
+func adminSearch(res http.ResponseWriter, req *http.Request) {
+	query := req.FormValue("q")
+	var posts []blog.RenderedPost
+	var err error
+
+	if strings.TrimSpace(query) == "" {
+		posts, err = blog.ListPosts("", true)
+	} else {
+		var results []blog.SearchResult
+		results, err = blog.Search("", query, true)
+
+		for _, result := range results {
+			posts = append(posts, result.RenderedPost)
+		}
+	}
+
+	if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+		return
+	}
+
+	printError(page.DisplayPostList(res, posts, reqcontext.GetValue(req.Context()).User))
+}
+
+func tagsPage(res http.ResponseWriter, req *http.Request) {
+	printError(page.DisplayTags(res))
+}
+
+func renameTag(res http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the tag's ID must be an integer"))
+		return
+	}
+
+	names := map[string]string{}
+
+	for _, lang := range []string{"fr", "en"} {
+		names[lang] = req.FormValue("name-" + lang)
+	}
+
+	if err := blog.RenameTag(id, names); err != nil {
+		res.Write([]byte(err.Error()))
+		log.Print(err)
+		return
+	}
+
+	res.Write([]byte("saved"))
+}
+
+// editorName is the name recorded in the revisions saved by the request, the
+// username of the user logged in.
+func editorName(req *http.Request) string {
+	return reqcontext.GetValue(req.Context()).User.Username
+}
+
+// parseTranslation reads the post the edited one is a translation of.
+func parseTranslation(req *http.Request) []blog.Translation {
+	id, err := strconv.ParseInt(req.FormValue("translation_of"), 10, 64)
+
+	if err != nil || id == 0 {
+		return []blog.Translation{}
+	}
+
+	return []blog.Translation{{ArticleId: id}}
+}
+
+// parseSeries reads the series of the post edition form, a part left
+// without position goes after the others.
+func parseSeries(req *http.Request) blog.PostSeries {
+	position, _ := strconv.Atoi(req.FormValue("series_position"))
+
+	return blog.PostSeries{Series: blog.Series{Title: req.FormValue("series")}, Position: position}
+}
+
+// parsePublishAt reads the publication time of the post edition form,
+// 0 means that it was left empty.
+func parsePublishAt(req *http.Request) int64 {
+	publishAt, err := blog.ParseLocalTime(req.FormValue("publish_at"))
+
+	if err != nil {
+		return 0
+	}
+
+	return publishAt.Unix()
+}
+
+func mediaPage(res http.ResponseWriter, req *http.Request) {
+	printError(page.DisplayMedia(res))
+}
+
+func mediaPicker(res http.ResponseWriter, req *http.Request) {
+	printError(page.DisplayMediaPicker(res))
+}
+
+func uploadMedia(res http.ResponseWriter, req *http.Request) {
+	// leave room for the other fields of the form
+	req.Body = http.MaxBytesReader(res, req.Body, media.MaxSize+1<<20)
+
+	file, header, err := req.FormFile("file")
+
+	var tooLarge *http.MaxBytesError
+
+	if errors.As(err, &tooLarge) {
+		err = media.ErrTooLarge
+	}
+
+	if err != nil {
+		printError(page.DisplayMediaError(res, err))
+		return
+	}
+
+	defer file.Close()
+
+	saved, err := media.Save(header.Filename, file, req.FormValue("alt"))
+
+	if err != nil {
+		printError(page.DisplayMediaError(res, err))
+		log.Print(err)
+		return
+	}
+
+	printError(page.DisplayMediaItem(res, saved, "new", req.FormValue("picker") != ""))
+}
+
+func deleteMedia(res http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the media's ID must be an integer"))
+		return
+	}
+
+	err = media.Delete(id)
+
+	if errors.Is(err, media.ErrNotFound) {
+		res.WriteHeader(404)
+		return
+	} else if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+	}
+}
+
+func exportPosts(res http.ResponseWriter, req *http.Request) {
+	buf := bytes.Buffer{}
+
+	err := markdownfile.ExportZip(&buf)
+
+	if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+		return
+	}
+
+	filename := "articles-" + time.Now().Format("2006-01-02") + ".zip"
+
+	res.Header().Set("Content-Type", "application/zip")
+	res.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	_, err = buf.WriteTo(res)
+
+	printError(err)
+}
+
+func importPosts(res http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(res, req.Body, 50<<20)
+
+	archive, header, err := req.FormFile("archive")
+
+	if err != nil {
+		printError(page.DisplayImportReport(res, markdownfile.Report{}, err))
+		return
+	}
+
+	defer archive.Close()
+
+	report, err := markdownfile.ImportZip(archive, header.Size, editorName(req))
+
+	if err != nil {
+		log.Print(err)
+	}
+
+	printError(page.DisplayImportReport(res, report, err))
+}
+
+func postComment(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	postId, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the post's ID must be an integer"))
+		return
+	}
+
+	submitted := comment.Comment{
+		PostId:  postId,
+		Author:  req.FormValue("author"),
+		Email:   req.FormValue("email"),
+		Content: req.FormValue("content"),
+	}
+
+	// the field is hidden from the readers, only the robots fill it
+	trapped := req.FormValue("website") != ""
+
+	saved, err := comment.Add(postId, submitted.Author, submitted.Email, submitted.Content, trapped)
+
+	// the reader lands back on the article, a reload doesn't send it twice
+	if err == nil {
+		http.Redirect(res, req, "/"+saved.PostLanguage+"/articles/"+saved.PostSlug+"?comment=sent#comment-form", http.StatusSeeOther)
+		return
+	}
+
+	post, postErr := blog.GetPostById(postId)
+
+	if errors.Is(postErr, blog.ErrNotFound) || (postErr == nil && !post.IsVisible()) {
+		res.WriteHeader(404)
+		printError(page.DisplayPost(res, reqCtx, blog.RenderedPost{}, false))
+		return
+	} else if postErr != nil {
+		res.WriteHeader(500)
+		log.Print(postErr)
+		return
+	}
+
+	printError(page.DisplayRefusedComment(res, reqCtx, post, submitted, err))
+}
+
+func commentsPage(res http.ResponseWriter, req *http.Request) {
+	status := req.FormValue("status")
+
+	if status == "" {
+		status = comment.StatusPending
+	}
+
+	printError(page.DisplayComments(res, status))
+}
+
+func setCommentStatus(status string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+		if err != nil {
+			res.WriteHeader(400)
+			res.Write([]byte("the comment's ID must be an integer"))
+			return
+		}
+
+		updated, err := comment.SetStatus(id, status)
+
+		if errors.Is(err, comment.ErrNotFound) {
+			res.WriteHeader(404)
+			return
+		} else if err != nil {
+			res.WriteHeader(500)
+			log.Print(err)
+			return
+		}
+
+		printError(page.DisplayCommentCard(res, updated))
+	}
+}
+
+func replyComment(res http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the comment's ID must be an integer"))
+		return
+	}
+
+	reply, err := comment.Reply(id, req.FormValue("content"))
+
+	if errors.Is(err, comment.ErrNotFound) {
+		res.WriteHeader(404)
+		return
+	} else if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte(err.Error()))
+		return
+	}
+
+	parent, err := comment.Get(id)
+
+	if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+		return
+	}
+
+	printError(page.DisplayCommentReply(res, reply, parent))
+}
+
+func deleteComment(res http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the comment's ID must be an integer"))
+		return
+	}
+
+	err = comment.Delete(id)
+
+	if errors.Is(err, comment.ErrNotFound) {
+		res.WriteHeader(404)
+		return
+	} else if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+	}
+}
+
+// receiveWebmention accepts the mention and verifies it in the background,
+// as the protocol recommends.
+func receiveWebmention(res http.ResponseWriter, req *http.Request) {
+	_, err := webmention.Receive(req.FormValue("source"), req.FormValue("target"))
+
+	if errors.Is(err, webmention.ErrInvalidUrl) || errors.Is(err, webmention.ErrSameUrl) || errors.Is(err, webmention.ErrUnknownTarget) {
+		res.WriteHeader(400)
+		res.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+		return
+	}
+
+	res.WriteHeader(http.StatusAccepted)
+}
+
+func webmentionsPage(res http.ResponseWriter, req *http.Request) {
+	status := req.FormValue("status")
+
+	if status == "" {
+		status = webmention.StatusPending
+	}
+
+	printError(page.DisplayWebmentions(res, status))
+}
+
+func setWebmentionStatus(status string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+		if err != nil {
+			res.WriteHeader(400)
+			res.Write([]byte("the webmention's ID must be an integer"))
+			return
+		}
+
+		updated, err := webmention.SetStatus(id, status)
+
+		if errors.Is(err, webmention.ErrNotFound) {
+			res.WriteHeader(404)
+			return
+		} else if err != nil {
+			res.WriteHeader(500)
+			log.Print(err)
+			return
+		}
+
+		printError(page.DisplayWebmentionCard(res, updated))
+	}
+}
+
+func deleteWebmention(res http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the webmention's ID must be an integer"))
+		return
+	}
+
+	err = webmention.Delete(id)
+
+	if errors.Is(err, webmention.ErrNotFound) {
+		res.WriteHeader(404)
+		return
+	} else if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+	}
+}
+
+func subscribeNewsletter(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	err := newsletter.Subscribe(req.FormValue("email"), reqCtx.Localizer.Lang())
+
+	printError(page.DisplayNewsletterSubscription(res, reqCtx, err))
+}
+
+// newsletterLink reads the subscriber ID and the signature of a link mailed
+// by the newsletter.
+func newsletterLink(req *http.Request) (int64, string, error) {
+	id, err := strconv.ParseInt(req.FormValue("id"), 10, 64)
+
+	return id, req.FormValue("sig"), err
+}
+
+func confirmNewsletter(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	id, signature, err := newsletterLink(req)
+
+	if err == nil {
+		_, err = newsletter.Confirm(id, signature)
+	}
+
+	showNewsletterResult(res, reqCtx, "confirmed", err)
+}
+
+func unsubscribeNewsletterPage(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	id, signature, err := newsletterLink(req)
+
+	if err != nil {
+		showNewsletterResult(res, reqCtx, "", err)
+		return
+	}
+
+	printError(page.DisplayNewsletterLink(res, reqCtx, "unsubscribe", id, signature))
+}
+
+// unsubscribeNewsletter handles the form of the unsubscribe page as well as
+// the one-click unsubscription of the mail clients.
+func unsubscribeNewsletter(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	id, signature, err := newsletterLink(req)
+
+	if err == nil {
+		_, err = newsletter.Unsubscribe(id, signature)
+	}
+
+	showNewsletterResult(res, reqCtx, "unsubscribed", err)
+}
+
+func showNewsletterResult(res http.ResponseWriter, reqCtx reqcontext.ReqContext, result string, err error) {
+	var numError *strconv.NumError
+
+	if errors.Is(err, newsletter.ErrInvalidSignature) || errors.As(err, &numError) {
+		res.WriteHeader(400)
+		result = "invalid"
+	} else if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+		return
+	}
+
+	printError(page.DisplayNewsletterLink(res, reqCtx, result, 0, ""))
+}
+
+func newsletterPage(res http.ResponseWriter, req *http.Request) {
+	printError(page.DisplayNewsletter(res))
+}
+
+func sendNewsletter(res http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the post's ID must be an integer"))
+		return
+	}
+
+	count, err := newsletter.QueuePost(id)
+
+	if errors.Is(err, blog.ErrNotFound) {
+		res.WriteHeader(404)
+		return
+	} else if errors.Is(err, newsletter.ErrPostNotPublished) {
+		res.WriteHeader(409)
+		res.Write([]byte(err.Error()))
+		return
+	} else if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+		return
+	}
+
+	res.Write([]byte("queued for " + strconv.Itoa(count) + " subscribers"))
+}
+
+func usersPage(res http.ResponseWriter, req *http.Request) {
+	printError(page.DisplayUsers(res))
+}
+
+func createUser(res http.ResponseWriter, req *http.Request) {
+	_, err := user.Create(req.FormValue("username"), req.FormValue("display_name"), req.FormValue("password"), req.FormValue("role"))
+
+	printError(page.DisplayUserList(res, err))
+}
+
+func updateUser(res http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the user's ID must be an integer"))
+		return
+	}
+
+	_, err = user.Update(id, req.FormValue("display_name"), req.FormValue("role"), req.FormValue("password"))
+
+	printError(page.DisplayUserList(res, err))
+}
+
+func deleteUser(res http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the user's ID must be an integer"))
+		return
+	}
+
+	printError(page.DisplayUserList(res, user.Delete(id)))
+}
+
+func sessionsPage(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	printError(page.DisplaySessions(res, reqCtx))
+}
+
+func revokeSession(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the session's ID must be an integer"))
+		return
+	}
+
+	err = authentication.Revoke(reqCtx.User, id)
+
+	if errors.Is(err, authentication.ErrSessionNotFound) {
+		res.WriteHeader(404)
+		return
+	} else if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+	}
+}
+
+func secondFactorPage(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	printError(page.DisplaySecondFactor(res, reqCtx))
+}
+
+// secondFactorError writes the errors of the user, the others are logged.
+func secondFactorError(res http.ResponseWriter, req *http.Request, codes []string, err error) {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	switch {
+	case err == nil,
+		errors.Is(err, user.ErrInvalidCode),
+		errors.Is(err, user.ErrSecondFactorLocked),
+		errors.Is(err, user.ErrTotpEnabled),
+		errors.Is(err, user.ErrTotpNotStarted),
+		errors.Is(err, user.ErrTotpDisabled):
+		printError(page.DisplaySecondFactorStatus(res, reqCtx, codes, err))
+	default:
+		res.WriteHeader(500)
+		log.Print(err)
+	}
+}
+
+func startSecondFactor(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	_, err := user.StartTotp(reqCtx.User.UserId)
+
+	secondFactorError(res, req, nil, err)
+}
+
+func confirmSecondFactor(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	codes, err := user.ConfirmTotp(reqCtx.User.UserId, req.FormValue("code"))
+
+	secondFactorError(res, req, codes, err)
+}
+
+func regenerateRecoveryCodes(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	codes, err := user.RegenerateRecoveryCodes(reqCtx.User.UserId)
+
+	secondFactorError(res, req, codes, err)
+}
+
+// disableSecondFactor asks a current code, a session left open isn't enough
+// to remove the second factor.
+func disableSecondFactor(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	err := user.CheckSecondFactor(reqCtx.User.UserId, req.FormValue("code"))
+
+	if err == nil {
+		err = user.DisableTotp(reqCtx.User.UserId)
+	}
+
+	secondFactorError(res, req, nil, err)
+}
+
+// relyingParty is the site the passkeys of the request are bound to.
+func relyingParty(req *http.Request) (webauthn.RelyingParty, error) {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	return webauthn.NewRelyingParty(reqCtx.BaseUrl)
+}
+
+// writeJson answers the scripts of the passkeys.
+func writeJson(res http.ResponseWriter, value any) {
+	res.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	printError(json.NewEncoder(res).Encode(value))
+}
+
+// passkeyError answers the errors of the passkeys, the script shows them.
+func passkeyError(res http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, webauthn.ErrInvalidResponse),
+		errors.Is(err, webauthn.ErrChallenge),
+		errors.Is(err, webauthn.ErrOrigin),
+		errors.Is(err, webauthn.ErrUserNotVerified),
+		errors.Is(err, webauthn.ErrUnsupportedKey),
+		errors.Is(err, webauthn.ErrSignature),
+		errors.Is(err, webauthn.ErrSignCount),
+		errors.Is(err, user.ErrPasskeyNotFound),
+		errors.Is(err, user.ErrInvalidCode):
+		res.WriteHeader(400)
+		res.Write([]byte(err.Error()))
+	case errors.Is(err, user.ErrTooManyChallenges),
+		errors.Is(err, user.ErrSecondFactorLocked):
+		res.WriteHeader(http.StatusTooManyRequests)
+		res.Write([]byte(err.Error()))
+	default:
+		res.WriteHeader(500)
+		log.Print(err)
+	}
+}
+
+func passkeyLoginOptions(res http.ResponseWriter, req *http.Request) {
+	rp, err := relyingParty(req)
+
+	if err != nil {
+		passkeyError(res, err)
+		return
+	}
+
+	options, err := user.BeginPasskeyLogin(rp, clientIp(req))
+
+	if err != nil {
+		passkeyError(res, err)
+		return
+	}
+
+	writeJson(res, options)
+}
+
+func passkeyLogin(res http.ResponseWriter, req *http.Request) {
+	response := webauthn.AssertionResponse{}
+
+	if err := json.NewDecoder(io.LimitReader(req.Body, 64*1024)).Decode(&response); err != nil {
+		passkeyError(res, webauthn.ErrInvalidResponse)
+		return
+	}
+
+	rp, err := relyingParty(req)
+
+	if err != nil {
+		passkeyError(res, err)
+		return
+	}
+
+	token, err := authentication.AuthenticatePasskey(rp, response, req.UserAgent(), clientIp(req))
+
+	if err != nil {
+		passkeyError(res, err)
+		return
+	}
+
+	http.SetCookie(res, sessionCookie(req, token, int(authentication.AbsoluteTimeout.Seconds())))
+	res.WriteHeader(204)
+}
+
+func passkeysPage(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+
+	printError(page.DisplayPasskeys(res, reqCtx))
+}
+
+func passkeyRegistrationOptions(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	rp, err := relyingParty(req)
+
+	if err != nil {
+		passkeyError(res, err)
+		return
+	}
+
+	options, err := user.BeginPasskeyRegistration(rp, reqCtx.User, req.FormValue("code"))
+
+	if err != nil {
+		passkeyError(res, err)
+		return
+	}
+
+	writeJson(res, options)
+}
+
+func registerPasskey(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	response := webauthn.RegistrationResponse{}
+
+	if err := json.NewDecoder(io.LimitReader(req.Body, 64*1024)).Decode(&response); err != nil {
+		passkeyError(res, webauthn.ErrInvalidResponse)
+		return
+	}
+
+	rp, err := relyingParty(req)
+
+	if err != nil {
+		passkeyError(res, err)
+		return
+	}
+
+	_, err = user.FinishPasskeyRegistration(rp, reqCtx.User, req.URL.Query().Get("name"), response)
+
+	if err != nil {
+		passkeyError(res, err)
+		return
+	}
+
+	res.WriteHeader(201)
+}
+
+func deletePasskey(res http.ResponseWriter, req *http.Request) {
+	reqCtx := reqcontext.GetValue(req.Context())
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+
+	if err != nil {
+		res.WriteHeader(400)
+		res.Write([]byte("the passkey's ID must be an integer"))
+		return
+	}
+
+	err = user.DeletePasskey(reqCtx.User.UserId, id)
+
+	if errors.Is(err, user.ErrPasskeyNotFound) {
+		res.WriteHeader(404)
+		return
+	} else if err != nil {
+		res.WriteHeader(500)
+		log.Print(err)
+	}
 }
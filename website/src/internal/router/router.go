@@ -6,28 +6,42 @@ import (
 	"strings"
 
 	"valette.software/internal/authentication"
+	"valette.software/internal/comment"
+	"valette.software/internal/config"
 	"valette.software/internal/contactform"
 	"valette.software/internal/i18n"
+	"valette.software/internal/media"
 	"valette.software/internal/page"
 	"valette.software/internal/reqcontext"
+	"valette.software/internal/sitemap"
 	"valette.software/internal/static"
+	"valette.software/internal/user"
+	"valette.software/internal/webmention"
 )
 
-func Build() *http.ServeMux {
+// publicPages are the pages listed in the sitemap of every language, besides
+// the articles.
+var publicPages = []string{"/", "/articles/", "/agenda"}
+
+func Build(config config.Configurator) *http.ServeMux {
 
 	root := http.NewServeMux()
+	baseUrl := config.GetBaseUrl()
 	router := buildRouter()
 
 	root.HandleFunc("/", func(res http.ResponseWriter, req *http.Request) {
 		localizer, newPath := getLocale(req.URL.Path)
-		sessionId := getSessionId(req)
+		session, loggedIn, isAdmin := authentication.CheckSession(getSessionId(req))
 
 		req.URL.Path = newPath
 
 		ctxValue := reqcontext.ReqContext{
 			Localizer:   localizer,
-			Admin:       authentication.CheckSession(sessionId),
+			Admin:       isAdmin,
 			CurrentPath: newPath,
+			BaseUrl:     baseUrl,
+			User:        loggedIn,
+			SessionId:   session.SessionId,
 		}
 
 		newCtx := reqcontext.SetValue(req.Context(), ctxValue)
@@ -97,45 +111,173 @@ func buildRouter() *http.ServeMux {
 
 	router.Handle("GET /static/", http.StripPrefix("/static/", static.Serve()))
 
+	router.HandleFunc("GET /static/css/highlight.css", getHighlightCss)
+
+	router.Handle("GET /uploads/", http.StripPrefix("/uploads/", media.Serve()))
+
 	router.HandleFunc("GET /", indexPage)
 
 	router.HandleFunc("GET /articles/", listPosts)
 
 	router.HandleFunc("POST /login", login)
 
+	router.HandleFunc("POST /login/verify", verifyLogin)
+
+	router.HandleFunc("POST /login/passkey/options", passkeyLoginOptions)
+
+	router.HandleFunc("POST /login/passkey", passkeyLogin)
+
 	router.HandleFunc("GET /logout", logout)
 
 	router.HandleFunc("GET /articles/{name}", getPost)
 
+	router.HandleFunc("GET /articles/tag/{tag}", listTagPosts)
+
+	router.HandleFunc("GET /articles/series/{series}", listSeriesPosts)
+
+	router.HandleFunc("GET /articles/search", searchPosts)
+
+	router.HandleFunc("GET /articles/feed.atom", getAtomFeed)
+
+	router.HandleFunc("GET /articles/feed.rss", getRssFeed)
+
+	router.HandleFunc("POST /articles/{id}/comments", postComment)
+
+	router.HandleFunc("POST /webmention", receiveWebmention)
+
+	router.HandleFunc("POST /newsletter", subscribeNewsletter)
+
+	router.HandleFunc("GET /newsletter/confirm", confirmNewsletter)
+
+	router.HandleFunc("GET /newsletter/unsubscribe", unsubscribeNewsletterPage)
+
+	router.HandleFunc("POST /newsletter/unsubscribe", unsubscribeNewsletter)
+
 	router.HandleFunc("GET /agenda", getAgenda)
 
 	router.HandleFunc("POST /contact", contactform.HandleContactFormRequest)
 
-	router.HandleFunc("GET /admin/", requireAdmin(adminPage))
+	router.HandleFunc("GET /robots.txt", getRobots)
+
+	router.HandleFunc("GET /sitemap.xml", getSitemapIndex)
+
+	for _, lang := range sitemap.Languages {
+		router.HandleFunc("GET /sitemap-"+lang+".xml", getSitemap(lang))
+	}
+
+	router.HandleFunc("GET /admin/", requireAdmin(user.RoleContributor, adminPage))
+
+	router.HandleFunc("GET /admin/tags", requireAdmin(user.RoleEditor, tagsPage))
+
+	router.HandleFunc("GET /admin/search", requireAdmin(user.RoleContributor, adminSearch))
+
+	router.HandleFunc("GET /admin/media", requireAdmin(user.RoleContributor, mediaPage))
+
+	router.HandleFunc("GET /admin/export", requireAdmin(user.RoleEditor, exportPosts))
+
+	router.HandleFunc("POST /admin/import", requireAdmin(user.RoleEditor, importPosts))
+
+	router.HandleFunc("GET /admin/comments", requireAdmin(user.RoleEditor, commentsPage))
+
+	router.HandleFunc("POST /comments/{id}/approve", requireAdmin(user.RoleEditor, setCommentStatus(comment.StatusApproved)))
+
+	router.HandleFunc("POST /comments/{id}/spam", requireAdmin(user.RoleEditor, setCommentStatus(comment.StatusSpam)))
+
+	router.HandleFunc("POST /comments/{id}/replies", requireAdmin(user.RoleEditor, replyComment))
+
+	router.HandleFunc("DELETE /comments/{id}", requireAdmin(user.RoleEditor, deleteComment))
+
+	router.HandleFunc("GET /admin/webmentions", requireAdmin(user.RoleEditor, webmentionsPage))
 
-	router.HandleFunc("GET /new-post", requireAdmin(newPostController))
+	router.HandleFunc("POST /webmentions/{id}/approve", requireAdmin(user.RoleEditor, setWebmentionStatus(webmention.StatusApproved)))
 
-	router.HandleFunc("GET /edit-posts/{id}", requireAdmin(getEditablePost))
+	router.HandleFunc("POST /webmentions/{id}/spam", requireAdmin(user.RoleEditor, setWebmentionStatus(webmention.StatusSpam)))
 
-	router.HandleFunc("POST /posts", requireAdmin(createPost))
+	router.HandleFunc("DELETE /webmentions/{id}", requireAdmin(user.RoleEditor, deleteWebmention))
 
-	router.HandleFunc("PUT /posts/{id}", requireAdmin(updatePost))
+	router.HandleFunc("GET /admin/newsletter", requireAdmin(user.RoleEditor, newsletterPage))
 
-	router.HandleFunc("DELETE /posts/{id}", requireAdmin(deletePost))
+	router.HandleFunc("PUT /tags/{id}", requireAdmin(user.RoleEditor, renameTag))
+
+	router.HandleFunc("GET /media-picker", requireAdmin(user.RoleContributor, mediaPicker))
+
+	router.HandleFunc("POST /media", requireAdmin(user.RoleContributor, uploadMedia))
+
+	router.HandleFunc("DELETE /media/{id}", requireAdmin(user.RoleEditor, deleteMedia))
+
+	router.HandleFunc("GET /admin/users", requireAdmin(user.RoleOwner, usersPage))
+
+	router.HandleFunc("POST /users", requireAdmin(user.RoleOwner, createUser))
+
+	router.HandleFunc("PUT /users/{id}", requireAdmin(user.RoleOwner, updateUser))
+
+	router.HandleFunc("DELETE /users/{id}", requireAdmin(user.RoleOwner, deleteUser))
+
+	router.HandleFunc("GET /admin/sessions", requireAdmin(user.RoleContributor, sessionsPage))
+
+	router.HandleFunc("DELETE /sessions/{id}", requireAdmin(user.RoleContributor, revokeSession))
+
+	router.HandleFunc("GET /admin/2fa", requireAdmin(user.RoleContributor, secondFactorPage))
+
+	router.HandleFunc("POST /2fa/start", requireAdmin(user.RoleContributor, startSecondFactor))
+
+	router.HandleFunc("POST /2fa/confirm", requireAdmin(user.RoleContributor, confirmSecondFactor))
+
+	router.HandleFunc("POST /2fa/recovery-codes", requireAdmin(user.RoleContributor, regenerateRecoveryCodes))
+
+	router.HandleFunc("DELETE /2fa", requireAdmin(user.RoleContributor, disableSecondFactor))
+
+	router.HandleFunc("GET /admin/passkeys", requireAdmin(user.RoleContributor, passkeysPage))
+
+	router.HandleFunc("POST /passkeys/options", requireAdmin(user.RoleContributor, passkeyRegistrationOptions))
+
+	router.HandleFunc("POST /passkeys", requireAdmin(user.RoleContributor, registerPasskey))
+
+	router.HandleFunc("DELETE /passkeys/{id}", requireAdmin(user.RoleContributor, deletePasskey))
+
+	router.HandleFunc("GET /new-post", requireAdmin(user.RoleContributor, newPostController))
+
+	router.HandleFunc("GET /edit-posts/{id}", requireAdmin(user.RoleContributor, getEditablePost))
+
+	router.HandleFunc("GET /edit-posts/{id}/revisions", requireAdmin(user.RoleContributor, listRevisions))
+
+	router.HandleFunc("GET /edit-posts/{id}/revisions/diff", requireAdmin(user.RoleContributor, compareRevisions))
+
+	router.HandleFunc("POST /posts", requireAdmin(user.RoleContributor, createPost))
+
+	router.HandleFunc("PUT /posts/{id}", requireAdmin(user.RoleContributor, updatePost))
+
+	router.HandleFunc("DELETE /posts/{id}", requireAdmin(user.RoleEditor, deletePost))
+
+	router.HandleFunc("POST /posts/{id}/publish", requireAdmin(user.RoleEditor, publishPost))
+
+	router.HandleFunc("POST /posts/{id}/unpublish", requireAdmin(user.RoleEditor, unpublishPost))
+
+	router.HandleFunc("POST /posts/{id}/newsletter", requireAdmin(user.RoleEditor, sendNewsletter))
+
+	router.HandleFunc("POST /posts/{id}/revisions/{revision}/restore", requireAdmin(user.RoleEditor, restoreRevision))
 
 	return router
 }
 
-func requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+// requireAdmin shows the login form to the visitors, and refuses the users
+// whose role is below role.
+func requireAdmin(role string, handler http.HandlerFunc) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		reqCtx := reqcontext.GetValue(req.Context())
 
-		if reqCtx.Admin {
-			handler(res, req)
+		if !reqCtx.Admin {
+			printError(page.DisplayLoginForm(res))
+			return
+		}
+
+		if !reqCtx.User.HasRole(role) {
+			res.WriteHeader(http.StatusForbidden)
+			res.Write([]byte("your role doesn't allow this action"))
 			return
 		}
 
-		printError(page.DisplayLoginForm(res))
+		handler(res, req)
 	}
 }
 
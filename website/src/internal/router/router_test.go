@@ -0,0 +1,417 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"valette.software/internal/authentication"
+	"valette.software/internal/blog"
+	"valette.software/internal/comment"
+	"valette.software/internal/config"
+	"valette.software/internal/database"
+	"valette.software/internal/database/databasetest"
+	"valette.software/internal/i18n"
+	"valette.software/internal/page"
+	"valette.software/internal/totp"
+	"valette.software/internal/user"
+	"valette.software/internal/webauthn"
+	"valette.software/internal/webauthn/webauthntest"
+	"valette.software/internal/webmention"
+)
+
+// testConfig publishes the site at http://localhost:8080.
+type testConfig struct {
+	*config.Config
+}
+
+func (testConfig) GetBaseUrl() string {
+	return "http://localhost:8080"
+}
+
+// openTestSite serves the site from a freshly migrated database, where the
+// owner "admin" logs in with "first password".
+func openTestSite(t *testing.T) http.Handler {
+	database.Set(databasetest.Open(t))
+
+	i18n.Init()
+	page.Init()
+	blog.Init()
+	comment.Init()
+	webmention.Init("http://localhost", http.DefaultClient)
+	user.Init("first password")
+	authentication.Init(&config.Config{})
+
+	return Build(testConfig{&config.Config{}})
+}
+
+// serve sends the request to the site, with the session cookie if any.
+func serve(site http.Handler, method string, target string, form url.Values, session *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if session != nil {
+		req.AddCookie(session)
+	}
+
+	res := httptest.NewRecorder()
+	site.ServeHTTP(res, req)
+
+	return res
+}
+
+// serveJson posts body to the site as the scripts of the passkeys do, and
+// decodes the answer in answer if any.
+func serveJson(t *testing.T, site http.Handler, target string, body any, session *http.Cookie, answer any) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+
+	if session != nil {
+		req.AddCookie(session)
+	}
+
+	res := httptest.NewRecorder()
+	site.ServeHTTP(res, req)
+
+	if answer != nil && res.Code == http.StatusOK {
+		if err := json.Unmarshal(res.Body.Bytes(), answer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return res
+}
+
+// sessionOf returns the session cookie set by the answer, if any.
+func sessionOf(res *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range res.Result().Cookies() {
+		if cookie.Name == "session-id" && cookie.Value != "" {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+// logIn returns the session cookie of the user.
+func logIn(t *testing.T, site http.Handler, username string, password string) *http.Cookie {
+	res := serve(site, http.MethodPost, "/login", url.Values{"username": {username}, "password": {password}}, nil)
+	session := sessionOf(res)
+
+	if session == nil {
+		t.Fatalf("expected %s to log in, got %d", username, res.Code)
+	}
+
+	return session
+}
+
+func TestHiddenPosts(t *testing.T) {
+	site := openTestSite(t)
+
+	owner, _ := user.Get(1)
+
+	if _, err := user.Create("writer", "Writer", "writer password", user.RoleContributor); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := user.Create("editor", "Editor", "editor password", user.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := blog.AddPost(blog.NewPost{Title: "Brouillon", Language: "fr", Status: blog.StatusDraft, UserId: owner.UserId}, owner.Username)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type data struct {
+		name     string
+		session  *http.Cookie
+		expected int
+	}
+
+	testData := []data{
+		{"visitor", nil, http.StatusNotFound},
+		{"contributor", logIn(t, site, "writer", "writer password"), http.StatusNotFound},
+		{"editor", logIn(t, site, "editor", "editor password"), http.StatusOK},
+	}
+
+	for _, test := range testData {
+		res := serve(site, http.MethodGet, "/fr/articles/brouillon", nil, test.session)
+
+		if res.Code != test.expected {
+			t.Errorf("%s: expected %d for the draft of another user, got %d", test.name, test.expected, res.Code)
+		}
+
+		listed := strings.Contains(serve(site, http.MethodGet, "/fr/articles/", nil, test.session).Body.String(), "Brouillon")
+
+		if shown := test.expected == http.StatusOK; listed != shown {
+			t.Errorf("%s: expected the draft to be listed: %t, got %t", test.name, shown, listed)
+		}
+	}
+}
+
+func TestTranslationRedirects(t *testing.T) {
+	site := openTestSite(t)
+
+	posts := []blog.NewPost{
+		{Title: "Seul", Language: "fr", Status: blog.StatusPublished},
+		{Title: "Bonjour", Language: "fr", Status: blog.StatusPublished},
+	}
+
+	for _, post := range posts {
+		if _, err := blog.AddPost(post, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hello := blog.NewPost{Title: "Hello", Language: "en", Status: blog.StatusPublished, Translations: []blog.Translation{{ArticleId: 2}}}
+
+	if _, err := blog.AddPost(hello, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	type data struct {
+		target   string
+		location string
+	}
+
+	testData := []data{
+		{"/en/articles/seul", "/fr/articles/seul"},
+		{"/en/articles/bonjour", "/en/articles/hello"},
+		{"/fr/articles/hello", "/fr/articles/bonjour"},
+	}
+
+	for _, test := range testData {
+		res := serve(site, http.MethodGet, test.target, nil, nil)
+
+		if res.Code != http.StatusMovedPermanently || res.Header().Get("Location") != test.location {
+			t.Errorf("expected %s to be moved to %s, got %d %s", test.target, test.location, res.Code, res.Header().Get("Location"))
+		}
+	}
+
+	if res := serve(site, http.MethodGet, "/fr/articles/seul", nil, nil); res.Code != http.StatusOK {
+		t.Errorf("expected the article at its own address, got %d", res.Code)
+	}
+}
+
+func TestContributorHtml(t *testing.T) {
+	site := openTestSite(t)
+
+	if _, err := user.Create("writer", "Writer", "writer password", user.RoleContributor); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := user.Create("editor", "Editor", "editor password", user.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+
+	draft := url.Values{
+		"title":    {"Piège"},
+		"language": {"fr"},
+		"content":  {"<script>alert(document.cookie)</script>\n\nTexte"},
+	}
+
+	if res := serve(site, http.MethodPost, "/posts", draft, logIn(t, site, "writer", "writer password")); res.Code != http.StatusOK {
+		t.Fatalf("expected the draft to be saved, got %d: %s", res.Code, res.Body)
+	}
+
+	res := serve(site, http.MethodGet, "/fr/articles/piege", nil, logIn(t, site, "editor", "editor password"))
+
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "Texte") {
+		t.Fatalf("expected the editor to read the draft, got %d", res.Code)
+	}
+
+	if strings.Contains(res.Body.String(), "alert(document.cookie)") {
+		t.Errorf("expected the script of the contributor to be skipped, got %s", res.Body)
+	}
+}
+
+func TestTranslationCandidates(t *testing.T) {
+	site := openTestSite(t)
+
+	owner, _ := user.Get(1)
+	writer, err := user.Create("writer", "Writer", "writer password", user.RoleContributor)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := []blog.NewPost{
+		{Title: "Brouillon", Language: "fr", Status: blog.StatusDraft, UserId: owner.UserId},
+		{Title: "Archive", Language: "fr", Status: blog.StatusArchived, UserId: owner.UserId},
+		{Title: "Publié", Language: "fr", Status: blog.StatusPublished, UserId: owner.UserId},
+		{Title: "Mon brouillon", Language: "fr", Status: blog.StatusDraft, UserId: writer.UserId},
+	}
+
+	for _, post := range posts {
+		if _, err := blog.AddPost(post, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type data struct {
+		title    string
+		expected bool
+	}
+
+	testData := []data{
+		{"(fr) Brouillon\n", false},
+		{"(fr) Archive\n", false},
+		{"(fr) Publié\n", true},
+		{"(fr) Mon brouillon\n", true},
+	}
+
+	body := serve(site, http.MethodGet, "/admin/", nil, logIn(t, site, "writer", "writer password")).Body.String()
+
+	for _, test := range testData {
+		if listed := strings.Contains(body, test.title); listed != test.expected {
+			t.Errorf("expected %q to be a translation candidate of the contributor: %t, got %t", test.title, test.expected, listed)
+		}
+	}
+}
+
+func TestSecondFactorLockout(t *testing.T) {
+	site := openTestSite(t)
+
+	secret, err := user.StartTotp(1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := totp.Code(secret, totp.Step(time.Now()))
+
+	if _, err := user.ConfirmTotp(1, code); err != nil {
+		t.Fatal(err)
+	}
+
+	// pending logs in with the password, the session waits for the code
+	pending := func() *http.Cookie {
+		session := sessionOf(serve(site, http.MethodPost, "/login", url.Values{"username": {"admin"}, "password": {"first password"}}, nil))
+
+		if session == nil {
+			t.Fatal("expected the password to open a pending session")
+		}
+
+		return session
+	}
+
+	// the wrong codes of every login count, a new login doesn't start again
+	for range 3 {
+		session := pending()
+
+		for range 2 {
+			serve(site, http.MethodPost, "/login/verify", url.Values{"code": {"000000"}}, session)
+		}
+	}
+
+	res := serve(site, http.MethodPost, "/login/verify", url.Values{"code": {code}}, pending())
+
+	if sessionOf(res) != nil || !strings.Contains(res.Body.String(), user.ErrSecondFactorLocked.Error()) {
+		t.Errorf("expected the second factor to be locked after the wrong codes of several logins, got %d: %s", res.Code, res.Body)
+	}
+}
+
+func TestPasskeys(t *testing.T) {
+	site := openTestSite(t)
+	session := logIn(t, site, "admin", "first password")
+	authenticator := webauthntest.New("http://localhost:8080")
+
+	// the second factor of the owner is asked before a passkey is added
+	secret, err := user.StartTotp(1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := totp.Code(secret, totp.Step(time.Now()))
+	recoveryCodes, err := user.ConfirmTotp(1, code)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res := serve(site, http.MethodPost, "/passkeys/options", nil, session); res.Code != http.StatusBadRequest {
+		t.Errorf("expected a passkey to need the second factor, got %d", res.Code)
+	}
+
+	creation := webauthn.CreationOptions{}
+	res := serve(site, http.MethodPost, "/passkeys/options", url.Values{"code": {recoveryCodes[0]}}, session)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected the options of a passkey, got %d: %s", res.Code, res.Body)
+	}
+
+	if err := json.Unmarshal(res.Body.Bytes(), &creation); err != nil {
+		t.Fatal(err)
+	}
+
+	registration, err := authenticator.Register(creation)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the fields sent by passkey.js
+	res = serveJson(t, site, "/passkeys?name=phone", map[string]any{
+		"id": registration.Id,
+		"response": map[string]string{
+			"clientDataJSON":    registration.Response.ClientDataJson,
+			"attestationObject": registration.Response.AttestationObject,
+		},
+	}, session, nil)
+
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected the passkey to be registered, got %d: %s", res.Code, res.Body)
+	}
+
+	request := webauthn.RequestOptions{}
+	serveJson(t, site, "/login/passkey/options", nil, nil, &request)
+
+	assertion, err := authenticator.Login(request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = serveJson(t, site, "/login/passkey", map[string]any{
+		"id": assertion.Id,
+		"response": map[string]string{
+			"clientDataJSON":    assertion.Response.ClientDataJson,
+			"authenticatorData": assertion.Response.AuthenticatorData,
+			"signature":         assertion.Response.Signature,
+			"userHandle":        assertion.Response.UserHandle,
+		},
+	}, nil, nil)
+
+	passkeySession := sessionOf(res)
+
+	if res.Code != http.StatusNoContent || passkeySession == nil {
+		t.Fatalf("expected the passkey to open a session, got %d: %s", res.Code, res.Body)
+	}
+
+	if res := serve(site, http.MethodGet, "/admin/passkeys", nil, passkeySession); !strings.Contains(res.Body.String(), "phone") {
+		t.Errorf("expected the session of the passkey to open the admin area, got %d", res.Code)
+	}
+
+	// the login of the passkey used its challenge, ten others are waiting
+	for range 10 {
+		serveJson(t, site, "/login/passkey/options", nil, nil, nil)
+	}
+
+	if res := serveJson(t, site, "/login/passkey/options", nil, nil, nil); res.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the logins started by an address to be limited, got %d", res.Code)
+	}
+}
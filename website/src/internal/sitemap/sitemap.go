@@ -0,0 +1,235 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"valette.software/internal/blog"
+)
+
+// Languages are the languages the site is published in, each one has its own
+// sitemap.
+var Languages = []string{"fr", "en"}
+
+// disallowedPaths are the pages the robots must not crawl, in every
+// language.
+var disallowedPaths = []string{"/admin/", "/edit-posts/", "/new-post", "/posts", "/newsletter/"}
+
+var cache = map[string][]byte{}
+var cacheExpiresAt int64
+var cacheMutex sync.Mutex
+
+type sitemapIndex struct {
+	XMLName  xml.Name       `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc string `xml:"loc"`
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	Xhtml   string   `xml:"xmlns:xhtml,attr"`
+	Urls    []url    `xml:"url"`
+}
+
+type url struct {
+	Loc        string      `xml:"loc"`
+	LastMod    string      `xml:"lastmod,omitempty"`
+	Alternates []alternate `xml:"xhtml:link"`
+}
+
+type alternate struct {
+	Rel      string `xml:"rel,attr"`
+	HrefLang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+// Init empties the cache of the sitemaps every time the posts change.
+func Init() {
+	blog.OnChange(func(int64) { invalidate() })
+}
+
+// WriteIndex writes the sitemap index pointing to the sitemap of every
+// language.
+func WriteIndex(w io.Writer, baseUrl string) error {
+	doc := sitemapIndex{}
+
+	for _, lang := range Languages {
+		doc.Sitemaps = append(doc.Sitemaps, sitemapEntry{Loc: baseUrl + "/sitemap-" + lang + ".xml"})
+	}
+
+	return write(w, doc)
+}
+
+// WriteLanguage writes the sitemap of lang, listing the public pages and
+// the articles visible to the public. The sitemap is built once and kept
+// until a post changes or a scheduled post gets published.
+func WriteLanguage(w io.Writer, baseUrl string, lang string, pages []string) error {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	if cacheExpiresAt != 0 && time.Now().Unix() >= cacheExpiresAt {
+		cache = map[string][]byte{}
+		cacheExpiresAt = 0
+	}
+
+	content, ok := cache[lang]
+
+	if !ok {
+		buf := bytes.Buffer{}
+
+		err := buildLanguage(&buf, baseUrl, lang, pages)
+
+		if err != nil {
+			return err
+		}
+
+		nextPublication, err := blog.NextPublication()
+
+		if err != nil {
+			return err
+		}
+
+		if nextPublication != 0 && (cacheExpiresAt == 0 || nextPublication < cacheExpiresAt) {
+			cacheExpiresAt = nextPublication
+		}
+
+		content = buf.Bytes()
+		cache[lang] = content
+	}
+
+	_, err := w.Write(content)
+
+	return err
+}
+
+// WriteRobots writes the robots.txt of the site.
+func WriteRobots(w io.Writer, baseUrl string) error {
+	robots := strings.Builder{}
+
+	robots.WriteString("User-agent: *\n")
+
+	for _, prefix := range append([]string{""}, languagePrefixes()...) {
+		for _, path := range disallowedPaths {
+			robots.WriteString("Disallow: " + prefix + path + "\n")
+		}
+	}
+
+	robots.WriteString("\nSitemap: " + baseUrl + "/sitemap.xml\n")
+
+	_, err := io.WriteString(w, robots.String())
+
+	return err
+}
+
+// IsDisallowed tells whether robots.txt forbids the robots to crawl path.
+func IsDisallowed(path string) bool {
+	for _, prefix := range append([]string{""}, languagePrefixes()...) {
+		for _, disallowed := range disallowedPaths {
+			if strings.HasPrefix(path, prefix+disallowed) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func buildLanguage(w io.Writer, baseUrl string, lang string, pages []string) error {
+	posts, err := blog.ListPublicPosts(lang)
+
+	if err != nil {
+		return err
+	}
+
+	// the list of articles changes whenever the most recent one does
+	var lastPostModified int64
+
+	for _, post := range posts {
+		lastPostModified = max(lastPostModified, post.LastModified)
+	}
+
+	doc := urlSet{Xhtml: "http://www.w3.org/1999/xhtml"}
+
+	for _, page := range pages {
+		entry := url{Loc: baseUrl + "/" + lang + page}
+
+		if page == "/articles/" && lastPostModified != 0 {
+			entry.LastMod = formatDate(lastPostModified)
+		}
+
+		for _, other := range Languages {
+			entry.Alternates = append(entry.Alternates, alternate{Rel: "alternate", HrefLang: other, Href: baseUrl + "/" + other + page})
+		}
+
+		doc.Urls = append(doc.Urls, entry)
+	}
+
+	for _, post := range posts {
+		entry := url{
+			Loc:     postUrl(baseUrl, post.Language, post.Slug),
+			LastMod: formatDate(post.LastModified),
+		}
+
+		if len(post.Translations) > 0 {
+			entry.Alternates = append(entry.Alternates, alternate{Rel: "alternate", HrefLang: post.Language, Href: entry.Loc})
+
+			for _, translation := range post.Translations {
+				entry.Alternates = append(entry.Alternates, alternate{
+					Rel:      "alternate",
+					HrefLang: translation.Language,
+					Href:     postUrl(baseUrl, translation.Language, translation.Slug),
+				})
+			}
+		}
+
+		doc.Urls = append(doc.Urls, entry)
+	}
+
+	return write(w, doc)
+}
+
+func invalidate() {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	cache = map[string][]byte{}
+	cacheExpiresAt = 0
+}
+
+func write(w io.Writer, doc any) error {
+	_, err := io.WriteString(w, xml.Header)
+
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	return encoder.Encode(doc)
+}
+
+func languagePrefixes() []string {
+	prefixes := []string{}
+
+	for _, lang := range Languages {
+		prefixes = append(prefixes, "/"+lang)
+	}
+
+	return prefixes
+}
+
+func postUrl(baseUrl string, lang string, slug string) string {
+	return baseUrl + "/" + lang + "/articles/" + slug
+}
+
+func formatDate(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,72 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestWriteIndex(t *testing.T) {
+	buf := bytes.Buffer{}
+
+	if err := WriteIndex(&buf, "https://valette.software"); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := sitemapIndex{}
+
+	if err := xml.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("expected a valid XML document, got %s", err)
+	}
+
+	if len(parsed.Sitemaps) != 2 || parsed.Sitemaps[1].Loc != "https://valette.software/sitemap-en.xml" {
+		t.Errorf("expected a sitemap per language, got %+v", parsed.Sitemaps)
+	}
+}
+
+func TestWriteRobots(t *testing.T) {
+	buf := bytes.Buffer{}
+
+	if err := WriteRobots(&buf, "https://valette.software"); err != nil {
+		t.Fatal(err)
+	}
+
+	robots := buf.String()
+
+	expected := []string{
+		"Disallow: /admin/\n",
+		"Disallow: /en/edit-posts/\n",
+		"Disallow: /fr/new-post\n",
+		"Disallow: /posts\n",
+		"Sitemap: https://valette.software/sitemap.xml\n",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(robots, line) {
+			t.Errorf("expected robots.txt to contain \"%s\", got:\n%s", strings.TrimSpace(line), robots)
+		}
+	}
+}
+
+func TestIsDisallowed(t *testing.T) {
+	type data struct {
+		path       string
+		disallowed bool
+	}
+
+	testData := []data{
+		{"/admin/", true},
+		{"/en/admin/tags", true},
+		{"/posts/3/publish", true},
+		{"/fr/new-post", true},
+		{"/", false},
+		{"/en/articles/posts-about-go", false},
+	}
+
+	for _, test := range testData {
+		if IsDisallowed(test.path) != test.disallowed {
+			t.Errorf("expected %s to be disallowed: %t", test.path, test.disallowed)
+		}
+	}
+}
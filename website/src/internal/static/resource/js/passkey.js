@@ -0,0 +1,117 @@
+// the binary values of WebAuthn travel in base64url between the server and
+// the browser
+
+/** @param {string} text */
+function fromBase64Url(text) {
+  const base64 = text.replace(/-/g, "+").replace(/_/g, "/");
+  return Uint8Array.from(atob(base64), (char) => char.charCodeAt(0));
+}
+
+/** @param {ArrayBuffer} buffer */
+function toBase64Url(buffer) {
+  const text = String.fromCharCode(...new Uint8Array(buffer));
+  return btoa(text).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+/**
+ * @param {string} id
+ * @param {string} message
+ */
+function showPasskeyError(id, message) {
+  const element = document.getElementById(id);
+
+  if (element != null) element.textContent = message;
+}
+
+async function signInWithPasskey() {
+  try {
+    const options = await (await fetch("/login/passkey/options", { method: "post" })).json();
+
+    options.challenge = fromBase64Url(options.challenge);
+
+    const credential = await navigator.credentials.get({ publicKey: options });
+
+    if (!(credential instanceof PublicKeyCredential)) return;
+
+    const response = /** @type {AuthenticatorAssertionResponse} */ (credential.response);
+
+    const result = await fetch("/login/passkey", {
+      method: "post",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        id: credential.id,
+        response: {
+          clientDataJSON: toBase64Url(response.clientDataJSON),
+          authenticatorData: toBase64Url(response.authenticatorData),
+          signature: toBase64Url(response.signature),
+          userHandle: response.userHandle ? toBase64Url(response.userHandle) : "",
+        },
+      }),
+    });
+
+    if (!result.ok) {
+      showPasskeyError("passkey-error", await result.text());
+      return;
+    }
+
+    window.location.href = "/admin";
+  } catch (e) {
+    console.log(e);
+    showPasskeyError("passkey-error", "the passkey couldn't be used");
+  }
+}
+
+/** @param {HTMLFormElement} form */
+async function addPasskey(form) {
+  try {
+    // the code of the authenticator app, for the users who have one
+    const code = new FormData(form).get("code") || "";
+    const optionsResult = await fetch("/passkeys/options", {
+      method: "post",
+      body: new URLSearchParams({ code: code.toString() }),
+    });
+
+    if (!optionsResult.ok) {
+      showPasskeyError("passkey-error", await optionsResult.text());
+      return;
+    }
+
+    const options = await optionsResult.json();
+
+    options.challenge = fromBase64Url(options.challenge);
+    options.user.id = fromBase64Url(options.user.id);
+
+    for (const excluded of options.excludeCredentials) {
+      excluded.id = fromBase64Url(excluded.id);
+    }
+
+    const credential = await navigator.credentials.create({ publicKey: options });
+
+    if (!(credential instanceof PublicKeyCredential)) return;
+
+    const response = /** @type {AuthenticatorAttestationResponse} */ (credential.response);
+    const name = new FormData(form).get("name") || "";
+
+    const result = await fetch("/passkeys?" + new URLSearchParams({ name: name.toString() }), {
+      method: "post",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        id: credential.id,
+        response: {
+          clientDataJSON: toBase64Url(response.clientDataJSON),
+          attestationObject: toBase64Url(response.attestationObject),
+        },
+      }),
+    });
+
+    if (!result.ok) {
+      showPasskeyError("passkey-error", await result.text());
+      return;
+    }
+
+    window.location.reload();
+  } catch (e) {
+    console.log(e);
+    showPasskeyError("passkey-error", "the passkey couldn't be created");
+  }
+}
@@ -14,11 +14,16 @@ var fsStatic embed.FS
 func Serve() http.Handler {
 	fmt.Println("serve...")
 
+	return http.FileServer(http.FS(Files()))
+}
+
+// Files are the resources served under /static/.
+func Files() fs.FS {
 	resources, err := fs.Sub(fsStatic, "resource")
 
 	if err != nil {
 		log.Fatal("the resources couldn't be embeded properly")
 	}
 
-	return http.FileServer(http.FS(resources))
+	return resources
 }
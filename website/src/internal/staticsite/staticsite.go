@@ -0,0 +1,339 @@
+package staticsite
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"valette.software/internal/sitemap"
+)
+
+// seeds are the first pages crawled, the sitemaps lead to every public page
+// and the pages lead to the feeds, the images and the stylesheets.
+var seeds = []string{"/", "/robots.txt", "/sitemap.xml"}
+
+// maxRedirects stops following a link redirected in a loop.
+const maxRedirects = 10
+
+var linkAttribute = regexp.MustCompile(`(href|src)=("|')(/|/[^/"'][^"']*)("|')`)
+var srcsetAttribute = regexp.MustCompile(`srcset=("|')([^"']*)("|')`)
+var cssUrl = regexp.MustCompile(`url\(\s*(['"]?)(/[^/'")\s][^'")\s]*)(['"]?)\s*\)`)
+
+type page struct {
+	contentType string
+	body        []byte
+}
+
+type crawler struct {
+	handler   http.Handler
+	resources fs.FS
+	baseUrl   string
+	pages     map[string]page
+	redirects map[string]string
+	visited   map[string]bool
+	queue     []string
+}
+
+// Export crawls the public pages of handler and writes them in out along
+// with the resources, so that the site can be browsed without the server.
+// The links between the pages are rewritten to the relative path of the
+// files. It returns the number of pages written.
+func Export(handler http.Handler, resources fs.FS, out string, baseUrl string) (int, error) {
+	c := crawler{
+		handler:   handler,
+		resources: resources,
+		baseUrl:   baseUrl,
+		pages:     map[string]page{},
+		redirects: map[string]string{},
+		visited:   map[string]bool{},
+	}
+
+	for _, seed := range seeds {
+		c.enqueue(seed)
+	}
+
+	for len(c.queue) > 0 {
+		urlPath := c.queue[0]
+		c.queue = c.queue[1:]
+		c.fetch(urlPath)
+	}
+
+	err := copyResources(resources, filepath.Join(out, "static"))
+
+	if err != nil {
+		return 0, err
+	}
+
+	for urlPath, p := range c.pages {
+		file := filePath(urlPath)
+		body := p.body
+
+		if isRewritable(p.contentType) {
+			body = c.rewrite(file, body)
+		}
+
+		err = writeFile(filepath.Join(out, filepath.FromSlash(file)), body)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(c.pages), nil
+}
+
+func (c *crawler) enqueue(urlPath string) {
+	if c.visited[urlPath] || sitemap.IsDisallowed(urlPath) || c.isResource(urlPath) {
+		return
+	}
+
+	c.visited[urlPath] = true
+	c.queue = append(c.queue, urlPath)
+}
+
+func (c *crawler) fetch(urlPath string) {
+	req := httptest.NewRequest(http.MethodGet, urlPath, nil)
+	res := httptest.NewRecorder()
+
+	c.handler.ServeHTTP(res, req)
+
+	switch {
+	case res.Code == http.StatusOK:
+		p := page{contentType: res.Header().Get("Content-Type"), body: res.Body.Bytes()}
+		c.pages[urlPath] = p
+
+		for _, link := range c.findLinks(p) {
+			c.enqueue(link)
+		}
+	case res.Code >= 300 && res.Code < 400:
+		location := strings.TrimPrefix(res.Header().Get("Location"), c.baseUrl)
+
+		if link, ok := localLink(location); ok {
+			c.redirects[urlPath] = link
+			c.enqueue(link)
+		}
+	default:
+		log.Printf("%s skipped, status %d", urlPath, res.Code)
+	}
+}
+
+// findLinks returns the paths of the pages linked by p, without their
+// fragment. The links with a query string can't be exported.
+func (c *crawler) findLinks(p page) []string {
+	body := string(p.body)
+	var links []string
+
+	if !isRewritable(p.contentType) {
+		// the feeds, the sitemaps and robots.txt use absolute urls
+		absoluteUrl := regexp.MustCompile(regexp.QuoteMeta(c.baseUrl) + `(/[^\s"'<]*)`)
+
+		for _, match := range absoluteUrl.FindAllStringSubmatch(body, -1) {
+			links = append(links, match[1])
+		}
+	}
+
+	for _, match := range linkAttribute.FindAllStringSubmatch(body, -1) {
+		links = append(links, match[3])
+	}
+
+	for _, match := range srcsetAttribute.FindAllStringSubmatch(body, -1) {
+		for _, candidate := range strings.Split(match[2], ",") {
+			fields := strings.Fields(candidate)
+
+			if len(fields) > 0 {
+				links = append(links, fields[0])
+			}
+		}
+	}
+
+	for _, match := range cssUrl.FindAllStringSubmatch(body, -1) {
+		links = append(links, match[2])
+	}
+
+	var paths []string
+
+	for _, link := range links {
+		if urlPath, ok := localLink(html.UnescapeString(link)); ok {
+			paths = append(paths, urlPath)
+		}
+	}
+
+	return paths
+}
+
+// rewrite replaces the links of the page written in file by the relative
+// path of the exported files. The links to the pages which weren't exported
+// are kept as is.
+func (c *crawler) rewrite(file string, body []byte) []byte {
+	relink := func(link string) string {
+		urlPath, ok := localLink(html.UnescapeString(link))
+
+		if !ok {
+			return link
+		}
+
+		target, ok := c.target(urlPath)
+
+		if !ok {
+			return link
+		}
+
+		fragment := ""
+
+		if i := strings.Index(link, "#"); i >= 0 {
+			fragment = link[i:]
+		}
+
+		return relativePath(file, target) + fragment
+	}
+
+	body = linkAttribute.ReplaceAllFunc(body, func(match []byte) []byte {
+		groups := linkAttribute.FindSubmatch(match)
+
+		return []byte(fmt.Sprintf("%s=%s%s%s", groups[1], groups[2], relink(string(groups[3])), groups[4]))
+	})
+
+	body = srcsetAttribute.ReplaceAllFunc(body, func(match []byte) []byte {
+		groups := srcsetAttribute.FindSubmatch(match)
+		candidates := strings.Split(string(groups[2]), ",")
+
+		for i, candidate := range candidates {
+			fields := strings.Fields(candidate)
+
+			if len(fields) > 0 {
+				fields[0] = relink(fields[0])
+				candidates[i] = strings.Join(fields, " ")
+			}
+		}
+
+		return []byte(fmt.Sprintf("srcset=%s%s%s", groups[1], strings.Join(candidates, ", "), groups[3]))
+	})
+
+	return cssUrl.ReplaceAllFunc(body, func(match []byte) []byte {
+		groups := cssUrl.FindSubmatch(match)
+
+		return []byte(fmt.Sprintf("url(%s%s%s)", groups[1], relink(string(groups[2])), groups[3]))
+	})
+}
+
+// target returns the file exported for urlPath, following the redirects.
+func (c *crawler) target(urlPath string) (string, bool) {
+	for i := 0; i < maxRedirects; i++ {
+		if _, ok := c.pages[urlPath]; ok || c.isResource(urlPath) {
+			return filePath(urlPath), true
+		}
+
+		redirect, ok := c.redirects[urlPath]
+
+		if !ok {
+			return "", false
+		}
+
+		urlPath = redirect
+	}
+
+	return "", false
+}
+
+// isResource tells whether urlPath is one of the static resources, copied
+// rather than crawled.
+func (c *crawler) isResource(urlPath string) bool {
+	name, found := strings.CutPrefix(urlPath, "/static/")
+
+	if !found || name == "" {
+		return false
+	}
+
+	info, err := fs.Stat(c.resources, name)
+
+	return err == nil && !info.IsDir()
+}
+
+// localLink returns the path of link when it points to a page of the site
+// which can be exported.
+func localLink(link string) (string, bool) {
+	if !strings.HasPrefix(link, "/") || strings.HasPrefix(link, "//") || strings.Contains(link, "?") {
+		return "", false
+	}
+
+	link, _, _ = strings.Cut(link, "#")
+
+	return link, true
+}
+
+// filePath returns the file written for urlPath: the pages are written in
+// the index.html of their directory, so that the links keep their shape.
+func filePath(urlPath string) string {
+	file := strings.TrimPrefix(urlPath, "/")
+
+	if file == "" || strings.HasSuffix(file, "/") {
+		return file + "index.html"
+	}
+
+	if strings.Contains(path.Base(file), ".") {
+		return file
+	}
+
+	return file + "/index.html"
+}
+
+// relativePath returns the link from the file from to the file to, both
+// relative to the root of the export.
+func relativePath(from string, to string) string {
+	fromDirs := strings.Split(path.Dir(from), "/")
+	toParts := strings.Split(to, "/")
+
+	if fromDirs[0] == "." {
+		fromDirs = nil
+	}
+
+	common := 0
+
+	for common < len(fromDirs) && common < len(toParts)-1 && fromDirs[common] == toParts[common] {
+		common++
+	}
+
+	return strings.Repeat("../", len(fromDirs)-common) + strings.Join(toParts[common:], "/")
+}
+
+func isRewritable(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/html") || strings.HasPrefix(contentType, "text/css")
+}
+
+func copyResources(resources fs.FS, out string) error {
+	return fs.WalkDir(resources, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		data, err := fs.ReadFile(resources, name)
+
+		if err != nil {
+			return err
+		}
+
+		return writeFile(filepath.Join(out, filepath.FromSlash(name)), data)
+	})
+}
+
+func writeFile(file string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, data, 0644)
+}
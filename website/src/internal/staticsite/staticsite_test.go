@@ -0,0 +1,176 @@
+package staticsite
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const baseUrl = "https://valette.software"
+
+func buildTestSite() http.Handler {
+	mux := http.NewServeMux()
+
+	html := func(body string) http.HandlerFunc {
+		return func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", "text/html; charset=utf-8")
+			res.Write([]byte(body))
+		}
+	}
+
+	mux.HandleFunc("GET /{$}", html(`<link rel="stylesheet" href="/static/css/site.css">`+
+		`<link rel="stylesheet" href="/static/css/generated.css">`+
+		`<link rel="alternate" href='/articles/feed.atom'>`+
+		`<a href="/articles/">articles</a><a href="/admin/">admin</a>`+
+		`<a href="/articles/search?q=go">search</a><a href="//example.com/">example</a>`))
+	mux.HandleFunc("GET /articles/{$}", html(`<a href="/articles/first-post#intro">first</a>`+
+		`<a href="/articles/old-post">old</a><a href="/articles/missing">missing</a>`+
+		`<img src="/uploads/a.png" srcset="/uploads/a-480.png 480w, /uploads/a.png 960w">`))
+	mux.HandleFunc("GET /articles/feed.atom", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/atom+xml")
+		res.Write([]byte(`<feed></feed>`))
+	})
+	mux.HandleFunc("GET /articles/first-post", html(`<a href="/">home</a><a href="/en/">english</a>`))
+	mux.HandleFunc("GET /articles/old-post", func(res http.ResponseWriter, req *http.Request) {
+		http.Redirect(res, req, "/articles/first-post", http.StatusFound)
+	})
+	mux.HandleFunc("GET /en/{$}", html(`<a href="/en/articles/feed.atom">feed</a>`))
+	mux.HandleFunc("GET /en/articles/feed.atom", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/atom+xml")
+		res.Write([]byte(`<feed><link href="` + baseUrl + `/en/articles/first-post"/></feed>`))
+	})
+	mux.HandleFunc("GET /en/articles/first-post", html(`first post`))
+	mux.HandleFunc("GET /static/css/generated.css", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/css; charset=utf-8")
+		res.Write([]byte(`body { background: url("/uploads/a.png"); }`))
+	})
+	mux.HandleFunc("GET /uploads/", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "image/png")
+		res.Write([]byte("png"))
+	})
+	mux.HandleFunc("GET /robots.txt", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("Sitemap: " + baseUrl + "/sitemap.xml\n"))
+	})
+	mux.HandleFunc("GET /sitemap.xml", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/xml")
+		res.Write([]byte(`<urlset><url><loc>` + baseUrl + `/en/</loc></url></urlset>`))
+	})
+	mux.HandleFunc("GET /admin/", html(`admin`))
+
+	return mux
+}
+
+func TestExport(t *testing.T) {
+	out := t.TempDir()
+	resources := fstest.MapFS{
+		"css/site.css": {Data: []byte(`body { color: black; }`)},
+	}
+
+	count, err := Export(buildTestSite(), resources, out, baseUrl)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 12 {
+		t.Errorf("expected 12 pages, got %d", count)
+	}
+
+	type data struct {
+		file     string
+		contains []string
+	}
+
+	testData := []data{
+		{"index.html", []string{
+			`href="static/css/site.css"`,
+			`href="static/css/generated.css"`,
+			`href='articles/feed.atom'`,
+			`href="articles/index.html"`,
+			`href="/admin/"`,
+			`href="/articles/search?q=go"`,
+			`href="//example.com/"`,
+		}},
+		{"articles/index.html", []string{
+			`href="first-post/index.html#intro"`,
+			`href="first-post/index.html"`,
+			`href="/articles/missing"`,
+			`src="../uploads/a.png"`,
+			`srcset="../uploads/a-480.png 480w, ../uploads/a.png 960w"`,
+		}},
+		{"articles/first-post/index.html", []string{`href="../../index.html"`, `href="../../en/index.html"`}},
+		{"en/articles/feed.atom", []string{baseUrl + "/en/articles/first-post"}},
+		{"en/articles/first-post/index.html", []string{"first post"}},
+		{"static/css/site.css", []string{"color: black"}},
+		{"static/css/generated.css", []string{`url("../../uploads/a.png")`}},
+		{"robots.txt", []string{"Sitemap:"}},
+		{"sitemap.xml", []string{"<loc>"}},
+	}
+
+	for _, test := range testData {
+		content, err := os.ReadFile(filepath.Join(out, test.file))
+
+		if err != nil {
+			t.Errorf("expected %s to be exported, got %s", test.file, err)
+			continue
+		}
+
+		for _, expected := range test.contains {
+			if !strings.Contains(string(content), expected) {
+				t.Errorf("expected %s to contain %s, got %s", test.file, expected, content)
+			}
+		}
+	}
+
+	for _, file := range []string{"admin/index.html", "articles/old-post/index.html", "articles/missing/index.html"} {
+		if _, err := os.Stat(filepath.Join(out, file)); err == nil {
+			t.Errorf("expected %s not to be exported", file)
+		}
+	}
+}
+
+func TestFilePath(t *testing.T) {
+	type data struct {
+		urlPath string
+		file    string
+	}
+
+	testData := []data{
+		{"/", "index.html"},
+		{"/en/", "en/index.html"},
+		{"/articles/first-post", "articles/first-post/index.html"},
+		{"/articles/feed.rss", "articles/feed.rss"},
+		{"/sitemap-fr.xml", "sitemap-fr.xml"},
+	}
+
+	for _, test := range testData {
+		if file := filePath(test.urlPath); file != test.file {
+			t.Errorf("expected %s, got %s", test.file, file)
+		}
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	type data struct {
+		from     string
+		to       string
+		relative string
+	}
+
+	testData := []data{
+		{"index.html", "static/css/site.css", "static/css/site.css"},
+		{"articles/index.html", "articles/a/index.html", "a/index.html"},
+		{"articles/a/index.html", "articles/a/index.html", "index.html"},
+		{"en/articles/a/index.html", "static/js/app.js", "../../../static/js/app.js"},
+		{"en/articles/a/index.html", "en/index.html", "../../index.html"},
+	}
+
+	for _, test := range testData {
+		if relative := relativePath(test.from, test.to); relative != test.relative {
+			t.Errorf("expected %s, got %s", test.relative, relative)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Period is the time a code is valid for, the step of RFC 6238.
+const Period = 30 * time.Second
+
+// Digits is the length of the codes, modulo keeps as many digits.
+const Digits = 6
+const modulo = 1000000
+
+// Window is the number of steps accepted before and after the current one,
+// for the clocks of the phones running late or early.
+const Window = 1
+
+// secretSize is the number of random bytes of the secrets, as advised by
+// RFC 4226.
+const secretSize = 20
+
+var ErrInvalidSecret = errors.New("the TOTP secret is not valid base32")
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new secret, in the base32 typed in the
+// authenticator apps.
+func GenerateSecret() string {
+	secret := make([]byte, secretSize)
+	rand.Read(secret)
+
+	return encoding.EncodeToString(secret)
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.ReplaceAll(secret, " ", "")))
+
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+
+	return key, nil
+}
+
+// Step is the number of periods elapsed since the Unix epoch at t.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code of the secret for the step.
+func Code(secret string, step int64) (string, error) {
+	key, err := decodeSecret(secret)
+
+	if err != nil {
+		return "", err
+	}
+
+	return hotp(key, step), nil
+}
+
+// hotp is the code of RFC 4226 for the counter.
+func hotp(key []byte, counter int64) string {
+	mac := hmac.New(sha1.New, key)
+	binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%modulo)
+}
+
+// Validate returns the step of the code if it is valid at t, within the
+// tolerated window. The codes of the steps up to lastStep are refused, a
+// code can't be used twice.
+func Validate(secret string, code string, t time.Time, lastStep int64) (int64, bool) {
+	key, err := decodeSecret(secret)
+	code = strings.ReplaceAll(code, " ", "")
+
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+
+	for step := current - Window; step <= current+Window; step++ {
+		if step <= lastStep {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// KeyUri is the link read by the authenticator apps from the QR code, the
+// account is shown under the name of the issuer.
+func KeyUri(issuer string, account string, secret string) string {
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(Digits)},
+		"period":    {fmt.Sprint(int(Period.Seconds()))},
+	}
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
@@ -0,0 +1,91 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the secret of the test vectors of RFC 6238, in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	type data struct {
+		unix int64
+		code string
+	}
+
+	// the last 6 digits of the SHA1 codes of RFC 6238
+	testData := []data{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, test := range testData {
+		code, err := Code(rfcSecret, Step(time.Unix(test.unix, 0)))
+
+		if err != nil || code != test.code {
+			t.Errorf("expected %s at %d, got %s, error: %v", test.code, test.unix, code, err)
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err != ErrInvalidSecret {
+		t.Errorf("expected %v, got %v", ErrInvalidSecret, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// the fake clock of the server, the code is typed from a phone at issued
+	issued := time.Unix(1234567890, 0)
+	code, _ := Code(rfcSecret, Step(issued))
+
+	type data struct {
+		clock    time.Duration
+		lastStep int64
+		valid    bool
+	}
+
+	testData := []data{
+		{0, 0, true},
+		{Period, 0, true},
+		{-Period, 0, true},
+		{2 * Period, 0, false},
+		{-2 * Period, 0, false},
+		// the code was already used
+		{0, Step(issued), false},
+		{Period, Step(issued) + 1, false},
+	}
+
+	for _, test := range testData {
+		step, valid := Validate(rfcSecret, code, issued.Add(test.clock), test.lastStep)
+
+		if valid != test.valid || (valid && step != Step(issued)) {
+			t.Errorf("expected %v with the clock moved by %v and the last step %d, got %v at step %d", test.valid, test.clock, test.lastStep, valid, step)
+		}
+	}
+
+	if _, valid := Validate(rfcSecret, "005 924", issued, 0); !valid {
+		t.Errorf("expected the spaces of the code to be ignored")
+	}
+
+	if _, valid := Validate(rfcSecret, "5924", issued, 0); valid {
+		t.Errorf("expected a short code to be refused")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret := GenerateSecret()
+
+	if len(secret) != 32 || secret == GenerateSecret() {
+		t.Errorf("expected a random secret of 32 characters, got %q", secret)
+	}
+
+	uri := KeyUri("valette.software", "mehdi", secret)
+
+	if !strings.HasPrefix(uri, "otpauth://totp/valette.software:mehdi?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("expected the key URI of the secret, got %q", uri)
+	}
+}
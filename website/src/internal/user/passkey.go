@@ -0,0 +1,304 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"valette.software/internal/webauthn"
+)
+
+var ErrPasskeyNotFound = errors.New("passkey not found")
+var ErrTooManyChallenges = errors.New("too many passkey logins were started, try again in a few minutes")
+
+// maxLoginChallenges is the number of passkey logins started and not
+// finished yet, of everyone and of one address, anybody can start them.
+const maxLoginChallenges = 1000
+const maxLoginChallengesPerIp = 10
+
+// Passkey is a credential a user logs in with instead of their password.
+type Passkey struct {
+	PasskeyId  int64
+	Name       string
+	CreatedAt  int64
+	LastUsedAt int64
+}
+
+// CreatedHuman is the time the passkey was registered.
+func (passkey Passkey) CreatedHuman() string {
+	return time.Unix(passkey.CreatedAt, 0).UTC().Format("2006-01-02 15:04")
+}
+
+// LastUsedHuman is the time of the last login with the passkey.
+func (passkey Passkey) LastUsedHuman() string {
+	if passkey.LastUsedAt == 0 {
+		return "never"
+	}
+
+	return time.Unix(passkey.LastUsedAt, 0).UTC().Format("2006-01-02 15:04")
+}
+
+// userHandle identifies the user in their authenticators, the passkeys of a
+// user share it.
+func userHandle(userId int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userId))
+}
+
+// storeChallenge keeps a new challenge for the ceremony of the user, or of a
+// login without user started from ip.
+func storeChallenge(userId int64, ip string) (string, error) {
+	at := now()
+
+	// the challenges never signed are dropped from time to time
+	_, err := db.Exec("DELETE FROM webauthn_challenge WHERE created_at < ?", at.Add(-webauthn.Timeout).Unix())
+
+	if err != nil {
+		log.Print(err)
+	}
+
+	challenge := webauthn.NewChallenge()
+
+	// the challenges of the logins are counted in the same statement, the
+	// requests at the same time can't pass the limits together
+	result, err := db.Exec(
+		"INSERT INTO webauthn_challenge (challenge, user_id, ip, created_at) SELECT ?, NULLIF(?, 0), ?, ? WHERE ? != 0 OR ("+
+			"(SELECT COUNT(*) FROM webauthn_challenge WHERE user_id IS NULL) < ? AND "+
+			"(SELECT COUNT(*) FROM webauthn_challenge WHERE user_id IS NULL AND ip = ?) < ?)",
+		challenge, userId, ip, at.Unix(), userId, maxLoginChallenges, ip, maxLoginChallengesPerIp,
+	)
+
+	if err != nil {
+		log.Print(err)
+		return "", err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return "", ErrTooManyChallenges
+	}
+
+	return challenge, nil
+}
+
+// takeChallenge uses up the challenge of the ceremony of the user, a
+// response can't be replayed.
+func takeChallenge(challenge string, userId int64) error {
+	var taken string
+
+	err := db.QueryRow(
+		"DELETE FROM webauthn_challenge WHERE challenge = ? AND COALESCE(user_id, 0) = ? AND created_at >= ? RETURNING challenge",
+		challenge, userId, now().Add(-webauthn.Timeout).Unix(),
+	).Scan(&taken)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return webauthn.ErrChallenge
+	}
+
+	return err
+}
+
+// BeginPasskeyRegistration returns the options of the browser to create a
+// passkey of the user. The passkeys they already have are excluded. A
+// passkey logs in without the second factor, the users who have one must
+// type a current code of it: a session left open isn't enough.
+func BeginPasskeyRegistration(rp webauthn.RelyingParty, account User, code string) (webauthn.CreationOptions, error) {
+	hasTotp, err := HasTotp(account.UserId)
+
+	if err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+
+	if hasTotp {
+		if err := CheckSecondFactor(account.UserId, code); err != nil {
+			return webauthn.CreationOptions{}, err
+		}
+	}
+
+	rows, err := db.Query("SELECT credential_id FROM passkey WHERE user_id = ?", account.UserId)
+
+	if err != nil {
+		log.Print(err)
+		return webauthn.CreationOptions{}, err
+	}
+
+	defer rows.Close()
+
+	var exclude [][]byte
+
+	for rows.Next() {
+		var credentialId string
+
+		if err := rows.Scan(&credentialId); err != nil {
+			return webauthn.CreationOptions{}, err
+		}
+
+		if id, err := webauthn.Encoding.DecodeString(credentialId); err == nil {
+			exclude = append(exclude, id)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+
+	challenge, err := storeChallenge(account.UserId, "")
+
+	if err != nil {
+		return webauthn.CreationOptions{}, err
+	}
+
+	return webauthn.NewCreationOptions(rp, challenge, userHandle(account.UserId), account.Username, account.DisplayName, exclude), nil
+}
+
+// FinishPasskeyRegistration saves the passkey the browser created for the
+// options of BeginPasskeyRegistration.
+func FinishPasskeyRegistration(rp webauthn.RelyingParty, account User, name string, response webauthn.RegistrationResponse) (Passkey, error) {
+	challenge, err := webauthn.Challenge(response.Response.ClientDataJson)
+
+	if err != nil {
+		return Passkey{}, err
+	}
+
+	if err := takeChallenge(challenge, account.UserId); err != nil {
+		return Passkey{}, err
+	}
+
+	credential, err := webauthn.VerifyRegistration(rp, challenge, response)
+
+	if err != nil {
+		return Passkey{}, err
+	}
+
+	passkey := Passkey{Name: strings.TrimSpace(name), CreatedAt: now().Unix()}
+
+	if passkey.Name == "" {
+		passkey.Name = "passkey"
+	}
+
+	err = db.QueryRow(
+		"INSERT INTO passkey (user_id, credential_id, public_key, sign_count, name, created_at) VALUES (?, ?, ?, ?, ?, ?) RETURNING passkey_id",
+		account.UserId, webauthn.Encoding.EncodeToString(credential.Id), credential.PublicKey, credential.SignCount, passkey.Name, passkey.CreatedAt,
+	).Scan(&passkey.PasskeyId)
+
+	if err != nil {
+		log.Print(err)
+		return Passkey{}, err
+	}
+
+	return passkey, nil
+}
+
+// ListPasskeys returns the passkeys of the user, the oldest first.
+func ListPasskeys(userId int64) ([]Passkey, error) {
+	rows, err := db.Query("SELECT passkey_id, name, created_at, last_used_at FROM passkey WHERE user_id = ? ORDER BY passkey_id", userId)
+
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var passkeys []Passkey
+
+	for rows.Next() {
+		passkey := Passkey{}
+
+		if err := rows.Scan(&passkey.PasskeyId, &passkey.Name, &passkey.CreatedAt, &passkey.LastUsedAt); err != nil {
+			return nil, err
+		}
+
+		passkeys = append(passkeys, passkey)
+	}
+
+	return passkeys, rows.Err()
+}
+
+// DeletePasskey removes a passkey of the user, it opens no session anymore.
+func DeletePasskey(userId int64, passkeyId int64) error {
+	result, err := db.Exec("DELETE FROM passkey WHERE passkey_id = ? AND user_id = ?", passkeyId, userId)
+
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	return nil
+}
+
+// BeginPasskeyLogin returns the options of the browser at ip to sign in with
+// a passkey, the user is not known yet.
+func BeginPasskeyLogin(rp webauthn.RelyingParty, ip string) (webauthn.RequestOptions, error) {
+	challenge, err := storeChallenge(0, ip)
+
+	if err != nil {
+		return webauthn.RequestOptions{}, err
+	}
+
+	return webauthn.NewRequestOptions(rp, challenge), nil
+}
+
+// AuthenticatePasskey returns the user whose passkey signed the challenge of
+// BeginPasskeyLogin. The passkeys unlocked with a PIN or a fingerprint stand
+// for both the password and the second factor.
+func AuthenticatePasskey(rp webauthn.RelyingParty, response webauthn.AssertionResponse) (User, error) {
+	challenge, err := webauthn.Challenge(response.Response.ClientDataJson)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	if err := takeChallenge(challenge, 0); err != nil {
+		return User{}, err
+	}
+
+	var passkeyId, userId int64
+	credential := webauthn.Credential{}
+
+	err = db.QueryRow(
+		"SELECT passkey_id, user_id, public_key, sign_count FROM passkey WHERE credential_id = ?", response.Id,
+	).Scan(&passkeyId, &userId, &credential.PublicKey, &credential.SignCount)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrPasskeyNotFound
+	} else if err != nil {
+		log.Print(err)
+		return User{}, err
+	}
+
+	if response.Response.UserHandle != "" && response.Response.UserHandle != webauthn.Encoding.EncodeToString(userHandle(userId)) {
+		return User{}, webauthn.ErrInvalidResponse
+	}
+
+	signCount, err := webauthn.VerifyAssertion(rp, challenge, credential, response)
+
+	if errors.Is(err, webauthn.ErrSignCount) {
+		log.Printf("the passkey %d of the user %d sent a counter not above %d, it may be cloned", passkeyId, userId, credential.SignCount)
+		return User{}, err
+	} else if err != nil {
+		return User{}, err
+	}
+
+	// two logins with the same counter can't both pass
+	result, err := db.Exec(
+		"UPDATE passkey SET sign_count = ?, last_used_at = ? WHERE passkey_id = ? AND sign_count = ?",
+		signCount, now().Unix(), passkeyId, credential.SignCount,
+	)
+
+	if err != nil {
+		log.Print(err)
+		return User{}, err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return User{}, webauthn.ErrSignCount
+	}
+
+	return Get(userId)
+}
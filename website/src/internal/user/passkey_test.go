@@ -0,0 +1,220 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"valette.software/internal/webauthn"
+	"valette.software/internal/webauthn/webauthntest"
+)
+
+var testRp = webauthn.RelyingParty{Id: "valette.software", Name: "valette.software", Origin: "https://valette.software"}
+
+// registerPasskey creates a passkey of the account on the authenticator, as
+// the passkeys page does.
+func registerPasskey(t *testing.T, account User, authenticator *webauthntest.Authenticator) Passkey {
+	options, err := BeginPasskeyRegistration(testRp, account, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := authenticator.Register(options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passkey, err := FinishPasskeyRegistration(testRp, account, "phone", response)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return passkey
+}
+
+// loginWithPasskey signs in with the authenticator, as the login page does.
+func loginWithPasskey(t *testing.T, authenticator *webauthntest.Authenticator) (User, error) {
+	options, err := BeginPasskeyLogin(testRp, "192.0.2.1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := authenticator.Login(options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return AuthenticatePasskey(testRp, response)
+}
+
+func TestPasskeyCeremonies(t *testing.T) {
+	openTestDatabase(t)
+	setClock(t)
+
+	owner, _ := Get(1)
+	authenticator := webauthntest.New(testRp.Origin)
+	passkey := registerPasskey(t, owner, authenticator)
+
+	if passkey.Name != "phone" || passkey.LastUsedHuman() != "never" {
+		t.Errorf("expected the passkey phone never used, got %+v", passkey)
+	}
+
+	loggedIn, err := loginWithPasskey(t, authenticator)
+
+	if err != nil || loggedIn.UserId != owner.UserId {
+		t.Fatalf("expected the passkey to log the owner in, got %+v, error: %v", loggedIn, err)
+	}
+
+	passkeys, err := ListPasskeys(owner.UserId)
+
+	if err != nil || len(passkeys) != 1 || passkeys[0].LastUsedAt == 0 {
+		t.Errorf("expected the passkey to be listed as used, got %+v, error: %v", passkeys, err)
+	}
+
+	// the same authenticator can't register the user twice
+	options, _ := BeginPasskeyRegistration(testRp, owner, "")
+
+	if len(options.ExcludeCredentials) != 1 {
+		t.Errorf("expected the passkey registered to be excluded, got %+v", options.ExcludeCredentials)
+	}
+
+	if err := DeletePasskey(2, passkey.PasskeyId); !errors.Is(err, ErrPasskeyNotFound) {
+		t.Errorf("expected a user to not delete the passkeys of the others, got %v", err)
+	}
+
+	if err := DeletePasskey(owner.UserId, passkey.PasskeyId); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loginWithPasskey(t, authenticator); !errors.Is(err, ErrPasskeyNotFound) {
+		t.Errorf("expected the passkey deleted to open nothing, got %v", err)
+	}
+}
+
+func TestPasskeyChallenges(t *testing.T) {
+	openTestDatabase(t)
+	clock := setClock(t)
+
+	owner, _ := Get(1)
+	authenticator := webauthntest.New(testRp.Origin)
+	registerPasskey(t, owner, authenticator)
+
+	options, _ := BeginPasskeyLogin(testRp, "192.0.2.1")
+	response, _ := authenticator.Login(options)
+
+	if _, err := AuthenticatePasskey(testRp, response); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AuthenticatePasskey(testRp, response); !errors.Is(err, webauthn.ErrChallenge) {
+		t.Errorf("expected a response to be used once, got %v", err)
+	}
+
+	options, _ = BeginPasskeyLogin(testRp, "192.0.2.1")
+	response, _ = authenticator.Login(options)
+	*clock = clock.Add(webauthn.Timeout + time.Second)
+
+	if _, err := AuthenticatePasskey(testRp, response); !errors.Is(err, webauthn.ErrChallenge) {
+		t.Errorf("expected the challenge to expire after %v, got %v", webauthn.Timeout, err)
+	}
+
+	// the challenge of a registration doesn't open a session
+	creation, _ := BeginPasskeyRegistration(testRp, owner, "")
+	response, _ = authenticator.Login(webauthn.NewRequestOptions(testRp, creation.Challenge))
+
+	if _, err := AuthenticatePasskey(testRp, response); !errors.Is(err, webauthn.ErrChallenge) {
+		t.Errorf("expected the challenge of a registration to be refused at login, got %v", err)
+	}
+
+	// nor does the challenge of another user register a passkey
+	writer, err := Create("writer", "Writer", "writer password", RoleContributor)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creation, _ = BeginPasskeyRegistration(testRp, owner, "")
+	registration, _ := webauthntest.New(testRp.Origin).Register(creation)
+
+	if _, err := FinishPasskeyRegistration(testRp, writer, "", registration); !errors.Is(err, webauthn.ErrChallenge) {
+		t.Errorf("expected the challenge of another user to be refused, got %v", err)
+	}
+}
+
+func TestPasskeyWithSecondFactor(t *testing.T) {
+	openTestDatabase(t)
+	clock := setClock(t)
+	secret, _ := enableTotp(t, clock)
+
+	owner, _ := Get(1)
+
+	if _, err := BeginPasskeyRegistration(testRp, owner, ""); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("expected a passkey to need the second factor, got %v", err)
+	}
+
+	*clock = clock.Add(30 * time.Second)
+
+	if _, err := BeginPasskeyRegistration(testRp, owner, codeAt(t, secret, *clock)); err != nil {
+		t.Errorf("expected a current code to allow a passkey, got %v", err)
+	}
+}
+
+func TestLoginChallengeLimit(t *testing.T) {
+	openTestDatabase(t)
+	clock := setClock(t)
+
+	for range maxLoginChallengesPerIp {
+		if _, err := BeginPasskeyLogin(testRp, "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := BeginPasskeyLogin(testRp, "192.0.2.1"); !errors.Is(err, ErrTooManyChallenges) {
+		t.Errorf("expected the logins of an address to be limited, got %v", err)
+	}
+
+	if _, err := BeginPasskeyLogin(testRp, "192.0.2.2"); err != nil {
+		t.Errorf("expected the other addresses to start a login, got %v", err)
+	}
+
+	// the registrations are only started by the users logged in
+	owner, _ := Get(1)
+
+	if _, err := BeginPasskeyRegistration(testRp, owner, ""); err != nil {
+		t.Errorf("expected the registrations to be left out of the limit, got %v", err)
+	}
+
+	*clock = clock.Add(webauthn.Timeout + time.Second)
+
+	if _, err := BeginPasskeyLogin(testRp, "192.0.2.1"); err != nil {
+		t.Errorf("expected the expired challenges to be left out of the limit, got %v", err)
+	}
+}
+
+func TestClonedPasskey(t *testing.T) {
+	openTestDatabase(t)
+	setClock(t)
+
+	owner, _ := Get(1)
+	authenticator := webauthntest.New(testRp.Origin)
+	registerPasskey(t, owner, authenticator)
+	clone := authenticator.Clone()
+
+	if _, err := loginWithPasskey(t, authenticator); err != nil {
+		t.Fatal(err)
+	}
+
+	// the clone still has the counter of the copy, behind the one stored
+	if _, err := loginWithPasskey(t, clone); !errors.Is(err, webauthn.ErrSignCount) {
+		t.Errorf("expected the cloned passkey to be refused, got %v", err)
+	}
+
+	if _, err := loginWithPasskey(t, authenticator); err != nil {
+		t.Errorf("expected the genuine passkey to keep working, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package user
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2Params is the cost of an argon2id hash: the memory in KiB, the
+// passes over it and the threads filling it.
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// hashParams is the cost of the new hashes, the older ones are replaced at
+// the next login when it is raised. It is lowered in the tests.
+var hashParams = argon2Params{memory: 64 * 1024, time: 3, threads: 2}
+
+const saltSize = 16
+const keySize = 32
+
+var errMalformedHash = errors.New("malformed password hash")
+
+// IsPasswordHash tells whether value is a hash that checkPassword reads,
+// rather than a password.
+func IsPasswordHash(value string) bool {
+	return strings.HasPrefix(value, "$argon2id$") || strings.HasPrefix(value, "pbkdf2-sha256$")
+}
+
+// HashPassword returns the salted argon2id hash of the password, in the
+// format "$argon2id$v=19$m=65536,t=3,p=2$salt$key" understood by the other
+// implementations.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, saltSize)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, hashParams.time, hashParams.memory, hashParams.threads, keySize)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, hashParams.memory, hashParams.time, hashParams.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// checkPassword tells whether the password matches the hash, in constant
+// time, and whether the hash should be replaced because it was made with
+// another cost or algorithm.
+func checkPassword(hash string, password string) (bool, bool, error) {
+	if strings.HasPrefix(hash, "pbkdf2-sha256$") {
+		valid, err := checkPbkdf2(hash, password)
+
+		return valid, true, err
+	}
+
+	fields := strings.Split(hash, "$")
+
+	if len(fields) != 6 || fields[0] != "" || fields[1] != "argon2id" || fields[2] != "v="+strconv.Itoa(argon2.Version) {
+		return false, false, errMalformedHash
+	}
+
+	params := argon2Params{}
+
+	_, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads)
+
+	if err != nil || params.memory == 0 || params.time == 0 || params.threads == 0 {
+		return false, false, errMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(fields[4])
+
+	if err != nil {
+		return false, false, errMalformedHash
+	}
+
+	expected, err := base64.RawStdEncoding.DecodeString(fields[5])
+
+	if err != nil || len(expected) == 0 {
+		return false, false, errMalformedHash
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(expected)))
+
+	return subtle.ConstantTimeCompare(key, expected) == 1, params != hashParams, nil
+}
+
+// checkPbkdf2 verifies the hashes of the first accounts, in the format
+// "pbkdf2-sha256$iterations$salt$key".
+func checkPbkdf2(hash string, password string) (bool, error) {
+	fields := strings.Split(hash, "$")
+
+	if len(fields) != 4 {
+		return false, errMalformedHash
+	}
+
+	iterations, err := strconv.Atoi(fields[1])
+
+	if err != nil || iterations <= 0 {
+		return false, errMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(fields[2])
+
+	if err != nil {
+		return false, errMalformedHash
+	}
+
+	expected, err := base64.RawStdEncoding.DecodeString(fields[3])
+
+	if err != nil {
+		return false, errMalformedHash
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
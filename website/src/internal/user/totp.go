@@ -0,0 +1,325 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"valette.software/internal/totp"
+)
+
+// RecoveryCodeCount is the number of recovery codes given when the second
+// factor is enabled.
+const RecoveryCodeCount = 10
+
+// maxCodeFailures is the number of wrong codes in a row locking the second
+// factor of the user, a new login with the password doesn't unlock it.
+const maxCodeFailures = 5
+
+// codeLockout is how long the first lock lasts, it doubles with every new
+// series of wrong codes, up to 64 times.
+const codeLockout = 15 * time.Minute
+
+var ErrTotpEnabled = errors.New("the second factor is already enabled")
+var ErrTotpNotStarted = errors.New("the second factor is not being enabled")
+var ErrTotpDisabled = errors.New("the second factor is not enabled")
+var ErrInvalidCode = errors.New("the code is invalid or was already used")
+var ErrSecondFactorLocked = errors.New("too many wrong codes were typed, try again later")
+
+// now is the clock of the codes, it is replaced in the tests.
+var now = time.Now
+
+// Totp is the second factor of a user.
+type Totp struct {
+	Enabled bool
+	// Secret is only given while the second factor is being enabled.
+	Secret            string
+	RecoveryCodesLeft int
+}
+
+// GetTotp returns the second factor of the user, disabled if there is none.
+func GetTotp(userId int64) (Totp, error) {
+	var secret string
+	var enabledAt int64
+
+	err := db.QueryRow("SELECT secret, enabled_at FROM user_totp WHERE user_id = ?", userId).Scan(&secret, &enabledAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Totp{}, nil
+	} else if err != nil {
+		log.Print(err)
+		return Totp{}, err
+	}
+
+	if enabledAt == 0 {
+		return Totp{Secret: secret}, nil
+	}
+
+	status := Totp{Enabled: true}
+
+	err = db.QueryRow("SELECT COUNT(*) FROM recovery_code WHERE user_id = ? AND used_at = 0", userId).Scan(&status.RecoveryCodesLeft)
+
+	return status, err
+}
+
+// HasTotp tells whether the user types a code after the password.
+func HasTotp(userId int64) (bool, error) {
+	status, err := GetTotp(userId)
+
+	return status.Enabled, err
+}
+
+// StartTotp generates the secret of the user, to add in their authenticator
+// app. The second factor is only enabled by ConfirmTotp.
+func StartTotp(userId int64) (string, error) {
+	secret := totp.GenerateSecret()
+
+	result, err := db.Exec(
+		"INSERT INTO user_totp (user_id, secret) VALUES (?, ?) ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret WHERE enabled_at = 0",
+		userId, secret,
+	)
+
+	if err != nil {
+		log.Print(err)
+		return "", err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return "", ErrTotpEnabled
+	}
+
+	return secret, nil
+}
+
+// ConfirmTotp enables the second factor once the user typed a code of the
+// secret, and returns the recovery codes. They are only shown once, only
+// their hashes are kept.
+func ConfirmTotp(userId int64, code string) ([]string, error) {
+	status, err := GetTotp(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if status.Enabled {
+		return nil, ErrTotpEnabled
+	}
+
+	if status.Secret == "" {
+		return nil, ErrTotpNotStarted
+	}
+
+	step, valid := totp.Validate(status.Secret, code, now(), 0)
+
+	if !valid {
+		return nil, ErrInvalidCode
+	}
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE user_totp SET enabled_at = ?, last_step = ? WHERE user_id = ?", now().Unix(), step, userId)
+
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, the
+// former ones stop working.
+func RegenerateRecoveryCodes(userId int64) ([]string, error) {
+	enabled, err := HasTotp(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !enabled {
+		return nil, ErrTotpDisabled
+	}
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userId int64) ([]string, error) {
+	_, err := tx.Exec("DELETE FROM recovery_code WHERE user_id = ?", userId)
+
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+
+	for range RecoveryCodeCount {
+		text := strings.ToLower(rand.Text())
+		code := text[:5] + "-" + text[5:10]
+
+		_, err := tx.Exec("INSERT INTO recovery_code (user_id, code_hash) VALUES (?, ?)", userId, hashRecoveryCode(code))
+
+		if err != nil {
+			log.Print(err)
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// hashRecoveryCode hashes the code without salt nor cost: the codes are
+// random, and found by their hashes.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckSecondFactor accepts a code of the authenticator app of the user, or
+// one of their recovery codes which is then used up. After maxCodeFailures
+// wrong codes, the codes are refused with ErrSecondFactorLocked for a while.
+func CheckSecondFactor(userId int64, code string) error {
+	var secret string
+	var lastStep int64
+
+	at := now().Unix()
+
+	// the attempt is counted before the code is checked, the guesses sent at
+	// once can't go over the limit. A valid code resets the count
+	err := db.QueryRow(
+		"UPDATE user_totp SET failed_attempts = failed_attempts + 1, "+
+			"locked_until = CASE WHEN (failed_attempts + 1) % ? = 0 THEN ? + ? * (1 << MIN((failed_attempts + 1) / ? - 1, 6)) ELSE locked_until END "+
+			"WHERE user_id = ? AND enabled_at != 0 AND locked_until <= ? RETURNING secret, last_step",
+		maxCodeFailures, at, int64(codeLockout.Seconds()), maxCodeFailures, userId, at,
+	).Scan(&secret, &lastStep)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return lockedOrDisabled(userId)
+	} else if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	if step, valid := totp.Validate(secret, code, now(), lastStep); valid {
+		// two requests with the same code can't both pass
+		result, err := db.Exec(
+			"UPDATE user_totp SET last_step = ?, failed_attempts = 0, locked_until = 0 WHERE user_id = ? AND last_step < ?",
+			step, userId, step,
+		)
+
+		if err != nil {
+			log.Print(err)
+			return err
+		}
+
+		if count, _ := result.RowsAffected(); count == 0 {
+			return ErrInvalidCode
+		}
+
+		return nil
+	}
+
+	result, err := db.Exec(
+		"UPDATE recovery_code SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at = 0",
+		now().Unix(), userId, hashRecoveryCode(code),
+	)
+
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrInvalidCode
+	}
+
+	_, err = db.Exec("UPDATE user_totp SET failed_attempts = 0, locked_until = 0 WHERE user_id = ?", userId)
+
+	if err != nil {
+		log.Print(err)
+	}
+
+	return err
+}
+
+// lockedOrDisabled tells why no code of the user can be checked.
+func lockedOrDisabled(userId int64) error {
+	enabled, err := HasTotp(userId)
+
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		return ErrSecondFactorLocked
+	}
+
+	return ErrTotpDisabled
+}
+
+// DisableTotp removes the second factor of the user and their recovery
+// codes.
+func DisableTotp(userId int64) error {
+	_, err := db.Exec("DELETE FROM recovery_code WHERE user_id = ?", userId)
+
+	if err == nil {
+		_, err = db.Exec("DELETE FROM user_totp WHERE user_id = ?", userId)
+	}
+
+	if err != nil {
+		log.Print(err)
+	}
+
+	return err
+}
+
+// DisableTotpByUsername removes the second factor of the user who lost both
+// their phone and their recovery codes, from the command line.
+func DisableTotpByUsername(username string) error {
+	var userId int64
+
+	err := db.QueryRow("SELECT user_id FROM user WHERE username = ?", strings.ToLower(strings.TrimSpace(username))).Scan(&userId)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return DisableTotp(userId)
+}
@@ -0,0 +1,244 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"valette.software/internal/totp"
+)
+
+// setClock sets the clock of the codes, and returns it to be moved.
+func setClock(t *testing.T) *time.Time {
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	t.Cleanup(func() { now = time.Now })
+
+	return &clock
+}
+
+func codeAt(t *testing.T, secret string, at time.Time) string {
+	code, err := totp.Code(secret, totp.Step(at))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+// enableTotp enables the second factor of the first owner, and returns its
+// secret and recovery codes.
+func enableTotp(t *testing.T, clock *time.Time) (string, []string) {
+	secret, err := StartTotp(1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes, err := ConfirmTotp(1, codeAt(t, secret, *clock))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return secret, codes
+}
+
+func TestTotpEnrollment(t *testing.T) {
+	openTestDatabase(t)
+	clock := setClock(t)
+
+	if enabled, _ := HasTotp(1); enabled {
+		t.Errorf("expected the second factor to be disabled at first")
+	}
+
+	secret, err := StartTotp(1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if enabled, _ := HasTotp(1); enabled {
+		t.Errorf("expected the second factor to wait for a code before being enabled")
+	}
+
+	if _, err := ConfirmTotp(1, "000000"); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("expected a wrong code to not enable the second factor, got %v", err)
+	}
+
+	codes, err := ConfirmTotp(1, codeAt(t, secret, *clock))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := GetTotp(1)
+
+	if err != nil || !status.Enabled || status.Secret != "" || status.RecoveryCodesLeft != RecoveryCodeCount || len(codes) != RecoveryCodeCount {
+		t.Errorf("expected the second factor enabled with %d recovery codes, got %+v and %d codes, error: %v", RecoveryCodeCount, status, len(codes), err)
+	}
+
+	if _, err := StartTotp(1); !errors.Is(err, ErrTotpEnabled) {
+		t.Errorf("expected the secret enabled to not be replaced, got %v", err)
+	}
+
+	if err := DisableTotpByUsername("Admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if enabled, _ := HasTotp(1); enabled {
+		t.Errorf("expected the second factor to be disabled")
+	}
+
+	if err := CheckSecondFactor(1, codes[0]); !errors.Is(err, ErrTotpDisabled) {
+		t.Errorf("expected the recovery codes to be removed with the second factor, got %v", err)
+	}
+}
+
+func TestTotpWindow(t *testing.T) {
+	openTestDatabase(t)
+	clock := setClock(t)
+	secret, _ := enableTotp(t, clock)
+
+	type data struct {
+		offset time.Duration
+		valid  bool
+	}
+
+	// the codes of the phone, late or early, typed at the clock of the server
+	testData := []data{
+		{-2 * totp.Period, false},
+		{-totp.Period, true},
+		{0, true},
+		{totp.Period, true},
+		{2 * totp.Period, false},
+	}
+
+	for _, test := range testData {
+		// every test starts a few steps later, the codes aren't used yet
+		*clock = clock.Add(5 * totp.Period)
+		err := CheckSecondFactor(1, codeAt(t, secret, clock.Add(test.offset)))
+
+		if (err == nil) != test.valid {
+			t.Errorf("expected the code %v away to be valid: %v, got %v", test.offset, test.valid, err)
+		}
+	}
+}
+
+func TestTotpReplay(t *testing.T) {
+	openTestDatabase(t)
+	clock := setClock(t)
+	secret, _ := enableTotp(t, clock)
+
+	if err := CheckSecondFactor(1, codeAt(t, secret, *clock)); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("expected the code of the enrollment to not be used again, got %v", err)
+	}
+
+	*clock = clock.Add(totp.Period)
+	code := codeAt(t, secret, *clock)
+
+	if err := CheckSecondFactor(1, code); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckSecondFactor(1, code); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("expected a code to be used once, got %v", err)
+	}
+
+	// the code of the previous step is still in the window, but older
+	if err := CheckSecondFactor(1, codeAt(t, secret, clock.Add(-totp.Period))); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("expected a code older than the last one used to be refused, got %v", err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	openTestDatabase(t)
+	clock := setClock(t)
+	_, codes := enableTotp(t, clock)
+
+	if err := CheckSecondFactor(1, codes[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckSecondFactor(1, codes[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("expected a recovery code to be used once, got %v", err)
+	}
+
+	// the codes are read from paper, the case and the dash don't matter
+	typed := codes[1][:5] + " " + codes[1][6:]
+
+	if err := CheckSecondFactor(1, typed); err != nil {
+		t.Errorf("expected %q to match %q, got %v", typed, codes[1], err)
+	}
+
+	if status, _ := GetTotp(1); status.RecoveryCodesLeft != RecoveryCodeCount-2 {
+		t.Errorf("expected %d recovery codes left, got %d", RecoveryCodeCount-2, status.RecoveryCodesLeft)
+	}
+
+	renewed, err := RegenerateRecoveryCodes(1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckSecondFactor(1, codes[2]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("expected the former recovery codes to stop working, got %v", err)
+	}
+
+	if err := CheckSecondFactor(1, renewed[0]); err != nil {
+		t.Errorf("expected the new recovery codes to work, got %v", err)
+	}
+}
+
+func TestSecondFactorLockout(t *testing.T) {
+	openTestDatabase(t)
+	clock := setClock(t)
+	secret, codes := enableTotp(t, clock)
+
+	// fails locks the second factor with wrong codes
+	fails := func() {
+		for range maxCodeFailures {
+			if err := CheckSecondFactor(1, "000000"); !errors.Is(err, ErrInvalidCode) {
+				t.Fatalf("expected a wrong code to be refused, got %v", err)
+			}
+		}
+	}
+
+	fails()
+
+	*clock = clock.Add(totp.Period)
+
+	if err := CheckSecondFactor(1, codeAt(t, secret, *clock)); !errors.Is(err, ErrSecondFactorLocked) {
+		t.Errorf("expected the valid code to be refused while locked, got %v", err)
+	}
+
+	if err := CheckSecondFactor(1, codes[0]); !errors.Is(err, ErrSecondFactorLocked) {
+		t.Errorf("expected the recovery code to be refused while locked, got %v", err)
+	}
+
+	// the lock ends, the second series of wrong codes locks twice as long
+	*clock = clock.Add(codeLockout)
+	fails()
+	*clock = clock.Add(codeLockout)
+
+	if err := CheckSecondFactor(1, codeAt(t, secret, *clock)); !errors.Is(err, ErrSecondFactorLocked) {
+		t.Errorf("expected the second lock to last longer, got %v", err)
+	}
+
+	*clock = clock.Add(codeLockout)
+
+	if err := CheckSecondFactor(1, codeAt(t, secret, *clock)); err != nil {
+		t.Fatalf("expected the valid code to be accepted after the lock, got %v", err)
+	}
+
+	// the valid code resets the count
+	for range maxCodeFailures - 1 {
+		CheckSecondFactor(1, "000000")
+	}
+
+	if err := CheckSecondFactor(1, codes[0]); err != nil {
+		t.Errorf("expected the count to start again after a valid code, got %v", err)
+	}
+}
@@ -0,0 +1,365 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"valette.software/internal/blog"
+	"valette.software/internal/database"
+)
+
+const (
+	// RoleOwner manages the accounts besides everything an editor does.
+	RoleOwner = "owner"
+	// RoleEditor writes, publishes and moderates every post.
+	RoleEditor = "editor"
+	// RoleContributor only writes drafts, and only edits theirs.
+	RoleContributor = "contributor"
+)
+
+// Roles lists the roles from the most to the least powerful.
+var Roles = []string{RoleOwner, RoleEditor, RoleContributor}
+
+// MinPasswordLength is the length of the shortest password accepted.
+const MinPasswordLength = 10
+
+var ErrNotFound = errors.New("user not found")
+var ErrWrongCredentials = errors.New("wrong username or password")
+var ErrInvalidUsername = errors.New("the username must be made of lowercase letters, digits, dots, dashes or underscores")
+var ErrUsernameTaken = errors.New("another user already has this username")
+var ErrDisplayNameMissing = errors.New("the display name must not be empty")
+var ErrPasswordTooShort = errors.New("the password is too short")
+var ErrInvalidRole = errors.New("unknown role")
+var ErrLastOwner = errors.New("the last owner can't be removed or demoted")
+
+var validUsername = regexp.MustCompile(`^[a-z0-9._-]{1,50}$`)
+
+const userColumns = "user_id, username, display_name, role, created_at"
+
+var db *sql.DB
+
+// User is an account of the admin area.
+type User struct {
+	UserId      int64
+	Username    string
+	DisplayName string
+	Role        string
+	CreatedAt   int64
+}
+
+// Init creates the first owner, named "admin", when there is no account yet.
+// Its password is given hashed, a password in clear is still accepted when it
+// is as long as the passwords of the other accounts. The server doesn't start
+// otherwise.
+func Init(password string) {
+	db = database.Get()
+
+	err := createFirstOwner(password)
+
+	if err != nil {
+		log.Fatal("couldn't create the first admin account: ", err)
+	}
+}
+
+func createFirstOwner(password string) error {
+	var count int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM user").Scan(&count)
+
+	if err != nil || count > 0 {
+		return err
+	}
+
+	hash := password
+
+	if !IsPasswordHash(password) {
+		log.Print("the admin password of the configuration should be hashed with the command hash-password")
+
+		if len(password) < MinPasswordLength {
+			return ErrPasswordTooShort
+		}
+
+		hash, err = HashPassword(password)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO user (username, display_name, password_hash, role, created_at) VALUES (?, ?, ?, ?, ?)",
+		"admin", "admin", hash, RoleOwner, time.Now().Unix(),
+	)
+
+	return err
+}
+
+// HasRole tells whether the user has role or a more powerful one.
+func (user User) HasRole(role string) bool {
+	return user.UserId != 0 && rank(user.Role) <= rank(role)
+}
+
+// CanEditPost tells whether the user may open the post in the editor and
+// save it: the contributors only edit their own drafts.
+func (user User) CanEditPost(post blog.Post) bool {
+	if user.HasRole(RoleEditor) {
+		return true
+	}
+
+	return user.UserId != 0 && post.UserId == user.UserId && post.Status == blog.StatusDraft
+}
+
+func rank(role string) int {
+	for i, known := range Roles {
+		if known == role {
+			return i
+		}
+	}
+
+	return len(Roles)
+}
+
+func scanUser(row interface{ Scan(...any) error }) (User, error) {
+	user := User{}
+
+	err := row.Scan(&user.UserId, &user.Username, &user.DisplayName, &user.Role, &user.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	} else if err != nil {
+		log.Print(err)
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// Get returns the user.
+func Get(id int64) (User, error) {
+	return scanUser(db.QueryRow("SELECT "+userColumns+" FROM user WHERE user_id = ?", id))
+}
+
+// List returns every user, the oldest first.
+func List() ([]User, error) {
+	rows, err := db.Query("SELECT " + userColumns + " FROM user ORDER BY user_id")
+
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var users []User
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// Authenticate returns the user whose credentials are given. An unknown
+// username takes as long as a wrong password, to not tell the usernames.
+func Authenticate(username string, password string) (User, error) {
+	var hash string
+	user := User{}
+
+	err := db.QueryRow("SELECT "+userColumns+", password_hash FROM user WHERE username = ?", strings.ToLower(strings.TrimSpace(username))).
+		Scan(&user.UserId, &user.Username, &user.DisplayName, &user.Role, &user.CreatedAt, &hash)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		HashPassword(password)
+		return User{}, ErrWrongCredentials
+	} else if err != nil {
+		log.Print(err)
+		return User{}, err
+	}
+
+	valid, rehash, err := checkPassword(hash, password)
+
+	if err != nil {
+		log.Print(err)
+		return User{}, err
+	}
+
+	if !valid {
+		return User{}, ErrWrongCredentials
+	}
+
+	if rehash {
+		// the password is only known now, the login goes on if it fails
+		hash, err = HashPassword(password)
+
+		if err == nil {
+			_, err = db.Exec("UPDATE user SET password_hash = ? WHERE user_id = ?", hash, user.UserId)
+		}
+
+		if err != nil {
+			log.Print("couldn't rehash the password: ", err)
+		}
+	}
+
+	return user, nil
+}
+
+// Create adds an account.
+func Create(username string, displayName string, password string, role string) (User, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	displayName = strings.TrimSpace(displayName)
+
+	if !validUsername.MatchString(username) {
+		return User{}, ErrInvalidUsername
+	}
+
+	if displayName == "" {
+		return User{}, ErrDisplayNameMissing
+	}
+
+	if rank(role) == len(Roles) {
+		return User{}, ErrInvalidRole
+	}
+
+	if len(password) < MinPasswordLength {
+		return User{}, ErrPasswordTooShort
+	}
+
+	hash, err := HashPassword(password)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	var id int64
+
+	err = db.QueryRow(
+		"INSERT INTO user (username, display_name, password_hash, role, created_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT (username) DO NOTHING RETURNING user_id",
+		username, displayName, hash, role, time.Now().Unix(),
+	).Scan(&id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUsernameTaken
+	} else if err != nil {
+		log.Print(err)
+		return User{}, err
+	}
+
+	return Get(id)
+}
+
+// Update changes the display name and the role of the user, and its
+// password unless it is empty.
+func Update(id int64, displayName string, role string, password string) (User, error) {
+	displayName = strings.TrimSpace(displayName)
+
+	if displayName == "" {
+		return User{}, ErrDisplayNameMissing
+	}
+
+	if rank(role) == len(Roles) {
+		return User{}, ErrInvalidRole
+	}
+
+	if password != "" && len(password) < MinPasswordLength {
+		return User{}, ErrPasswordTooShort
+	}
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return User{}, err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE user SET display_name = ?, role = ? WHERE user_id = ?", displayName, role, id)
+
+	if err != nil {
+		log.Print(err)
+		return User{}, err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return User{}, ErrNotFound
+	}
+
+	if err := checkOwnerLeft(tx); err != nil {
+		return User{}, err
+	}
+
+	if password != "" {
+		hash, err := HashPassword(password)
+
+		if err != nil {
+			return User{}, err
+		}
+
+		_, err = tx.Exec("UPDATE user SET password_hash = ? WHERE user_id = ?", hash, id)
+
+		if err != nil {
+			log.Print(err)
+			return User{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return User{}, err
+	}
+
+	return Get(id)
+}
+
+// Delete removes the account, its posts stay without account.
+func Delete(id int64) error {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM user WHERE user_id = ?", id)
+
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrNotFound
+	}
+
+	if err := checkOwnerLeft(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkOwnerLeft refuses the changes leaving nobody to manage the accounts.
+func checkOwnerLeft(tx *sql.Tx) error {
+	var owners int
+
+	err := tx.QueryRow("SELECT COUNT(*) FROM user WHERE role = ?", RoleOwner).Scan(&owners)
+
+	if err != nil {
+		return err
+	}
+
+	if owners == 0 {
+		return ErrLastOwner
+	}
+
+	return nil
+}
@@ -0,0 +1,321 @@
+package user
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"valette.software/internal/blog"
+	"valette.software/internal/database/databasetest"
+)
+
+// testParams keeps the hashes of the tests fast.
+var testParams = argon2Params{memory: 1024, time: 1, threads: 1}
+
+// openTestDatabase points the package to a freshly migrated database holding
+// the first owner, whose password is "first password".
+func openTestDatabase(t *testing.T) {
+	conn := databasetest.Open(t)
+
+	hashParams = testParams
+	db = conn
+
+	if err := createFirstOwner("first password"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pbkdf2Hash is a hash of the first accounts, before argon2id.
+func pbkdf2Hash(t *testing.T, password string) string {
+	salt := []byte("0123456789abcdef")
+	key, err := pbkdf2.Key(sha256.New, password, salt, 1000, keySize)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "pbkdf2-sha256$1000$" + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(key)
+}
+
+func TestPasswordHash(t *testing.T) {
+	hashParams = testParams
+	hash, err := HashPassword("correct horse")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") || !IsPasswordHash(hash) {
+		t.Errorf("expected an argon2id hash with the cost of the tests, got %q", hash)
+	}
+
+	hashParams = argon2Params{memory: 2048, time: 1, threads: 1}
+	stronger, _ := HashPassword("correct horse")
+	hashParams = testParams
+
+	type data struct {
+		hash     string
+		password string
+		valid    bool
+		rehash   bool
+		err      error
+	}
+
+	testData := []data{
+		{hash, "correct horse", true, false, nil},
+		{hash, "correct horse ", false, false, nil},
+		{hash, "", false, false, nil},
+		{stronger, "correct horse", true, true, nil},
+		{pbkdf2Hash(t, "correct horse"), "correct horse", true, true, nil},
+		{pbkdf2Hash(t, "correct horse"), "wrong horse", false, true, nil},
+		{"correct horse", "correct horse", false, false, errMalformedHash},
+		{"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5", "correct horse", false, false, errMalformedHash},
+		{"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5", "correct horse", false, false, errMalformedHash},
+		{"pbkdf2-sha256$0$c2FsdA$a2V5", "correct horse", false, true, errMalformedHash},
+	}
+
+	for _, test := range testData {
+		valid, rehash, err := checkPassword(test.hash, test.password)
+
+		if valid != test.valid || rehash != test.rehash || !errors.Is(err, test.err) {
+			t.Errorf("expected %v, %v and %v for %q with %q, got %v, %v and %v", test.valid, test.rehash, test.err, test.password, test.hash, valid, rehash, err)
+		}
+	}
+
+	other, _ := HashPassword("correct horse")
+
+	if other == hash {
+		t.Errorf("expected the hashes of a password to be salted, got %q twice", hash)
+	}
+}
+
+func TestRehash(t *testing.T) {
+	openTestDatabase(t)
+
+	_, err := db.Exec("UPDATE user SET password_hash = ? WHERE username = 'admin'", pbkdf2Hash(t, "first password"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storedHash := func() string {
+		var hash string
+
+		if err := db.QueryRow("SELECT password_hash FROM user WHERE username = 'admin'").Scan(&hash); err != nil {
+			t.Fatal(err)
+		}
+
+		return hash
+	}
+
+	if _, err := Authenticate("admin", "wrong password"); !errors.Is(err, ErrWrongCredentials) {
+		t.Fatalf("expected a wrong password to be refused, got %v", err)
+	}
+
+	if hash := storedHash(); !strings.HasPrefix(hash, "pbkdf2-sha256$") {
+		t.Errorf("expected a failed login to keep the hash, got %q", hash)
+	}
+
+	if _, err := Authenticate("admin", "first password"); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated := storedHash()
+
+	if !strings.HasPrefix(migrated, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("expected the login to replace the old hash, got %q", migrated)
+	}
+
+	if _, err := Authenticate("admin", "first password"); err != nil || storedHash() != migrated {
+		t.Errorf("expected a hash of the current cost to be kept, got %q, error: %v", storedHash(), err)
+	}
+
+	hashParams = argon2Params{memory: 2048, time: 2, threads: 1}
+	defer func() { hashParams = testParams }()
+
+	if _, err := Authenticate("admin", "first password"); err != nil {
+		t.Fatal(err)
+	}
+
+	if hash := storedHash(); !strings.HasPrefix(hash, "$argon2id$v=19$m=2048,t=2,p=1$") {
+		t.Errorf("expected the raised cost to rehash the password, got %q", hash)
+	}
+}
+
+func TestFirstOwnerHash(t *testing.T) {
+	hashParams = testParams
+	hash, _ := HashPassword("hashed password")
+
+	conn := databasetest.Open(t)
+	db = conn
+
+	if err := createFirstOwner(hash); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Authenticate("admin", "hashed password"); err != nil {
+		t.Errorf("expected the hash of the configuration to be stored as is, got %v", err)
+	}
+}
+
+func TestFirstOwnerShortPassword(t *testing.T) {
+	hashParams = testParams
+	db = databasetest.Open(t)
+
+	if err := createFirstOwner("admin"); !errors.Is(err, ErrPasswordTooShort) {
+		t.Errorf("expected a short password of the configuration to be refused, got %v", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	openTestDatabase(t)
+
+	// the first owner is only created once
+	if err := createFirstOwner("other password"); err != nil {
+		t.Fatal(err)
+	}
+
+	type data struct {
+		username string
+		password string
+		err      error
+	}
+
+	testData := []data{
+		{"admin", "first password", nil},
+		{" Admin", "first password", nil},
+		{"admin", "other password", ErrWrongCredentials},
+		{"nobody", "first password", ErrWrongCredentials},
+	}
+
+	for _, test := range testData {
+		user, err := Authenticate(test.username, test.password)
+
+		if !errors.Is(err, test.err) {
+			t.Errorf("expected %v for %q, got %v", test.err, test.username, err)
+		}
+
+		if err == nil && (user.Username != "admin" || user.Role != RoleOwner) {
+			t.Errorf("expected the first owner, got %+v", user)
+		}
+	}
+}
+
+func TestCreateUpdateDelete(t *testing.T) {
+	openTestDatabase(t)
+
+	type data struct {
+		username    string
+		displayName string
+		password    string
+		role        string
+		err         error
+	}
+
+	testData := []data{
+		{"alice", "Alice", "long password", RoleEditor, nil},
+		{"ALICE", "Alice", "long password", RoleEditor, ErrUsernameTaken},
+		{"bob smith", "Bob", "long password", RoleEditor, ErrInvalidUsername},
+		{"bob", " ", "long password", RoleEditor, ErrDisplayNameMissing},
+		{"bob", "Bob", "short", RoleEditor, ErrPasswordTooShort},
+		{"bob", "Bob", "long password", "admin", ErrInvalidRole},
+	}
+
+	for _, test := range testData {
+		_, err := Create(test.username, test.displayName, test.password, test.role)
+
+		if !errors.Is(err, test.err) {
+			t.Errorf("expected %v for %q, got %v", test.err, test.username, err)
+		}
+	}
+
+	users, err := List()
+
+	if err != nil || len(users) != 2 {
+		t.Fatalf("expected the owner and alice, got %+v, error: %v", users, err)
+	}
+
+	owner, alice := users[0], users[1]
+
+	if _, err := Update(owner.UserId, "Owner", RoleEditor, ""); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("expected the last owner to keep their role, got %v", err)
+	}
+
+	if err := Delete(owner.UserId); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("expected the last owner to stay, got %v", err)
+	}
+
+	alice, err = Update(alice.UserId, "Alice Liddell", RoleOwner, "new long password")
+
+	if err != nil || alice.DisplayName != "Alice Liddell" || alice.Role != RoleOwner {
+		t.Fatalf("expected alice to become an owner, got %+v, error: %v", alice, err)
+	}
+
+	if _, err := Authenticate("alice", "new long password"); err != nil {
+		t.Errorf("expected the new password to be accepted, got %v", err)
+	}
+
+	if err := Delete(owner.UserId); err != nil {
+		t.Errorf("expected an owner to be removed while another remains, got %v", err)
+	}
+
+	if _, err := Get(owner.UserId); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the removed user to be unknown, got %v", err)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	owner := User{UserId: 1, Role: RoleOwner}
+	editor := User{UserId: 2, Role: RoleEditor}
+	contributor := User{UserId: 3, Role: RoleContributor}
+
+	type data struct {
+		user User
+		role string
+		has  bool
+	}
+
+	roleData := []data{
+		{owner, RoleOwner, true},
+		{owner, RoleContributor, true},
+		{editor, RoleOwner, false},
+		{editor, RoleEditor, true},
+		{contributor, RoleEditor, false},
+		{contributor, RoleContributor, true},
+		{User{}, RoleContributor, false},
+	}
+
+	for _, test := range roleData {
+		if has := test.user.HasRole(test.role); has != test.has {
+			t.Errorf("expected %v for a %q user and the role %q, got %v", test.has, test.user.Role, test.role, has)
+		}
+	}
+
+	ownDraft := blog.Post{UserId: 3, Status: blog.StatusDraft}
+	ownPublished := blog.Post{UserId: 3, Status: blog.StatusPublished}
+	otherDraft := blog.Post{UserId: 2, Status: blog.StatusDraft}
+
+	type postData struct {
+		user User
+		post blog.Post
+		can  bool
+	}
+
+	postTestData := []postData{
+		{editor, otherDraft, true},
+		{editor, ownPublished, true},
+		{contributor, ownDraft, true},
+		{contributor, ownPublished, false},
+		{contributor, otherDraft, false},
+		{contributor, blog.Post{Status: blog.StatusDraft}, false},
+	}
+
+	for _, test := range postTestData {
+		if can := test.user.CanEditPost(test.post); can != test.can {
+			t.Errorf("expected %v for the %q user and %+v, got %v", test.can, test.user.Role, test.post, can)
+		}
+	}
+}
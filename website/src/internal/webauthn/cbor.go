@@ -0,0 +1,150 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var ErrInvalidCbor = errors.New("the CBOR data is not valid")
+
+// maxDepth bounds the nesting of the arrays and maps decoded, the data comes
+// from the browsers.
+const maxDepth = 8
+
+// decodeCbor reads the first item of data, the subset of CBOR the
+// authenticators write: integers, byte and text strings, arrays, maps and the
+// simple values. The integers are int64, the maps map[any]any. The bytes
+// after the item are returned as well.
+func decodeCbor(data []byte) (any, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (any, []byte, error) {
+	if len(data) == 0 || depth > maxDepth {
+		return nil, nil, ErrInvalidCbor
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		default:
+			return nil, nil, ErrInvalidCbor
+		}
+	}
+
+	argument, data, err := decodeArgument(info, data)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if argument > 1<<63-1 {
+			return nil, nil, ErrInvalidCbor
+		}
+
+		return int64(argument), data, nil
+	case 1:
+		if argument > 1<<63-1 {
+			return nil, nil, ErrInvalidCbor
+		}
+
+		return -1 - int64(argument), data, nil
+	case 2, 3:
+		if argument > uint64(len(data)) {
+			return nil, nil, ErrInvalidCbor
+		}
+
+		if major == 3 {
+			return string(data[:argument]), data[argument:], nil
+		}
+
+		return data[:argument:argument], data[argument:], nil
+	case 4:
+		// every item takes a byte at least
+		if argument > uint64(len(data)) {
+			return nil, nil, ErrInvalidCbor
+		}
+
+		items := make([]any, 0, argument)
+
+		for range argument {
+			var item any
+
+			item, data, err = decodeItem(data, depth+1)
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			items = append(items, item)
+		}
+
+		return items, data, nil
+	case 5:
+		if argument > uint64(len(data))/2 {
+			return nil, nil, ErrInvalidCbor
+		}
+
+		entries := make(map[any]any, argument)
+
+		for range argument {
+			var key, value any
+
+			key, data, err = decodeItem(data, depth+1)
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// the keys must be comparable
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, ErrInvalidCbor
+			}
+
+			value, data, err = decodeItem(data, depth+1)
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			entries[key] = value
+		}
+
+		return entries, data, nil
+	default:
+		// the tags aren't written by the authenticators
+		return nil, nil, ErrInvalidCbor
+	}
+}
+
+// decodeArgument reads the length or value following the first byte of an
+// item. The indefinite lengths aren't allowed by WebAuthn.
+func decodeArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	default:
+		return 0, nil, ErrInvalidCbor
+	}
+}
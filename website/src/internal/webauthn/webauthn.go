@@ -0,0 +1,388 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// Timeout is the time given to the browser to complete a ceremony.
+const Timeout = 5 * time.Minute
+
+// algES256 is the COSE algorithm of the keys accepted, ECDSA on P-256 with
+// SHA-256, which every authenticator supports.
+const algES256 = -7
+
+// the flags of the authenticator data
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+)
+
+var ErrInvalidResponse = errors.New("the passkey response is not valid")
+var ErrChallenge = errors.New("the passkey challenge is wrong or expired")
+var ErrOrigin = errors.New("the passkey was used from another site")
+var ErrUserNotVerified = errors.New("the passkey didn't verify the user")
+var ErrUnsupportedKey = errors.New("the passkey algorithm is not supported")
+var ErrSignature = errors.New("the passkey signature is not valid")
+var ErrSignCount = errors.New("the passkey signature counter went back, it may be cloned")
+
+// Encoding is the base64url of the binary values exchanged with the browser.
+var Encoding = base64.RawURLEncoding
+
+// RelyingParty is the site the passkeys are created for.
+type RelyingParty struct {
+	// Id is the domain of the site, the passkeys are bound to it.
+	Id     string
+	Name   string
+	Origin string
+}
+
+// NewRelyingParty returns the relying party of the site published at
+// baseUrl.
+func NewRelyingParty(baseUrl string) (RelyingParty, error) {
+	base, err := url.Parse(baseUrl)
+
+	if err != nil || base.Hostname() == "" {
+		return RelyingParty{}, errors.New("the base URL has no host: " + baseUrl)
+	}
+
+	return RelyingParty{Id: base.Hostname(), Name: base.Host, Origin: base.Scheme + "://" + base.Host}, nil
+}
+
+// Credential is a passkey registered, its public key is the uncompressed
+// point of P-256.
+type Credential struct {
+	Id        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+// NewChallenge returns a random challenge, in base64url.
+func NewChallenge() string {
+	challenge := make([]byte, 32)
+	rand.Read(challenge)
+
+	return Encoding.EncodeToString(challenge)
+}
+
+// CredentialDescriptor points to a passkey in the options, by its ID in
+// base64url.
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+// CredentialParameter is a type of key the site accepts, by its COSE
+// algorithm.
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// CreationOptions are the options of navigator.credentials.create, the
+// binary values are in base64url.
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	Rp        struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		Id          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+}
+
+// RequestOptions are the options of navigator.credentials.get. No
+// credential is allowed explicitly, the browser offers the passkeys of the
+// site.
+type RequestOptions struct {
+	Challenge        string `json:"challenge"`
+	RpId             string `json:"rpId"`
+	Timeout          int64  `json:"timeout"`
+	UserVerification string `json:"userVerification"`
+}
+
+// RegistrationResponse is the credential created by the browser, the binary
+// values are in base64url.
+type RegistrationResponse struct {
+	Id       string `json:"id"`
+	Response struct {
+		ClientDataJson    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the signature of the challenge by a passkey, the
+// binary values are in base64url.
+type AssertionResponse struct {
+	Id       string `json:"id"`
+	Response struct {
+		ClientDataJson    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// NewCreationOptions asks the browser for a passkey of the user, without
+// attestation. The user handle identifies the user in the authenticator,
+// the passkeys already registered are excluded.
+func NewCreationOptions(rp RelyingParty, challenge string, userHandle []byte, name string, displayName string, exclude [][]byte) CreationOptions {
+	options := CreationOptions{Challenge: challenge, Timeout: Timeout.Milliseconds(), Attestation: "none"}
+	options.Rp.Id = rp.Id
+	options.Rp.Name = rp.Name
+	options.User.Id = Encoding.EncodeToString(userHandle)
+	options.User.Name = name
+	options.User.DisplayName = displayName
+	options.PubKeyCredParams = []CredentialParameter{{Type: "public-key", Alg: algES256}}
+	options.ExcludeCredentials = []CredentialDescriptor{}
+	options.AuthenticatorSelection.ResidentKey = "required"
+	options.AuthenticatorSelection.UserVerification = "required"
+
+	for _, id := range exclude {
+		options.ExcludeCredentials = append(options.ExcludeCredentials, CredentialDescriptor{Type: "public-key", Id: Encoding.EncodeToString(id)})
+	}
+
+	return options
+}
+
+// NewRequestOptions asks the browser for a signature of the challenge.
+func NewRequestOptions(rp RelyingParty, challenge string) RequestOptions {
+	return RequestOptions{Challenge: challenge, RpId: rp.Id, Timeout: Timeout.Milliseconds(), UserVerification: "required"}
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// Challenge returns the challenge signed in the client data, to find the
+// one stored before verifying the response.
+func Challenge(clientDataJson string) (string, error) {
+	raw, err := Encoding.DecodeString(clientDataJson)
+
+	if err != nil {
+		return "", ErrInvalidResponse
+	}
+
+	data := clientData{}
+
+	if err := json.Unmarshal(raw, &data); err != nil || data.Challenge == "" {
+		return "", ErrInvalidResponse
+	}
+
+	return data.Challenge, nil
+}
+
+// verifyClientData checks the ceremony, challenge and origin the browser
+// signed, and returns the raw client data.
+func verifyClientData(rp RelyingParty, ceremony string, challenge string, encoded string) ([]byte, error) {
+	raw, err := Encoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	data := clientData{}
+
+	if err := json.Unmarshal(raw, &data); err != nil || data.Type != ceremony {
+		return nil, ErrInvalidResponse
+	}
+
+	if data.Challenge != challenge {
+		return nil, ErrChallenge
+	}
+
+	if data.Origin != rp.Origin {
+		return nil, ErrOrigin
+	}
+
+	return raw, nil
+}
+
+// authenticatorData is the fixed start of the data signed by the
+// authenticator, the attested credential follows when it is registered.
+type authenticatorData struct {
+	flags     byte
+	signCount uint32
+	rest      []byte
+}
+
+func parseAuthenticatorData(rp RelyingParty, raw []byte) (authenticatorData, error) {
+	if len(raw) < 37 {
+		return authenticatorData{}, ErrInvalidResponse
+	}
+
+	rpIdHash := sha256.Sum256([]byte(rp.Id))
+
+	if !bytes.Equal(raw[:32], rpIdHash[:]) {
+		return authenticatorData{}, ErrOrigin
+	}
+
+	data := authenticatorData{flags: raw[32], signCount: binary.BigEndian.Uint32(raw[33:37]), rest: raw[37:]}
+
+	// the passkeys replace the password and the second factor, the user must
+	// have unlocked them
+	if data.flags&flagUserPresent == 0 || data.flags&flagUserVerified == 0 {
+		return authenticatorData{}, ErrUserNotVerified
+	}
+
+	return data, nil
+}
+
+// VerifyRegistration checks the passkey created by the browser for the
+// challenge, and returns it. The attestation statement isn't checked, none
+// is asked: any authenticator is accepted.
+func VerifyRegistration(rp RelyingParty, challenge string, response RegistrationResponse) (Credential, error) {
+	if _, err := verifyClientData(rp, "webauthn.create", challenge, response.Response.ClientDataJson); err != nil {
+		return Credential{}, err
+	}
+
+	rawObject, err := Encoding.DecodeString(response.Response.AttestationObject)
+
+	if err != nil {
+		return Credential{}, ErrInvalidResponse
+	}
+
+	decoded, _, err := decodeCbor(rawObject)
+	object, ok := decoded.(map[any]any)
+
+	if err != nil || !ok {
+		return Credential{}, ErrInvalidResponse
+	}
+
+	rawData, ok := object["authData"].([]byte)
+
+	if !ok {
+		return Credential{}, ErrInvalidResponse
+	}
+
+	data, err := parseAuthenticatorData(rp, rawData)
+
+	if err != nil {
+		return Credential{}, err
+	}
+
+	// the AAGUID, then the length of the credential ID
+	if data.flags&flagAttestedCredential == 0 || len(data.rest) < 18 {
+		return Credential{}, ErrInvalidResponse
+	}
+
+	idLength := int(binary.BigEndian.Uint16(data.rest[16:18]))
+	rest := data.rest[18:]
+
+	if idLength == 0 || idLength > len(rest) {
+		return Credential{}, ErrInvalidResponse
+	}
+
+	credential := Credential{Id: bytes.Clone(rest[:idLength]), SignCount: data.signCount}
+
+	if response.Id != Encoding.EncodeToString(credential.Id) {
+		return Credential{}, ErrInvalidResponse
+	}
+
+	credential.PublicKey, err = parsePublicKey(rest[idLength:])
+
+	return credential, err
+}
+
+// parsePublicKey reads the COSE key of the credential registered.
+func parsePublicKey(raw []byte) ([]byte, error) {
+	decoded, _, err := decodeCbor(raw)
+	key, ok := decoded.(map[any]any)
+
+	if err != nil || !ok {
+		return nil, ErrInvalidResponse
+	}
+
+	// kty EC2, alg ES256, crv P-256
+	if key[int64(1)] != int64(2) || key[int64(3)] != int64(algES256) || key[int64(-1)] != int64(1) {
+		return nil, ErrUnsupportedKey
+	}
+
+	x, okX := key[int64(-2)].([]byte)
+	y, okY := key[int64(-3)].([]byte)
+
+	if !okX || !okY || len(x) != 32 || len(y) != 32 {
+		return nil, ErrInvalidResponse
+	}
+
+	point := append(append([]byte{4}, x...), y...)
+
+	// the point must be on the curve
+	if _, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point); err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	return point, nil
+}
+
+// VerifyAssertion checks the signature of the challenge by the credential,
+// and returns its new signature counter. A counter which doesn't increase
+// tells the passkey was cloned, except for the authenticators always
+// counting 0, as the synced passkeys.
+func VerifyAssertion(rp RelyingParty, challenge string, credential Credential, response AssertionResponse) (uint32, error) {
+	rawClientData, err := verifyClientData(rp, "webauthn.get", challenge, response.Response.ClientDataJson)
+
+	if err != nil {
+		return 0, err
+	}
+
+	rawData, err := Encoding.DecodeString(response.Response.AuthenticatorData)
+
+	if err != nil {
+		return 0, ErrInvalidResponse
+	}
+
+	data, err := parseAuthenticatorData(rp, rawData)
+
+	if err != nil {
+		return 0, err
+	}
+
+	signature, err := Encoding.DecodeString(response.Response.Signature)
+
+	if err != nil {
+		return 0, ErrInvalidResponse
+	}
+
+	publicKey, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), credential.PublicKey)
+
+	if err != nil {
+		return 0, ErrUnsupportedKey
+	}
+
+	clientDataHash := sha256.Sum256(rawClientData)
+	digest := sha256.Sum256(append(bytes.Clone(rawData), clientDataHash[:]...))
+
+	if !ecdsa.VerifyASN1(publicKey, digest[:], signature) {
+		return 0, ErrSignature
+	}
+
+	if (data.signCount != 0 || credential.SignCount != 0) && data.signCount <= credential.SignCount {
+		return 0, ErrSignCount
+	}
+
+	return data.signCount, nil
+}
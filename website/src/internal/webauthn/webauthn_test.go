@@ -0,0 +1,188 @@
+// the tests are outside of the package, the software authenticator uses it
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+
+	"valette.software/internal/webauthn"
+	"valette.software/internal/webauthn/webauthntest"
+)
+
+func testRelyingParty(t *testing.T) webauthn.RelyingParty {
+	rp, err := webauthn.NewRelyingParty("https://valette.software")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rp
+}
+
+func register(t *testing.T, rp webauthn.RelyingParty, authenticator *webauthntest.Authenticator) webauthn.Credential {
+	challenge := webauthn.NewChallenge()
+	response, err := authenticator.Register(webauthn.NewCreationOptions(rp, challenge, []byte{1}, "admin", "Admin", nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential, err := webauthn.VerifyRegistration(rp, challenge, response)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return credential
+}
+
+func TestRelyingParty(t *testing.T) {
+	type data struct {
+		baseUrl string
+		rp      webauthn.RelyingParty
+	}
+
+	testData := []data{
+		{"https://valette.software", webauthn.RelyingParty{Id: "valette.software", Name: "valette.software", Origin: "https://valette.software"}},
+		{"http://localhost:8080/", webauthn.RelyingParty{Id: "localhost", Name: "localhost:8080", Origin: "http://localhost:8080"}},
+	}
+
+	for _, test := range testData {
+		rp, err := webauthn.NewRelyingParty(test.baseUrl)
+
+		if err != nil || rp != test.rp {
+			t.Errorf("expected %+v for %q, got %+v, error: %v", test.rp, test.baseUrl, rp, err)
+		}
+	}
+
+	if _, err := webauthn.NewRelyingParty(""); err == nil {
+		t.Errorf("expected a base URL without host to be refused")
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	rp := testRelyingParty(t)
+
+	type data struct {
+		name          string
+		authenticator *webauthntest.Authenticator
+		challenge     string
+		tamper        func(*webauthn.RegistrationResponse)
+		err           error
+	}
+
+	challenge := webauthn.NewChallenge()
+	unverified := webauthntest.New(rp.Origin)
+	unverified.SkipUserVerification = true
+
+	testData := []data{
+		{"valid", webauthntest.New(rp.Origin), challenge, nil, nil},
+		{"other challenge", webauthntest.New(rp.Origin), webauthn.NewChallenge(), nil, webauthn.ErrChallenge},
+		{"phishing site", webauthntest.New("https://valette.software.example"), challenge, nil, webauthn.ErrOrigin},
+		{"user not verified", unverified, challenge, nil, webauthn.ErrUserNotVerified},
+		{"truncated object", webauthntest.New(rp.Origin), challenge, func(response *webauthn.RegistrationResponse) {
+			response.Response.AttestationObject = response.Response.AttestationObject[:40]
+		}, webauthn.ErrInvalidResponse},
+		{"other ID", webauthntest.New(rp.Origin), challenge, func(response *webauthn.RegistrationResponse) {
+			response.Id = "AAAA"
+		}, webauthn.ErrInvalidResponse},
+	}
+
+	for _, test := range testData {
+		response, err := test.authenticator.Register(webauthn.NewCreationOptions(rp, challenge, []byte{1}, "admin", "Admin", nil))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.tamper != nil {
+			test.tamper(&response)
+		}
+
+		credential, err := webauthn.VerifyRegistration(rp, test.challenge, response)
+
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+
+		if err == nil && (len(credential.PublicKey) != 65 || credential.SignCount != 1 || webauthn.Encoding.EncodeToString(credential.Id) != response.Id) {
+			t.Errorf("%s: expected the credential of the response, got %+v", test.name, credential)
+		}
+	}
+
+	authenticator := webauthntest.New(rp.Origin)
+	credential := register(t, rp, authenticator)
+	options := webauthn.NewCreationOptions(rp, challenge, []byte{1}, "admin", "Admin", [][]byte{credential.Id})
+
+	if _, err := authenticator.Register(options); !errors.Is(err, webauthntest.ErrExcluded) {
+		t.Errorf("expected the passkeys registered to be excluded, got %v", err)
+	}
+}
+
+func TestAssertion(t *testing.T) {
+	rp := testRelyingParty(t)
+	authenticator := webauthntest.New(rp.Origin)
+	credential := register(t, rp, authenticator)
+
+	challenge := webauthn.NewChallenge()
+	response, err := authenticator.Login(webauthn.NewRequestOptions(rp, challenge))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := webauthn.Challenge(response.Response.ClientDataJson); err != nil || got != challenge {
+		t.Errorf("expected the challenge %q in the client data, got %q, error: %v", challenge, got, err)
+	}
+
+	signCount, err := webauthn.VerifyAssertion(rp, challenge, credential, response)
+
+	if err != nil || signCount != 2 {
+		t.Fatalf("expected the signature to be valid with the counter 2, got %d, error: %v", signCount, err)
+	}
+
+	if _, err := webauthn.VerifyAssertion(rp, webauthn.NewChallenge(), credential, response); !errors.Is(err, webauthn.ErrChallenge) {
+		t.Errorf("expected the signature of another challenge to be refused, got %v", err)
+	}
+
+	other := register(t, rp, webauthntest.New(rp.Origin))
+	other.SignCount = 0
+
+	if _, err := webauthn.VerifyAssertion(rp, challenge, other, response); !errors.Is(err, webauthn.ErrSignature) {
+		t.Errorf("expected the signature of another key to be refused, got %v", err)
+	}
+
+	tampered := response
+	tampered.Response.AuthenticatorData = response.Response.AuthenticatorData[:len(response.Response.AuthenticatorData)-1] + "A"
+
+	if _, err := webauthn.VerifyAssertion(rp, challenge, credential, tampered); err == nil {
+		t.Errorf("expected the authenticator data changed to be refused")
+	}
+
+	// the stored counter is ahead, the passkey was used from a clone
+	credential.SignCount = signCount
+
+	if _, err := webauthn.VerifyAssertion(rp, challenge, credential, response); !errors.Is(err, webauthn.ErrSignCount) {
+		t.Errorf("expected a counter going back to be refused, got %v", err)
+	}
+}
+
+func TestSyncedPasskey(t *testing.T) {
+	rp := testRelyingParty(t)
+	authenticator := webauthntest.New(rp.Origin)
+	authenticator.Counting = false
+	credential := register(t, rp, authenticator)
+
+	for range 2 {
+		challenge := webauthn.NewChallenge()
+		response, err := authenticator.Login(webauthn.NewRequestOptions(rp, challenge))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := webauthn.VerifyAssertion(rp, challenge, credential, response); err != nil {
+			t.Errorf("expected the passkeys without counter to be accepted, got %v", err)
+		}
+	}
+}
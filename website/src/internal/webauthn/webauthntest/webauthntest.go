@@ -0,0 +1,249 @@
+// Package webauthntest plays the browser and the authenticator of the
+// passkeys in the tests, with keys generated in memory.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+
+	"valette.software/internal/webauthn"
+)
+
+var ErrNoCredential = errors.New("the authenticator has no passkey for the site")
+var ErrExcluded = errors.New("the authenticator already has a passkey of the user")
+
+// Authenticator keeps passkeys, as a phone or a security key would.
+type Authenticator struct {
+	// Origin is the site the browser shows, it signs it in the client data.
+	Origin string
+	// Counting authenticators increase the signature counter on every use,
+	// the synced passkeys always send 0.
+	Counting bool
+	// SkipUserVerification signs without the PIN or the fingerprint.
+	SkipUserVerification bool
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	key        *ecdsa.PrivateKey
+	rpId       string
+	userHandle []byte
+	signCount  uint32
+}
+
+// New returns an authenticator without passkey, used from origin.
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, Counting: true}
+}
+
+// Clone copies the authenticator with its keys and counters, as an attacker
+// who extracted them would.
+func (authenticator *Authenticator) Clone() *Authenticator {
+	clone := *authenticator
+	clone.credentials = nil
+
+	for _, cred := range authenticator.credentials {
+		copied := *cred
+		clone.credentials = append(clone.credentials, &copied)
+	}
+
+	return &clone
+}
+
+func (authenticator *Authenticator) clientData(ceremony string, challenge string) []byte {
+	data, _ := json.Marshal(map[string]any{"type": ceremony, "challenge": challenge, "origin": authenticator.Origin, "crossOrigin": false})
+
+	return data
+}
+
+func (authenticator *Authenticator) authenticatorData(cred *credential, attested []byte) []byte {
+	flags := byte(0x01)
+
+	if !authenticator.SkipUserVerification {
+		flags |= 0x04
+	}
+
+	if attested != nil {
+		flags |= 0x40
+	}
+
+	if authenticator.Counting {
+		cred.signCount++
+	}
+
+	rpIdHash := sha256.Sum256([]byte(cred.rpId))
+	data := append(rpIdHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, cred.signCount)
+
+	return append(data, attested...)
+}
+
+// Register creates a passkey from the options of
+// navigator.credentials.create, and returns the response of the browser.
+func (authenticator *Authenticator) Register(options webauthn.CreationOptions) (webauthn.RegistrationResponse, error) {
+	for _, excluded := range options.ExcludeCredentials {
+		for _, cred := range authenticator.credentials {
+			if webauthn.Encoding.EncodeToString(cred.id) == excluded.Id {
+				return webauthn.RegistrationResponse{}, ErrExcluded
+			}
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return webauthn.RegistrationResponse{}, err
+	}
+
+	userHandle, err := webauthn.Encoding.DecodeString(options.User.Id)
+
+	if err != nil {
+		return webauthn.RegistrationResponse{}, err
+	}
+
+	cred := &credential{id: make([]byte, 16), key: key, rpId: options.Rp.Id, userHandle: userHandle}
+	rand.Read(cred.id)
+
+	point, err := key.PublicKey.Bytes()
+
+	if err != nil {
+		return webauthn.RegistrationResponse{}, err
+	}
+
+	// the COSE key: kty EC2, alg ES256, crv P-256, x and y
+	publicKey := encodeCbor(map[int]any{1: 2, 3: -7, -1: 1, -2: point[1:33], -3: point[33:]})
+
+	// an empty AAGUID, the length of the ID, the ID and the key
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(cred.id)))
+	attested = append(append(attested, cred.id...), publicKey...)
+
+	object := encodeCbor(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authenticator.authenticatorData(cred, attested),
+	})
+
+	authenticator.credentials = append(authenticator.credentials, cred)
+
+	response := webauthn.RegistrationResponse{Id: webauthn.Encoding.EncodeToString(cred.id)}
+	response.Response.ClientDataJson = webauthn.Encoding.EncodeToString(authenticator.clientData("webauthn.create", options.Challenge))
+	response.Response.AttestationObject = webauthn.Encoding.EncodeToString(object)
+
+	return response, nil
+}
+
+// Login signs the challenge of the options of navigator.credentials.get with
+// the last passkey created for the site, and returns the response of the
+// browser.
+func (authenticator *Authenticator) Login(options webauthn.RequestOptions) (webauthn.AssertionResponse, error) {
+	var cred *credential
+
+	for _, candidate := range authenticator.credentials {
+		if candidate.rpId == options.RpId {
+			cred = candidate
+		}
+	}
+
+	if cred == nil {
+		return webauthn.AssertionResponse{}, ErrNoCredential
+	}
+
+	clientData := authenticator.clientData("webauthn.get", options.Challenge)
+	data := authenticator.authenticatorData(cred, nil)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(data, clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+
+	if err != nil {
+		return webauthn.AssertionResponse{}, err
+	}
+
+	response := webauthn.AssertionResponse{Id: webauthn.Encoding.EncodeToString(cred.id)}
+	response.Response.ClientDataJson = webauthn.Encoding.EncodeToString(clientData)
+	response.Response.AuthenticatorData = webauthn.Encoding.EncodeToString(data)
+	response.Response.Signature = webauthn.Encoding.EncodeToString(signature)
+	response.Response.UserHandle = webauthn.Encoding.EncodeToString(cred.userHandle)
+
+	return response, nil
+}
+
+// encodeCbor writes the values the authenticators send: integers, byte and
+// text strings and maps, whose keys are sorted.
+func encodeCbor(value any) []byte {
+	switch value := value.(type) {
+	case int:
+		if value < 0 {
+			return cborHead(1, uint64(-1-value))
+		}
+
+		return cborHead(0, uint64(value))
+	case []byte:
+		return append(cborHead(2, uint64(len(value))), value...)
+	case string:
+		return append(cborHead(3, uint64(len(value))), value...)
+	case map[int]any:
+		keys := slices.Collect(maps.Keys(value))
+		// the canonical order: the positive keys first, then the shortest
+		sort.Slice(keys, func(i, j int) bool {
+			if (keys[i] < 0) != (keys[j] < 0) {
+				return keys[i] >= 0
+			}
+
+			return abs(keys[i]) < abs(keys[j])
+		})
+
+		encoded := cborHead(5, uint64(len(value)))
+
+		for _, key := range keys {
+			encoded = append(encoded, encodeCbor(key)...)
+			encoded = append(encoded, encodeCbor(value[key])...)
+		}
+
+		return encoded
+	case map[string]any:
+		keys := slices.Sorted(maps.Keys(value))
+		encoded := cborHead(5, uint64(len(value)))
+
+		for _, key := range keys {
+			encoded = append(encoded, encodeCbor(key)...)
+			encoded = append(encoded, encodeCbor(value[key])...)
+		}
+
+		return encoded
+	default:
+		panic("webauthntest: can't encode the value in CBOR")
+	}
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+
+	return value
+}
+
+func cborHead(major byte, argument uint64) []byte {
+	switch {
+	case argument < 24:
+		return []byte{major<<5 | byte(argument)}
+	case argument <= 0xff:
+		return []byte{major<<5 | 24, byte(argument)}
+	case argument <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(argument))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(argument))
+	}
+}
@@ -0,0 +1,46 @@
+package webmention
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var errLocalAddress = errors.New("the local network can't be reached")
+
+// NewClient returns the client reaching the other sites. The senders choose
+// the sources, the client refuses to connect to the local network.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network string, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+
+			if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return errLocalAddress
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return http.ErrUseLastResponse
+			}
+
+			return nil
+		},
+	}
+}
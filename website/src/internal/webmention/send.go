@@ -0,0 +1,305 @@
+package webmention
+
+import (
+	"errors"
+	"html"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"valette.software/internal/blog"
+)
+
+// retryDelay is the time before a target which couldn't be reached is tried
+// again, at a later change of the post.
+const retryDelay = 24 * time.Hour
+
+// sendSignals wakes the sending up after a post changed.
+var sendSignals = make(chan struct{}, 1)
+
+// changedPosts are the IDs of the posts changed since the last sending.
+var changedPosts = map[int64]bool{}
+var changedMutex sync.Mutex
+
+var linkElement = regexp.MustCompile(`(?is)<(?:link|a)\b[^>]*>`)
+var relAttribute = regexp.MustCompile(`(?i)\brel\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+var linkHeader = regexp.MustCompile(`<([^>]*)>\s*;[^,]*\brel\s*=\s*"?([^",]*)"?`)
+
+func requestSending(postId int64) {
+	changedMutex.Lock()
+	changedPosts[postId] = true
+	changedMutex.Unlock()
+
+	select {
+	case sendSignals <- struct{}{}:
+	default:
+		// a sending is already requested
+	}
+}
+
+// sendLoop sends the mentions of the posts after they change, and of the
+// scheduled posts when they get published. The posts left alone are not
+// sent again, the server can restart without notifying the whole archive.
+func sendLoop() {
+	since := time.Now().Unix()
+
+	for {
+		wait := time.Duration(math.MaxInt64)
+
+		if next, err := blog.NextPublication(); err == nil && next != 0 {
+			wait = time.Until(time.Unix(next, 0))
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-sendSignals:
+		case <-timer.C:
+		}
+
+		timer.Stop()
+
+		until := time.Now().Unix()
+		sendPublished(since, until)
+		since = until
+
+		sendChanged()
+	}
+}
+
+// sendPublished sends the mentions of the scheduled posts published between
+// since and until, nothing notifies their publication.
+func sendPublished(since int64, until int64) {
+	posts, err := blog.ListAllPosts()
+
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	for _, post := range posts {
+		if post.Status == blog.StatusScheduled && post.PublishAt > since && post.PublishAt <= until && post.IsVisible() {
+			sendMentions(post)
+		}
+	}
+}
+
+// sendChanged sends the mentions of the posts changed, unless they are
+// hidden or deleted.
+func sendChanged() {
+	changedMutex.Lock()
+	postIds := changedPosts
+	changedPosts = map[int64]bool{}
+	changedMutex.Unlock()
+
+	for postId := range postIds {
+		post, err := blog.GetPostById(postId)
+
+		if errors.Is(err, blog.ErrNotFound) {
+			continue
+		} else if err != nil {
+			log.Print(err)
+			continue
+		}
+
+		if post.IsVisible() {
+			sendMentions(post)
+		}
+	}
+}
+
+// sendMentions notifies the sites linked by the post, once for each link and
+// address of the post. The sites accepting no mention are recorded as well.
+// The sites which couldn't be reached are tried again at a change of the
+// post, a day later at the earliest.
+func sendMentions(post blog.RenderedPost) {
+	source := baseUrl + "/" + post.Language + "/articles/" + post.Slug
+	sent := map[string]bool{}
+	retryBefore := time.Now().Add(-retryDelay).Unix()
+
+	rows, err := db.Query("SELECT target, source, reached, sent_at FROM webmention_sent WHERE post_id = ?", post.ArticleId)
+
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	for rows.Next() {
+		var target, sentFrom string
+		var reached bool
+		var sentAt int64
+
+		if err := rows.Scan(&target, &sentFrom, &reached, &sentAt); err != nil {
+			continue
+		}
+
+		// the rows recorded before the addresses were have no source
+		if sentFrom == source || sentFrom == "" {
+			sent[target] = reached || sentAt > retryBefore
+		}
+	}
+
+	rows.Close()
+
+	for _, target := range externalLinks(string(post.Html)) {
+		if sent[target] {
+			continue
+		}
+
+		endpoint, result, err := send(source, target)
+		reached := err == nil
+
+		if err != nil {
+			log.Print(err)
+			result = err.Error()
+		}
+
+		_, err = db.Exec(
+			"INSERT INTO webmention_sent (post_id, target, source, endpoint, result, reached, sent_at) VALUES (?, ?, ?, ?, ?, ?, ?) "+
+				"ON CONFLICT (post_id, target) DO UPDATE SET source = excluded.source, endpoint = excluded.endpoint, "+
+				"result = excluded.result, reached = excluded.reached, sent_at = excluded.sent_at",
+			post.ArticleId, target, source, endpoint, result, reached, time.Now().Unix(),
+		)
+
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// send notifies target that source links to it, it returns the endpoint of
+// the target and the answer of the endpoint. It fails if the target or its
+// endpoint can't be reached.
+func send(source string, target string) (string, string, error) {
+	endpoint, err := discoverEndpoint(target)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if endpoint == "" {
+		return "", "no endpoint", nil
+	}
+
+	form := url.Values{"source": {source}, "target": {target}}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return endpoint, err.Error(), nil
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	res.Body.Close()
+
+	return endpoint, res.Status, nil
+}
+
+// discoverEndpoint finds the webmention endpoint of target in its Link
+// headers, then in its link and a elements. It returns an empty string if
+// the target accepts no mention.
+func discoverEndpoint(target string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+
+	// the relative endpoints are relative to the page after the redirections
+	page := res.Request.URL
+
+	for _, header := range res.Header.Values("Link") {
+		for _, match := range linkHeader.FindAllStringSubmatch(header, -1) {
+			if hasRel(match[2], "webmention") {
+				return resolveEndpoint(page, match[1]), nil
+			}
+		}
+	}
+
+	if !strings.Contains(res.Header.Get("Content-Type"), "html") {
+		return "", nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxPageSize))
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, element := range linkElement.FindAllString(string(body), -1) {
+		rel := relAttribute.FindStringSubmatch(element)
+		href := hrefAttribute.FindStringSubmatch(element)
+
+		if rel != nil && href != nil && hasRel(rel[1]+rel[2]+rel[3], "webmention") {
+			return resolveEndpoint(page, href[1]+href[2]+href[3]), nil
+		}
+	}
+
+	return "", nil
+}
+
+func hasRel(rels string, rel string) bool {
+	for _, value := range strings.Fields(rels) {
+		if strings.EqualFold(value, rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveEndpoint returns the absolute URL of the endpoint, an empty href is
+// the page itself.
+func resolveEndpoint(page *url.URL, href string) string {
+	endpoint, err := page.Parse(html.UnescapeString(href))
+
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return ""
+	}
+
+	return endpoint.String()
+}
+
+// externalLinks returns the links of the rendered post leading to other
+// sites.
+func externalLinks(postHtml string) []string {
+	seen := map[string]bool{}
+	var links []string
+
+	for _, match := range hrefAttribute.FindAllStringSubmatch(postHtml, -1) {
+		link := html.UnescapeString(match[1] + match[2] + match[3])
+		link, _, _ = strings.Cut(link, "#")
+
+		if !isWebUrl(link) || strings.HasPrefix(link, baseUrl+"/") || link == baseUrl || seen[link] {
+			continue
+		}
+
+		seen[link] = true
+		links = append(links, link)
+	}
+
+	return links
+}
@@ -0,0 +1,172 @@
+package webmention
+
+import (
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxPageSize is the number of bytes read from the pages of other sites.
+const maxPageSize = 1 << 20
+
+const userAgent = "valette.software webmention"
+
+// verifications holds the IDs of the mentions to verify, in the order they
+// were received.
+var verifications = make(chan int64, 100)
+
+var hrefAttribute = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+var titleElement = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+func queueVerification(id int64) {
+	select {
+	case verifications <- id:
+	default:
+		// the mention stays unverified, it is queued again at the next start
+		log.Printf("the verification queue is full, webmention %d waits", id)
+	}
+}
+
+// requeueUnverified queues the mentions received before the server stopped.
+func requeueUnverified() {
+	rows, err := db.Query("SELECT webmention_id FROM webmention WHERE status = ?", StatusUnverified)
+
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	rows.Close()
+
+	for _, id := range ids {
+		queueVerification(id)
+	}
+}
+
+func verifyLoop() {
+	for id := range verifications {
+		err := verify(id)
+
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// verify fetches the source of the mention and checks it links to the
+// target. A source gone for good takes its mention with it.
+func verify(id int64) error {
+	mention, err := Get(id)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, mention.Source, nil)
+
+	if err != nil {
+		return setVerified(id, StatusInvalid, "")
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		log.Print(err)
+		return setVerified(id, StatusInvalid, "")
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusGone {
+		return Delete(id)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return setVerified(id, StatusInvalid, "")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxPageSize))
+
+	if err != nil {
+		return setVerified(id, StatusInvalid, "")
+	}
+
+	page := string(body)
+
+	if !linksTo(page, res.Header.Get("Content-Type"), mention.Target) {
+		return setVerified(id, StatusInvalid, "")
+	}
+
+	return setVerified(id, StatusPending, findTitle(page))
+}
+
+// setVerified records the result of the verification. The mentions already
+// moderated keep their status as long as the source links to the target.
+func setVerified(id int64, status string, title string) error {
+	_, err := db.Exec(
+		"UPDATE webmention SET status = CASE WHEN ? = ? AND status IN (?, ?) THEN status ELSE ? END, title = ?, verified_at = ? WHERE webmention_id = ?",
+		status, StatusPending, StatusApproved, StatusSpam, status, title, time.Now().Unix(), id,
+	)
+
+	return err
+}
+
+// linksTo tells whether the page links to target, the pages which aren't
+// HTML only have to contain it.
+func linksTo(page string, contentType string, target string) bool {
+	if !strings.Contains(contentType, "html") {
+		return strings.Contains(page, target)
+	}
+
+	for _, match := range hrefAttribute.FindAllStringSubmatch(page, -1) {
+		href := html.UnescapeString(match[1] + match[2] + match[3])
+
+		if sameUrl(href, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sameUrl(a string, b string) bool {
+	normalize := func(value string) string {
+		value, _, _ = strings.Cut(value, "#")
+
+		return strings.TrimSuffix(value, "/")
+	}
+
+	return normalize(a) == normalize(b)
+}
+
+func findTitle(page string) string {
+	match := titleElement.FindStringSubmatch(page)
+
+	if match == nil {
+		return ""
+	}
+
+	title := strings.Join(strings.Fields(html.UnescapeString(match[1])), " ")
+
+	if len([]rune(title)) > 200 {
+		title = string([]rune(title)[:200]) + "…"
+	}
+
+	return title
+}
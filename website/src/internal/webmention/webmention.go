@@ -0,0 +1,267 @@
+package webmention
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"valette.software/internal/blog"
+	"valette.software/internal/database"
+)
+
+const (
+	// StatusUnverified is given to the mentions received, until the source
+	// is fetched.
+	StatusUnverified = "unverified"
+	// StatusInvalid mentions have a source which doesn't link to the target.
+	StatusInvalid  = "invalid"
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusSpam     = "spam"
+)
+
+var ErrNotFound = errors.New("webmention not found")
+var ErrInvalidUrl = errors.New("the source and the target must be http or https URLs")
+var ErrSameUrl = errors.New("the source and the target must be different")
+var ErrUnknownTarget = errors.New("the target is not an article of this site")
+var ErrInvalidStatus = errors.New("unknown webmention status")
+
+const mentionColumns = "webmention.webmention_id, webmention.post_id, webmention.source, webmention.target, webmention.title, webmention.status, webmention.created_at, webmention.verified_at, post.title"
+
+const mentionTables = "webmention JOIN post ON post.post_id = webmention.post_id"
+
+var db *sql.DB
+var baseUrl string
+var client *http.Client
+
+// findPost returns the ID of the public post published in lang under slug,
+// it is replaced in the tests.
+var findPost = func(lang string, slug string) (int64, error) {
+	post, err := blog.GetPostBySlug(lang, slug, false)
+
+	return post.ArticleId, err
+}
+
+// Mention tells that the page at Source links to the article at Target.
+type Mention struct {
+	WebmentionId int64
+	PostId       int64
+	Source       string
+	Target       string
+	Title        string
+	Status       string
+	CreatedAt    int64
+	VerifiedAt   int64
+	PostTitle    string
+}
+
+// Init prepares the mentions of the site published at siteUrl, the other
+// sites are reached with httpClient.
+func Init(siteUrl string, httpClient *http.Client) {
+	db = database.Get()
+	baseUrl = siteUrl
+	client = httpClient
+}
+
+// Start verifies the mentions received and sends the mentions of the
+// articles in the background, for as long as the server runs.
+func Start() {
+	go verifyLoop()
+	go sendLoop()
+
+	blog.OnChange(requestSending)
+	requeueUnverified()
+}
+
+// Name is the title of the source page, or its host when it has none.
+func (mention Mention) Name() string {
+	if mention.Title != "" {
+		return mention.Title
+	}
+
+	if source, err := url.Parse(mention.Source); err == nil {
+		return source.Host
+	}
+
+	return mention.Source
+}
+
+// DateIso is the reception date in the format of the datetime attributes.
+func (mention Mention) DateIso() string {
+	return time.Unix(mention.CreatedAt, 0).UTC().Format(time.RFC3339)
+}
+
+// DateHuman is the reception date shown next to the mention.
+func (mention Mention) DateHuman() string {
+	return time.Unix(mention.CreatedAt, 0).UTC().Format("2006-01-02")
+}
+
+func scanMention(row interface{ Scan(...any) error }) (Mention, error) {
+	mention := Mention{}
+
+	err := row.Scan(&mention.WebmentionId, &mention.PostId, &mention.Source, &mention.Target, &mention.Title, &mention.Status, &mention.CreatedAt, &mention.VerifiedAt, &mention.PostTitle)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return Mention{}, ErrNotFound
+	} else if err != nil {
+		log.Print(err)
+		return Mention{}, err
+	}
+
+	return mention, nil
+}
+
+// Receive records that source links to target and queues its verification.
+// A mention received again is verified again, the source may have removed
+// the link.
+func Receive(source string, target string) (Mention, error) {
+	if !isWebUrl(source) || !isWebUrl(target) {
+		return Mention{}, ErrInvalidUrl
+	}
+
+	if source == target {
+		return Mention{}, ErrSameUrl
+	}
+
+	postId, err := findTarget(target)
+
+	if err != nil {
+		return Mention{}, err
+	}
+
+	var id int64
+
+	err = db.QueryRow(
+		"INSERT INTO webmention (post_id, source, target, status, created_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT (source, target) DO UPDATE SET post_id = excluded.post_id RETURNING webmention_id",
+		postId, source, target, StatusUnverified, time.Now().Unix(),
+	).Scan(&id)
+
+	if err != nil {
+		log.Print(err)
+		return Mention{}, err
+	}
+
+	queueVerification(id)
+
+	return Get(id)
+}
+
+// findTarget returns the ID of the article at target, which must be public.
+func findTarget(target string) (int64, error) {
+	path, found := strings.CutPrefix(target, baseUrl+"/")
+
+	if !found {
+		return 0, ErrUnknownTarget
+	}
+
+	path, _, _ = strings.Cut(path, "#")
+	path, _, _ = strings.Cut(path, "?")
+
+	lang := "fr"
+	fragments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+
+	if len(fragments) == 3 && (fragments[0] == "fr" || fragments[0] == "en") {
+		lang = fragments[0]
+		fragments = fragments[1:]
+	}
+
+	if len(fragments) != 2 || fragments[0] != "articles" || fragments[1] == "" {
+		return 0, ErrUnknownTarget
+	}
+
+	postId, err := findPost(lang, fragments[1])
+
+	if errors.Is(err, blog.ErrNotFound) {
+		return 0, ErrUnknownTarget
+	}
+
+	return postId, err
+}
+
+func isWebUrl(value string) bool {
+	parsed, err := url.Parse(value)
+
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// Get returns the mention with the title of the article it mentions.
+func Get(id int64) (Mention, error) {
+	return scanMention(db.QueryRow("SELECT "+mentionColumns+" FROM "+mentionTables+" WHERE webmention_id = ?", id))
+}
+
+// ListApproved returns the approved mentions of the article, oldest first.
+func ListApproved(postId int64) ([]Mention, error) {
+	return listMentions("webmention.post_id = ? AND webmention.status = ? ORDER BY webmention.created_at", postId, StatusApproved)
+}
+
+// ListByStatus returns the mentions with the status, the newest first, for
+// the moderation queue.
+func ListByStatus(status string) ([]Mention, error) {
+	return listMentions("webmention.status = ? ORDER BY webmention.created_at DESC, webmention.webmention_id DESC", status)
+}
+
+func listMentions(condition string, args ...any) ([]Mention, error) {
+	rows, err := db.Query("SELECT "+mentionColumns+" FROM "+mentionTables+" WHERE "+condition, args...)
+
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var mentions []Mention
+
+	for rows.Next() {
+		mention, err := scanMention(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		mentions = append(mentions, mention)
+	}
+
+	return mentions, rows.Err()
+}
+
+// SetStatus approves a verified mention or marks it as spam.
+func SetStatus(id int64, status string) (Mention, error) {
+	if status != StatusPending && status != StatusApproved && status != StatusSpam {
+		return Mention{}, ErrInvalidStatus
+	}
+
+	result, err := db.Exec("UPDATE webmention SET status = ? WHERE webmention_id = ?", status, id)
+
+	if err != nil {
+		log.Print(err)
+		return Mention{}, err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return Mention{}, ErrNotFound
+	}
+
+	return Get(id)
+}
+
+// Delete removes the mention, it is recorded again if the source sends it
+// again.
+func Delete(id int64) error {
+	result, err := db.Exec("DELETE FROM webmention WHERE webmention_id = ?", id)
+
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
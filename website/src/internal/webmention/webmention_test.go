@@ -0,0 +1,250 @@
+package webmention
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"valette.software/internal/blog"
+	"valette.software/internal/database/databasetest"
+)
+
+// openTestDatabase points the package to a freshly migrated database holding
+// one post, published at https://valette.software/en/articles/title.
+func openTestDatabase(t *testing.T, httpClient *http.Client) int64 {
+	conn := databasetest.Open(t)
+
+	db = conn
+	baseUrl = "https://valette.software"
+	client = httpClient
+
+	result, err := db.Exec("INSERT INTO post (title, language, author, timestamp, slug, summary, content) VALUES ('Title', 'en', 'Author', 0, 'title', '', '')")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postId, _ := result.LastInsertId()
+
+	findPost = func(lang string, slug string) (int64, error) {
+		if slug != "title" {
+			return 0, blog.ErrNotFound
+		}
+
+		return postId, nil
+	}
+
+	return postId
+}
+
+func TestReceive(t *testing.T) {
+	openTestDatabase(t, http.DefaultClient)
+
+	type data struct {
+		source string
+		target string
+		err    error
+	}
+
+	testData := []data{
+		{"https://example.com/post", "https://valette.software/en/articles/title", nil},
+		{"https://example.com/post", "https://valette.software/articles/title#comments", nil},
+		{"ftp://example.com/post", "https://valette.software/en/articles/title", ErrInvalidUrl},
+		{"https://example.com/post", "javascript:alert(1)", ErrInvalidUrl},
+		{"https://valette.software/en/articles/title", "https://valette.software/en/articles/title", ErrSameUrl},
+		{"https://example.com/post", "https://example.com/en/articles/title", ErrUnknownTarget},
+		{"https://example.com/post", "https://valette.software/en/agenda", ErrUnknownTarget},
+		{"https://example.com/post", "https://valette.software/en/articles/missing", ErrUnknownTarget},
+	}
+
+	for _, test := range testData {
+		mention, err := Receive(test.source, test.target)
+
+		if !errors.Is(err, test.err) {
+			t.Errorf("expected %v for %s, got %v", test.err, test.target, err)
+		}
+
+		if err == nil && mention.Status != StatusUnverified {
+			t.Errorf("expected the mention to wait for its verification, got %s", mention.Status)
+		}
+	}
+
+	first, _ := Receive("https://example.com/post", "https://valette.software/en/articles/title")
+	again, _ := Receive("https://example.com/post", "https://valette.software/en/articles/title")
+
+	if first.WebmentionId != again.WebmentionId {
+		t.Errorf("expected a mention received again to be updated, got %d and %d", first.WebmentionId, again.WebmentionId)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	target := "https://valette.software/en/articles/title"
+
+	sources := http.NewServeMux()
+	sources.HandleFunc("/linking", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/html")
+		res.Write([]byte(`<title>A &amp; B</title><p>Read <a class="u-in-reply-to" href="` + target + `/">this</a></p>`))
+	})
+	sources.HandleFunc("/unrelated", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/html")
+		res.Write([]byte(`<p>` + target + ` isn't linked</p>`))
+	})
+	sources.HandleFunc("/gone", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusGone)
+	})
+
+	server := httptest.NewServer(sources)
+	defer server.Close()
+
+	openTestDatabase(t, server.Client())
+
+	type data struct {
+		source string
+		status string
+		title  string
+	}
+
+	testData := []data{
+		{"/linking", StatusPending, "A & B"},
+		{"/unrelated", StatusInvalid, ""},
+		{"/missing", StatusInvalid, ""},
+	}
+
+	for _, test := range testData {
+		mention, err := Receive(server.URL+test.source, target)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := verify(mention.WebmentionId); err != nil {
+			t.Fatal(err)
+		}
+
+		verified, _ := Get(mention.WebmentionId)
+
+		if verified.Status != test.status || verified.Title != test.title {
+			t.Errorf("expected %s to be %s titled %q, got %s titled %q", test.source, test.status, test.title, verified.Status, verified.Title)
+		}
+	}
+
+	approved, _ := Receive(server.URL+"/linking", target)
+	SetStatus(approved.WebmentionId, StatusApproved)
+	verify(approved.WebmentionId)
+
+	if mentions, _ := ListApproved(approved.PostId); len(mentions) != 1 {
+		t.Errorf("expected an approved mention to stay approved, got %+v", mentions)
+	}
+
+	gone, _ := Receive(server.URL+"/gone", target)
+
+	if err := verify(gone.WebmentionId); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Get(gone.WebmentionId); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the mention of a deleted source to be removed, got %v", err)
+	}
+}
+
+func TestSendMentions(t *testing.T) {
+	received := map[string]string{}
+	receivedMutex := sync.Mutex{}
+
+	sites := http.NewServeMux()
+	sites.HandleFunc("/header", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Link", `</endpoint?from=header>; rel="webmention"`)
+	})
+	sites.HandleFunc("/element", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/html")
+		res.Write([]byte(`<link rel="stylesheet" href="/style.css"><link rel="webmention" href="endpoint?from=element">`))
+	})
+	sites.HandleFunc("/none", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/html")
+		res.Write([]byte(`<a href="/endpoint">no mention</a>`))
+	})
+	sites.HandleFunc("POST /endpoint", func(res http.ResponseWriter, req *http.Request) {
+		receivedMutex.Lock()
+		defer receivedMutex.Unlock()
+
+		received[req.FormValue("target")] = req.FormValue("source") + " " + req.URL.Query().Get("from")
+		res.WriteHeader(http.StatusAccepted)
+	})
+
+	server := httptest.NewServer(sites)
+	defer server.Close()
+
+	postId := openTestDatabase(t, server.Client())
+
+	post := blog.RenderedPost{
+		Post: blog.Post{ArticleId: postId, Language: "en", Slug: "title"},
+		Html: template.HTML(`<a href="` + server.URL + `/header">a</a> <a href="` + server.URL + `/element#part">b</a>` +
+			`<a href="` + server.URL + `/none">c</a> <a href="https://valette.software/en/agenda">d</a> <a href="#toc">e</a>` +
+			`<a href="http://127.0.0.1:1/unreachable">f</a>`),
+	}
+
+	sendMentions(post)
+
+	source := "https://valette.software/en/articles/title"
+	expected := map[string]string{
+		server.URL + "/header":  source + " header",
+		server.URL + "/element": source + " element",
+	}
+
+	if len(received) != len(expected) {
+		t.Errorf("expected %d mentions, got %+v", len(expected), received)
+	}
+
+	for target, value := range expected {
+		if received[target] != value {
+			t.Errorf("expected %s to receive %q, got %q", target, value, received[target])
+		}
+	}
+
+	var recorded int
+	db.QueryRow("SELECT COUNT(*) FROM webmention_sent WHERE post_id = ?", postId).Scan(&recorded)
+
+	if recorded != 4 {
+		t.Errorf("expected the 4 external links to be recorded, got %d", recorded)
+	}
+
+	clear(received)
+	sendMentions(post)
+
+	if len(received) != 0 {
+		t.Errorf("expected the links to be notified once, got %+v", received)
+	}
+
+	// the unreachable site is tried again a day later
+	db.Exec("UPDATE webmention_sent SET sent_at = sent_at - ?", int64(retryDelay.Seconds())+1)
+	sendMentions(post)
+
+	var unreachable string
+	db.QueryRow("SELECT result FROM webmention_sent WHERE NOT reached").Scan(&unreachable)
+
+	if len(received) != 0 || unreachable == "" {
+		t.Errorf("expected only the unreachable site to be tried again, got %+v and %q", received, unreachable)
+	}
+
+	// the sites learn the new address of the post
+	post.Slug = "new-title"
+	sendMentions(post)
+
+	if len(received) != len(expected) || received[server.URL+"/header"] != "https://valette.software/en/articles/new-title header" {
+		t.Errorf("expected the links to be notified of the new address, got %+v", received)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := NewClient().Get(server.URL)
+
+	if err == nil {
+		t.Errorf("expected the client to refuse the local network")
+	}
+}